@@ -0,0 +1,21 @@
+package ehpg
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrAuthenticationFailed is when Redis rejects the credentials of the client,
+// or requires credentials the client is not configured with.
+var ErrAuthenticationFailed = errors.New("redis authentication failed")
+
+// isAuthError returns true for the NOAUTH error of a server requiring
+// credentials, and the WRONGPASS error of an unknown ACL user or a wrong
+// password.
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "NOAUTH ") || strings.HasPrefix(msg, "WRONGPASS ")
+}
@@ -0,0 +1,52 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+)
+
+func TestNewEventStoreAuthenticationFailed(t *testing.T) {
+	testCases := map[string]error{
+		"wrong password": errors.New("WRONGPASS invalid username-password pair or user is disabled."),
+		"no credentials": errors.New("NOAUTH Authentication required."),
+	}
+
+	for name, authErr := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := redis.NewUniversalClient(&redis.UniversalOptions{
+				Addrs: []string{"127.0.0.1:6379"},
+			})
+
+			defer db.Close()
+
+			db.AddHook(newFailingHook("ping", authErr, 1))
+			if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSharedClient()); !errors.Is(err, rediseventstore.ErrAuthenticationFailed) {
+				t.Error("there should be an authentication error:", err)
+			}
+
+			store, err := rediseventstore.NewEventStore(db, rediseventstore.WithSharedClient())
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			db.AddHook(newFailingHook("ping", authErr, 1))
+			if err := store.Ping(context.Background()); !errors.Is(err, rediseventstore.ErrAuthenticationFailed) {
+				t.Error("there should be an authentication error:", err)
+			}
+		})
+	}
+
+	// Other errors are not authentication errors.
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	defer db.Close()
+
+	db.AddHook(newFailingHook("ping", errors.New("LOADING Redis is loading the dataset in memory"), 1))
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSharedClient()); err == nil || errors.Is(err, rediseventstore.ErrAuthenticationFailed) {
+		t.Error("there should be a ping error:", err)
+	}
+}
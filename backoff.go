@@ -0,0 +1,91 @@
+package ehpg
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Backoff is the strategy of the delays between retries, see WithBackoff.
+type Backoff interface {
+	// NextDelay returns the delay before a retry, where attempt is 1 for the
+	// first retry.
+	NextDelay(attempt int) time.Duration
+}
+
+// WithBackoff sets the delays between the retries of WithSaveRetries, instead
+// of doubling the delay of WithSaveRetries for every retry, and the delay
+// before the retry of WithReconnectRetry, which otherwise retries right away.
+func WithBackoff(b Backoff) Option {
+	return func(s *EventStore) error {
+		if b == nil {
+			return fmt.Errorf("%w: backoff must not be nil", ErrInvalidOption)
+		}
+
+		s.backoff = b
+
+		return nil
+	}
+}
+
+// NewConstantBackoff returns a Backoff with the same delay before every retry.
+func NewConstantBackoff(delay time.Duration) Backoff {
+	return constantBackoff(delay)
+}
+
+type constantBackoff time.Duration
+
+// NextDelay implements the NextDelay method of the Backoff interface.
+func (b constantBackoff) NextDelay(attempt int) time.Duration {
+	return time.Duration(b)
+}
+
+// NewExponentialBackoff returns a Backoff with a delay of base before the
+// first retry, doubling the delay for every following retry up to max. A max
+// of 0 doesn't limit the delay.
+func NewExponentialBackoff(base, max time.Duration) Backoff {
+	return exponentialBackoff{base: base, max: max}
+}
+
+type exponentialBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// NextDelay implements the NextDelay method of the Backoff interface.
+func (b exponentialBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.base
+	for i := 1; i < attempt && delay > 0; i++ {
+		if b.max > 0 && delay >= b.max {
+			break
+		}
+		if delay > time.Duration(1<<62) {
+			return time.Duration(1<<63 - 1)
+		}
+		delay *= 2
+	}
+	if b.max > 0 && delay > b.max {
+		return b.max
+	}
+	return delay
+}
+
+// NewJitteredBackoff returns a Backoff with a random delay between 0 and the
+// delay of b, which spreads the retries of clients failing at the same time,
+// like after a failover.
+func NewJitteredBackoff(b Backoff) Backoff {
+	return jitteredBackoff{b}
+}
+
+type jitteredBackoff struct {
+	backoff Backoff
+}
+
+// NextDelay implements the NextDelay method of the Backoff interface.
+func (b jitteredBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.backoff.NextDelay(attempt)
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
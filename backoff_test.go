@@ -0,0 +1,81 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	constant := rediseventstore.NewConstantBackoff(time.Second)
+	for attempt := 1; attempt <= 3; attempt++ {
+		if delay := constant.NextDelay(attempt); delay != time.Second {
+			t.Error("the delay should be constant:", attempt, delay)
+		}
+	}
+
+	exponential := rediseventstore.NewExponentialBackoff(time.Second, 5*time.Second)
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := exponential.NextDelay(attempt + 1); delay != expected {
+			t.Error("the delay should double up to the max:", attempt+1, delay)
+		}
+	}
+	unlimited := rediseventstore.NewExponentialBackoff(time.Second, 0)
+	if delay := unlimited.NextDelay(100); delay <= 0 {
+		t.Error("the delay should not overflow:", delay)
+	}
+
+	jittered := rediseventstore.NewJitteredBackoff(constant)
+	for i := 0; i < 100; i++ {
+		if delay := jittered.NextDelay(1); delay < 0 || delay > time.Second {
+			t.Error("the delay should be between 0 and the delay:", delay)
+		}
+	}
+	if delay := rediseventstore.NewJitteredBackoff(rediseventstore.NewConstantBackoff(0)).NextDelay(1); delay != 0 {
+		t.Error("the delay should be 0:", delay)
+	}
+}
+
+// recordingBackoff is a Backoff without delays recording the attempts.
+type recordingBackoff struct {
+	attempts []int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return 0
+}
+
+func TestEventStoreBackoff(t *testing.T) {
+	backoff := &recordingBackoff{}
+	store, db := newEventStore(t,
+		rediseventstore.WithSaveRetries(3, time.Hour),
+		rediseventstore.WithBackoff(backoff))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	db.AddHook(newFailingHook("evalsha", io.EOF, 2))
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, uuid.New(), 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(backoff.attempts, []int{1, 2}) {
+		t.Error("the backoff should be asked for the delay of every retry:", backoff.attempts)
+	}
+}
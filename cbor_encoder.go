@@ -0,0 +1,51 @@
+package ehpg
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// NewCBOREncoder returns an Encoder marshaling event data as CBOR (RFC 8949),
+// for consumers in other languages. The event data is created with the
+// factories registered with eh.RegisterEventData, and struct fields without a
+// cbor tag are named by their json tags. Times are encoded as RFC 3339 strings
+// with nanoseconds.
+func NewCBOREncoder() Encoder {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		// The options are constant and valid.
+		panic(err)
+	}
+
+	return cborEncoder{enc: enc}
+}
+
+type cborEncoder struct {
+	enc cbor.EncMode
+}
+
+func (e cborEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return e.enc.Marshal(data)
+}
+
+func (cborEncoder) Unmarshal(eventType eh.EventType, raw []byte) (eh.EventData, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	data, err := eh.CreateEventData(eventType)
+	if err != nil {
+		return nil, err
+	}
+	if err := cbor.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (cborEncoder) String() string {
+	return "cbor"
+}
@@ -0,0 +1,120 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const orderShippedEventType eh.EventType = "OrderShipped"
+
+// orderShipped is event data with nested structs and times.
+type orderShipped struct {
+	OrderID uuid.UUID `json:"order_id"`
+	Address struct {
+		Street string `json:"street"`
+		City   string `json:"city"`
+	} `json:"address"`
+	Parcels   []parcel          `json:"parcels"`
+	Carrier   *parcelCarrier    `json:"carrier"`
+	Labels    map[string]string `json:"labels"`
+	ShippedAt time.Time         `json:"shipped_at"`
+}
+
+type parcel struct {
+	Weight      float64   `json:"weight"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+type parcelCarrier struct {
+	Name string `json:"name"`
+}
+
+func init() {
+	eh.RegisterEventData(orderShippedEventType, func() eh.EventData {
+		return &orderShipped{}
+	})
+}
+
+func newOrderShipped() *orderShipped {
+	now := time.Now().UTC()
+	data := &orderShipped{
+		OrderID: uuid.New(),
+		Parcels: []parcel{
+			{Weight: 1.5, DeliveredAt: now.Add(time.Hour)},
+			{Weight: 0.25, DeliveredAt: now.Add(2 * time.Hour)},
+		},
+		Carrier:   &parcelCarrier{Name: "carrier"},
+		Labels:    map[string]string{"priority": "high"},
+		ShippedAt: now,
+	}
+	data.Address.Street = "Street 1"
+	data.Address.City = "City"
+	return data
+}
+
+func TestCBOREncoder(t *testing.T) {
+	encoder := rediseventstore.NewCBOREncoder()
+
+	expected := newOrderShipped()
+	raw, err := encoder.Marshal(expected)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	data, err := encoder.Unmarshal(orderShippedEventType, raw)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("the data should be unmarshaled: %+v", data)
+	}
+
+	if raw, err := encoder.Marshal(nil); err != nil || raw != nil {
+		t.Error("nil data should be marshaled as nil:", raw, err)
+	}
+	if data, err := encoder.Unmarshal(orderShippedEventType, nil); err != nil || data != nil {
+		t.Error("empty data should be unmarshaled as nil:", data, err)
+	}
+	if _, err := encoder.Unmarshal("Unregistered", raw); err == nil {
+		t.Error("there should be an error for an unregistered event type")
+	}
+}
+
+func TestEventStoreCBOREncoder(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithEncoder(rediseventstore.NewCBOREncoder()))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	expected := newOrderShipped()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(orderShippedEventType, expected, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	if !reflect.DeepEqual(events[0].Data(), expected) {
+		t.Errorf("the data should be loaded: %+v", events[0].Data())
+	}
+}
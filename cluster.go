@@ -0,0 +1,22 @@
+package ehpg
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrSlotMoved is when a Redis Cluster command is still redirected with MOVED
+// or ASK after retrying, as a slot of the keys is being migrated. The
+// operation can be retried when the migration is done.
+var ErrSlotMoved = errors.New("cluster slot moved")
+
+// isRedirect returns true for the MOVED and ASK errors of Redis Cluster, which
+// the cluster client follows for single commands and pipelines, but not for
+// commands sent to a node client or queued in a WATCH transaction.
+func isRedirect(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "MOVED ") || strings.HasPrefix(msg, "ASK ")
+}
@@ -0,0 +1,64 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// WithCommandTimeout limits every Redis command and pipeline of operations on
+// a single aggregate, like Save, Load and LoadSnapshot, to the duration, with
+// a deadline on a context derived from the caller's. A command exceeding it,
+// like an HGETALL of a very large aggregate, fails the operation with an
+// eh.EventStoreError wrapping context.DeadlineExceeded, telling the command
+// that timed out. Unlike WithOperationTimeout it limits every round trip, not
+// the operation, and unlike the ReadTimeout and DialTimeout of the client it
+// only applies to the commands of the store, not to those of other users of
+// the client, like the blocking reads of the event bus.
+//
+// The client must be created with ContextTimeoutEnabled, as the client
+// ignores context deadlines otherwise, so only *redis.Client and
+// *redis.ClusterClient clients are supported. The WATCH of transactions, like
+// those of Compact, is sent by the client and only limited by the operation
+// timeout. Operations scanning the namespace, like Clear, are not limited.
+func WithCommandTimeout(d time.Duration) Option {
+	return func(s *EventStore) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: command timeout must be positive, got %s", ErrInvalidOption, d)
+		}
+		if !contextTimeoutEnabled(s.db) {
+			return fmt.Errorf("%w: command timeouts require a client created with ContextTimeoutEnabled", ErrInvalidOption)
+		}
+
+		s.commandTimeout = d
+
+		return nil
+	}
+}
+
+// contextTimeoutEnabled returns whether the client respects context deadlines.
+func contextTimeoutEnabled(db redis.UniversalClient) bool {
+	switch c := db.(type) {
+	case *redis.Client:
+		return c.Options().ContextTimeoutEnabled
+	case *redis.ClusterClient:
+		return c.Options().ContextTimeoutEnabled
+	}
+	return false
+}
+
+// commandTimeoutKey is the context key marking the operations of a store
+// whose commands are limited by WithCommandTimeout.
+type commandTimeoutKey struct {
+	store *EventStore
+}
+
+// withCommandTimeout marks the context of an operation, so that its commands
+// are limited by the command timeout of the store.
+func (s *EventStore) withCommandTimeout(ctx context.Context) context.Context {
+	if s.commandTimeout <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, commandTimeoutKey{store: s}, s.commandTimeout)
+}
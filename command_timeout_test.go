@@ -0,0 +1,120 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowHook is a redis hook delaying all commands while slow is set, failing
+// them like an aborted read when the context is done first.
+type slowHook struct {
+	delay time.Duration
+	slow  *int32
+}
+
+func (h slowHook) wait(ctx context.Context) error {
+	if atomic.LoadInt32(h.slow) == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(h.delay):
+		return nil
+	case <-ctx.Done():
+		return errors.New("i/o timeout")
+	}
+}
+
+func (h slowHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h slowHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.wait(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h slowHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.wait(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestEventStoreCommandTimeout(t *testing.T) {
+	db := redis.NewClient(&redis.Options{
+		Addr:                  "127.0.0.1:6379",
+		ContextTimeoutEnabled: true,
+	})
+	defer db.Close()
+
+	store, err := rediseventstore.NewEventStore(db, rediseventstore.WithCommandTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	slow := int32(1)
+	db.AddHook(slowHook{delay: 200 * time.Millisecond, slow: &slow})
+
+	start := time.Now()
+	_, err = store.Load(ctx, id)
+	if time.Since(start) > 150*time.Millisecond {
+		t.Error("the load should fail at the command timeout:", time.Since(start))
+	}
+
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, context.DeadlineExceeded) {
+		t.Fatal("there should be a deadline exceeded error:", err)
+	}
+	if !errors.Is(err, rediseventstore.ErrCouldNotLoadAggregate) {
+		t.Error("the error should be a load error:", err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, context.DeadlineExceeded) {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+
+	// Commands of other users of the client are not limited.
+	if err := db.Ping(ctx).Err(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	atomic.StoreInt32(&slow, 0)
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 1 {
+		t.Error("the events should be loaded:", events, err)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
@@ -0,0 +1,335 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// commands is the part of redis.Cmdable the store sends its commands with. It
+// is implemented by the clients, transactions and pipelines of go-redis, and
+// by storeCommands, which wraps the clients and transactions of the store.
+type commands interface {
+	redis.Scripter
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	DecrBy(ctx context.Context, key string, decrement int64) *redis.IntCmd
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HSetNX(ctx context.Context, key, field string, value interface{}) *redis.BoolCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	HLen(ctx context.Context, key string) *redis.IntCmd
+	HExists(ctx context.Context, key, field string) *redis.BoolCmd
+	SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd
+	ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd
+	ZAddNX(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+	ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZRangeByScoreWithScores(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.ZSliceCmd
+	ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd
+	XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd
+	Ping(ctx context.Context) *redis.StatusCmd
+}
+
+// storeClient is a client of the store, see client. Its commands are sent
+// like those of storeCommands, and the commands of its transactions too.
+type storeClient struct {
+	storeCommands
+	client redis.UniversalClient
+}
+
+// wrapClient returns the client sending the commands of the store with c.
+func (s *EventStore) wrapClient(c redis.UniversalClient) storeClient {
+	return storeClient{
+		storeCommands: storeCommands{s: s, cmds: c},
+		client:        c,
+	}
+}
+
+// Watch runs fn in an optimistic transaction watching the keys, like the Watch
+// of the client. The WATCH itself is sent by the client.
+func (c storeClient) Watch(ctx context.Context, fn func(tx commands) error, keys ...string) error {
+	// The WATCH, and the UNWATCH when the transaction ends.
+	c.s.countRoundTrips(ctx, 2)
+	return c.client.Watch(ctx, func(tx *redis.Tx) error {
+		return fn(storeCommands{s: c.s, cmds: tx})
+	}, keys...)
+}
+
+// storeCommands sends the commands of the store with a client or transaction,
+// every command and pipeline in a round trip of its own, see limitRoundTrip.
+// The store never sends commands to its clients any other way. It doesn't add
+// hooks to the client passed to NewEventStore, as they would affect all users
+// of the client, and would be kept after the store is closed.
+type storeCommands struct {
+	s    *EventStore
+	cmds commands
+}
+
+var _ commands = storeCommands{}
+
+// roundTrip sends the command of f in a round trip of an operation of the
+// store, see limitRoundTrip.
+func roundTrip[T redis.Cmder](ctx context.Context, s *EventStore, f func(context.Context) T) T {
+	var cmd T
+	_, _ = s.limitRoundTrip(ctx, func(ctx context.Context) ([]redis.Cmder, error) {
+		cmd = f(ctx)
+		return []redis.Cmder{cmd}, cmd.Err()
+	})
+	return cmd
+}
+
+// limitRoundTrip calls f, sending a command or pipeline, with a context with
+// the command timeout of the operation as deadline, see withCommandTimeout,
+// and counts the round trip for the span of the operation. When the deadline
+// is exceeded, and not the deadline of the caller, the error of the commands
+// wraps context.DeadlineExceeded, instead of the network error of the aborted
+// read.
+func (s *EventStore) limitRoundTrip(ctx context.Context, f func(context.Context) ([]redis.Cmder, error)) ([]redis.Cmder, error) {
+	s.countRoundTrips(ctx, 1)
+
+	d, ok := ctx.Value(commandTimeoutKey{store: s}).(time.Duration)
+	if !ok {
+		return f(ctx)
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	cmds, err := f(cmdCtx)
+	if err == nil || cmdCtx.Err() != context.DeadlineExceeded || ctx.Err() != nil {
+		return cmds, err
+	}
+
+	name := "pipeline"
+	if len(cmds) == 1 {
+		name = cmds[0].Name()
+	}
+	err = fmt.Errorf("%s timed out after %s: %w", name, d, context.DeadlineExceeded)
+	for _, cmd := range cmds {
+		cmd.SetErr(err)
+	}
+	return cmds, err
+}
+
+func (c storeCommands) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return c.s.limitRoundTrip(ctx, func(ctx context.Context) ([]redis.Cmder, error) {
+		return c.cmds.Pipelined(ctx, fn)
+	})
+}
+
+func (c storeCommands) TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return c.s.limitRoundTrip(ctx, func(ctx context.Context) ([]redis.Cmder, error) {
+		return c.cmds.TxPipelined(ctx, fn)
+	})
+}
+
+func (c storeCommands) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.Del(ctx, keys...)
+	})
+}
+
+func (c storeCommands) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.Exists(ctx, keys...)
+	})
+}
+
+func (c storeCommands) Get(ctx context.Context, key string) *redis.StringCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StringCmd {
+		return c.cmds.Get(ctx, key)
+	})
+}
+
+func (c storeCommands) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StatusCmd {
+		return c.cmds.Set(ctx, key, value, expiration)
+	})
+}
+
+func (c storeCommands) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.BoolCmd {
+		return c.cmds.SetNX(ctx, key, value, expiration)
+	})
+}
+
+func (c storeCommands) Incr(ctx context.Context, key string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.Incr(ctx, key)
+	})
+}
+
+func (c storeCommands) DecrBy(ctx context.Context, key string, decrement int64) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.DecrBy(ctx, key, decrement)
+	})
+}
+
+func (c storeCommands) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.SliceCmd {
+		return c.cmds.MGet(ctx, keys...)
+	})
+}
+
+func (c storeCommands) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.ScanCmd {
+		return c.cmds.Scan(ctx, cursor, match, count)
+	})
+}
+
+func (c storeCommands) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StringCmd {
+		return c.cmds.HGet(ctx, key, field)
+	})
+}
+
+func (c storeCommands) HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.MapStringStringCmd {
+		return c.cmds.HGetAll(ctx, key)
+	})
+}
+
+func (c storeCommands) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.SliceCmd {
+		return c.cmds.HMGet(ctx, key, fields...)
+	})
+}
+
+func (c storeCommands) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.HSet(ctx, key, values...)
+	})
+}
+
+func (c storeCommands) HSetNX(ctx context.Context, key, field string, value interface{}) *redis.BoolCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.BoolCmd {
+		return c.cmds.HSetNX(ctx, key, field, value)
+	})
+}
+
+func (c storeCommands) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.HDel(ctx, key, fields...)
+	})
+}
+
+func (c storeCommands) HLen(ctx context.Context, key string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.HLen(ctx, key)
+	})
+}
+
+func (c storeCommands) HExists(ctx context.Context, key, field string) *redis.BoolCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.BoolCmd {
+		return c.cmds.HExists(ctx, key, field)
+	})
+}
+
+func (c storeCommands) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.ScanCmd {
+		return c.cmds.SScan(ctx, key, cursor, match, count)
+	})
+}
+
+func (c storeCommands) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.ZAdd(ctx, key, members...)
+	})
+}
+
+func (c storeCommands) ZAddNX(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.ZAddNX(ctx, key, members...)
+	})
+}
+
+func (c storeCommands) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.ZCard(ctx, key)
+	})
+}
+
+func (c storeCommands) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StringSliceCmd {
+		return c.cmds.ZRange(ctx, key, start, stop)
+	})
+}
+
+func (c storeCommands) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.ZSliceCmd {
+		return c.cmds.ZRangeWithScores(ctx, key, start, stop)
+	})
+}
+
+func (c storeCommands) ZRangeByScoreWithScores(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.ZSliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.ZSliceCmd {
+		return c.cmds.ZRangeByScoreWithScores(ctx, key, opt)
+	})
+}
+
+func (c storeCommands) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.IntCmd {
+		return c.cmds.ZRemRangeByScore(ctx, key, min, max)
+	})
+}
+
+func (c storeCommands) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.XMessageSliceCmd {
+		return c.cmds.XRangeN(ctx, stream, start, stop, count)
+	})
+}
+
+func (c storeCommands) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.Cmd {
+		return c.cmds.Eval(ctx, script, keys, args...)
+	})
+}
+
+func (c storeCommands) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.Cmd {
+		return c.cmds.EvalSha(ctx, sha1, keys, args...)
+	})
+}
+
+func (c storeCommands) EvalRO(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.Cmd {
+		return c.cmds.EvalRO(ctx, script, keys, args...)
+	})
+}
+
+func (c storeCommands) EvalShaRO(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.Cmd {
+		return c.cmds.EvalShaRO(ctx, sha1, keys, args...)
+	})
+}
+
+func (c storeCommands) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.BoolSliceCmd {
+		return c.cmds.ScriptExists(ctx, hashes...)
+	})
+}
+
+func (c storeCommands) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StringCmd {
+		return c.cmds.ScriptLoad(ctx, script)
+	})
+}
+
+func (c storeCommands) Ping(ctx context.Context) *redis.StatusCmd {
+	return roundTrip(ctx, c.s, func(ctx context.Context) *redis.StatusCmd {
+		return c.cmds.Ping(ctx)
+	})
+}
@@ -0,0 +1,185 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// ErrCouldNotCompact is when the events of an aggregate could not be compacted.
+var ErrCouldNotCompact = errors.New("could not compact aggregate")
+
+// ErrSnapshotRequired is when events would be compacted without a snapshot at
+// or after the version to compact to.
+var ErrSnapshotRequired = errors.New("snapshot required")
+
+// ErrCompactAllEvents is when compacting would remove all events of an
+// aggregate.
+var ErrCompactAllEvents = errors.New("compacting would remove all events")
+
+// Compact removes the events of an aggregate with a version below
+// beforeVersion to reclaim memory, returning the number of removed events.
+// It requires a snapshot at or after beforeVersion, and always keeps the
+// latest event, so that the aggregate can still be restored and saved to.
+//
+// The number of compacted events is kept with the aggregate, so that saves
+// keep checking the version. Loading a compacted aggregate returns the events
+// from beforeVersion on, which should be applied to the snapshot.
+func (s *EventStore) Compact(ctx context.Context, id uuid.UUID, beforeVersion int) (int, error) {
+	ctx, span := s.startSpan(ctx, "Compact",
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+	n, err := withTimeout(ctx, s, ErrCouldNotCompact, func(ctx context.Context) (int, error) {
+		return s.compact(ctx, id, beforeVersion)
+	})
+	span.end(err, eventCountAttribute.Int(n))
+	s.metrics.observe("compact", namespaceFromContext(ctx), start, err)
+
+	return n, err
+}
+
+// compact removes the events before a version, see Compact.
+func (s *EventStore) compact(ctx context.Context, id uuid.UUID, beforeVersion int) (int, error) {
+	ns := namespaceFromContext(ctx)
+	key := s.aggregateKey(ns, id)
+	compactedKey := s.compactedKey(ns, id)
+
+	if err := s.checkWrite(); err != nil {
+		return 0, err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	err := s.client(ns).Watch(ctx, func(tx commands) error {
+		compacted, err := s.compactedEvents(ctx, tx, compactedKey)
+		if err != nil {
+			return err
+		}
+		version, err := s.storedVersion(ctx, tx, ns, id, key)
+		if err != nil {
+			return err
+		}
+
+		if beforeVersion > version {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("version %d is after the latest version %d", beforeVersion, version),
+				Err:     ErrCompactAllEvents,
+			}
+		}
+		if beforeVersion-1 <= compacted {
+			return nil
+		}
+
+		snapshot, err := s.loadSnapshot(ctx, id)
+		if err != nil {
+			return err
+		}
+		if snapshot == nil || snapshot.Version < beforeVersion {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("no snapshot at or after version %d", beforeVersion),
+				Err:     ErrSnapshotRequired,
+			}
+		}
+
+		// The event data of compacted events referenced by the kept events
+		// of WithPayloadDedup is moved to the kept events.
+		var refs []AggregateEvent
+		if s.payloadDedup {
+			dbEvents, err := s.loadStoredAll(ctx, tx, key).events()
+			if err != nil {
+				return err
+			}
+			refs, err = rehomePayloads(dbEvents, func(version int) bool {
+				return version < beforeVersion
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		var cmd *redis.IntCmd
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			cmd = s.removeEvents(ctx, pipe, key, compacted+1, beforeVersion-1)
+			pipe.Set(ctx, compactedKey, beforeVersion-1, s.eventTTL)
+			for _, e := range refs {
+				s.setEvent(ctx, pipe, key, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		removed = int(cmd.Val())
+
+		return nil
+	}, key, compactedKey, s.recordKey(ns, id))
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return 0, storeErr
+	} else if err != nil {
+		return 0, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotCompact,
+		}
+	}
+
+	return removed, nil
+}
+
+// compactedEvents returns the number of compacted events of an aggregate.
+func (s *EventStore) compactedEvents(ctx context.Context, c commands, compactedKey string) (int, error) {
+	compacted, err := c.Get(ctx, compactedKey).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return compacted, err
+}
+
+// storedVersion returns the version of an aggregate, which is the version
+// field of WithVersionField, or the version of its aggregate record. Aggregates
+// without either, like those saved before records were added, have the number
+// of stored events plus the number of compacted events as version.
+func (s *EventStore) storedVersion(ctx context.Context, c commands, ns string, id uuid.UUID, key string) (int, error) {
+	if s.versionField {
+		version, err := c.HGet(ctx, key, versionField).Int()
+		if err == nil || err != redis.Nil {
+			return version, err
+		}
+	}
+
+	raw, err := c.Get(ctx, s.recordKey(ns, id)).Bytes()
+	if err == nil {
+		record := AggregateRecord{}
+		if err := record.UnmarshalBinary(raw); err != nil {
+			return 0, err
+		}
+		return record.Version, nil
+	} else if err != redis.Nil {
+		return 0, err
+	}
+
+	compacted, err := s.compactedEvents(ctx, c, s.compactedKey(ns, id))
+	if err != nil {
+		return 0, err
+	}
+	stored, err := s.countEvents(ctx, c, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(stored) + compacted, nil
+}
+
+// compactedKey returns the key holding the number of compacted events of an
+// aggregate.
+func (s *EventStore) compactedKey(ns string, id interface{}) string {
+	return s.keyPrefix + "compacted:" + s.keyBuilder(ns, fmt.Sprint(id))
+}
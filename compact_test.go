@@ -0,0 +1,122 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreCompact(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":            nil,
+		"watch":             {rediseventstore.WithWatchSave()},
+		"script sorted set": {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			for version := 1; version <= 10; version++ {
+				if err := store.Save(ctx, []eh.Event{
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, version)),
+				}, version-1); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			if _, err := store.Compact(ctx, id, 8); !errors.Is(err, rediseventstore.ErrSnapshotRequired) {
+				t.Error("there should be a snapshot required error:", err)
+			}
+
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       10,
+				AggregateType: mocks.AggregateType,
+				Timestamp:     time.Now(),
+				State:         map[string]interface{}{"content": "state"},
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			if _, err := store.Compact(ctx, id, 11); !errors.Is(err, rediseventstore.ErrCompactAllEvents) {
+				t.Error("there should be a compact all events error:", err)
+			}
+
+			n, err := store.Compact(ctx, id, 8)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if n != 7 {
+				t.Error("7 events should be removed:", n)
+			}
+
+			n, err = store.Compact(ctx, id, 8)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if n != 0 {
+				t.Error("no more events should be removed:", n)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 3 || events[0].Version() != 8 {
+				t.Error("the events from version 8 should be kept:", events)
+			}
+
+			stream, errs := store.LoadStream(ctx, id)
+			streamed := 0
+			for range stream {
+				streamed++
+			}
+			if err := <-errs; err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if streamed != 3 {
+				t.Error("the kept events should be streamed:", streamed)
+			}
+
+			// Saves keep checking the version of the aggregate.
+			event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 4))
+			err = store.Save(ctx, []eh.Event{event}, 3)
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 11)),
+			}, 10); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			events, err = store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 4 || events[3].Version() != 11 {
+				t.Error("the event should be saved after the compacted events:", events)
+			}
+		})
+	}
+}
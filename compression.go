@@ -0,0 +1,75 @@
+package ehpg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnknownCompression is when stored event data uses an unknown compression codec.
+var ErrUnknownCompression = errors.New("unknown compression")
+
+// Compression is the codec used to compress stored event data. It is stored
+// as a header byte in front of the binary event data, so data written with
+// different codecs can be read side by side.
+type Compression byte
+
+const (
+	// NoCompression stores the event data as is.
+	NoCompression Compression = iota
+	// Gzip compresses the event data with gzip.
+	Gzip
+)
+
+// String returns the name of the compression codec.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(c))
+}
+
+// compress returns the data compressed with c, prefixed with the codec byte.
+func (c Compression) compress(data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return append([]byte{byte(c)}, data...), nil
+	case Gzip:
+		buf := bytes.NewBuffer([]byte{byte(c)})
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, c)
+}
+
+// decompress returns the data of a codec byte prefixed payload.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	switch c := Compression(data[0]); c {
+	case NoCompression:
+		return data[1:], nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, c)
+	}
+}
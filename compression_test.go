@@ -0,0 +1,93 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreCompression(t *testing.T) {
+	plain, _ := newEventStore(t)
+	compressed, _ := newEventStore(t, rediseventstore.WithCompression(rediseventstore.Gzip))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := plain.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Mix uncompressed and compressed events in the same aggregate.
+	id := uuid.New()
+	content := strings.Repeat("content", 1000)
+	if err := plain.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: content}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := compressed.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: content}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+		eh.NewEvent(mocks.EventOtherType, nil, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3)),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	for _, store := range []*rediseventstore.EventStore{plain, compressed} {
+		events, err := store.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != 3 {
+			t.Fatal("there should be three events:", events)
+		}
+		for _, event := range events[:2] {
+			if data, ok := event.Data().(*mocks.EventData); !ok || data.Content != content {
+				t.Error("the event data should be loaded:", event)
+			}
+		}
+		if events[2].Data() != nil {
+			t.Error("the event data should be nil:", events[2].Data())
+		}
+	}
+}
+
+func BenchmarkEventStoreCompression(b *testing.B) {
+	for _, compression := range []rediseventstore.Compression{rediseventstore.NoCompression, rediseventstore.Gzip} {
+		b.Run(compression.String(), func(b *testing.B) {
+			store, db := newEventStore(b, rediseventstore.WithCompression(compression))
+
+			ctx := namespace.NewContext(context.Background(), "bench")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					b.Fatal("there should be no error:", err)
+				}
+			}()
+
+			data := &mocks.EventData{Content: strings.Repeat(`{"field":"value","number":42},`, 200)}
+
+			var size int64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := uuid.New()
+				event := eh.NewEvent(mocks.EventType, data, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1))
+				if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+					b.Fatal("there should be no error:", err)
+				}
+				size = int64(len(db.HGet(context.Background(), "bench:"+id.String(), "1").Val()))
+			}
+			b.ReportMetric(float64(size), "stored-bytes/event")
+		})
+	}
+}
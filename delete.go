@@ -0,0 +1,105 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// ErrCouldNotDeleteAggregate is when an aggregate could not be deleted.
+var ErrCouldNotDeleteAggregate = errors.New("could not delete aggregate")
+
+// DeleteAggregate deletes the events, record and snapshots of an aggregate
+// and removes its events from the event index and the event type index, for
+// example to erase the data of a single user. All keys are unlinked in one
+// MULTI/EXEC pipeline. Deleting an aggregate that doesn't exist succeeds.
+//
+// Entries of the outbox stream and the global log are not removed, as streams
+// are append only.
+func (s *EventStore) DeleteAggregate(ctx context.Context, id uuid.UUID) error {
+	ctx, span := s.startSpan(ctx, "DeleteAggregate",
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+	_, err := withTimeout(ctx, s, ErrCouldNotDeleteAggregate, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.deleteAggregate(ctx, id)
+	})
+	span.end(err)
+	s.metrics.observe("delete_aggregate", namespaceFromContext(ctx), start, err)
+
+	return err
+}
+
+// deleteAggregate deletes an aggregate, see DeleteAggregate.
+func (s *EventStore) deleteAggregate(ctx context.Context, id uuid.UUID) error {
+	ns := namespaceFromContext(ctx)
+	key := s.aggregateKey(ns, id)
+	keys := []string{
+		key,
+		s.recordKey(ns, id),
+		s.compactedKey(ns, id),
+		s.snapshotKey(ns, id),
+		s.snapshotsKey(ns, id),
+	}
+
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+
+	err := s.client(ns).Watch(ctx, func(tx commands) error {
+		// The stored events are only needed to find their index entries and
+		// event keys.
+		var events []AggregateEvent
+		if s.eventIndex || s.eventTypeIndex || s.storageMode == KeyPerEventStorage {
+			dbEvents, err := s.loadAll(ctx, tx, key).events()
+			if err != nil {
+				return err
+			}
+			for _, raw := range dbEvents {
+				e := AggregateEvent{}
+				if err := e.UnmarshalBinary([]byte(raw)); err != nil {
+					return eh.EventStoreError{
+						BaseErr: err,
+						Err:     ErrCouldNotUnmarshalEvent,
+					}
+				}
+				events = append(events, e)
+				if s.storageMode == KeyPerEventStorage {
+					keys = append(keys, eventKey(key, e.Version))
+				}
+			}
+		}
+
+		return s.deleteKeys(ctx, func(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+			return tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, e := range events {
+					if s.eventIndex {
+						pipe.HDel(ctx, s.eventIndexKey(ns), e.EventID.String())
+					}
+					if s.eventTypeIndex {
+						pipe.SRem(ctx, s.eventTypeIndexKey(ns, e.EventType), eventIndexValue(e))
+					}
+				}
+				return fn(pipe)
+			})
+		}, keys)
+	}, key)
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return storeErr
+	} else if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotDeleteAggregate,
+		}
+	}
+
+	return nil
+}
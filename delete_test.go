@@ -0,0 +1,116 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreDeleteAggregate(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"hash": {rediseventstore.WithEventIndex(), rediseventstore.WithEventTypeIndex()},
+		"sorted set": {
+			rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage),
+			rediseventstore.WithEventIndex(),
+			rediseventstore.WithEventTypeIndex(),
+		},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id, other := uuid.New(), uuid.New()
+			for _, aggregateID := range []uuid.UUID{id, other} {
+				if err := store.Save(ctx, []eh.Event{
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, aggregateID, 1)),
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, aggregateID, 2)),
+				}, 0); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       2,
+				AggregateType: mocks.AggregateType,
+				Timestamp:     time.Now(),
+				State:         map[string]interface{}{"content": "state"},
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			if err := store.DeleteAggregate(ctx, id); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			loaded, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(loaded) != 0 {
+				t.Error("there should be no events:", loaded)
+			}
+			snapshot, err := store.LoadSnapshot(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if snapshot != nil {
+				t.Error("there should be no snapshot:", snapshot)
+			}
+			n, err := db.Exists(ctx,
+				"aggregate:ns:{"+id.String()+"}",
+				"snapshot:ns:{"+id.String()+"}").Result()
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if n != 0 {
+				t.Error("the keys of the aggregate should be deleted:", n)
+			}
+			if _, err := store.LoadByEventID(ctx, events[0].(interface{ EventID() uuid.UUID }).EventID()); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+				t.Error("the event should be removed from the event index:", err)
+			}
+
+			typed, err := store.LoadByEventType(ctx, mocks.EventType, 10)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(typed) != 2 {
+				t.Error("the events should be removed from the event type index:", typed)
+			}
+
+			// Other aggregates are kept.
+			loaded, err = store.Load(ctx, other)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(loaded) != 2 {
+				t.Error("the other aggregate should be kept:", loaded)
+			}
+
+			// Deleting a deleted aggregate succeeds.
+			if err := store.DeleteAggregate(ctx, id); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ehpg
+
+import (
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrUnknownEncryptionKey is when stored data is encrypted with a key no cipher has.
+var ErrUnknownEncryptionKey = errors.New("unknown encryption key")
+
+// Cipher encrypts and decrypts stored data with a key, for example with a key
+// of a KMS.
+type Cipher interface {
+	// KeyID identifies the key of the cipher. It is stored with the encrypted
+	// data to find the cipher to decrypt it with after the key is rotated.
+	KeyID() string
+	// Encrypt encrypts the plaintext.
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt decrypts a ciphertext encrypted by Encrypt.
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// WithEncryption encrypts the stored event data with the cipher. Data
+// encrypted with the keys of previous ciphers can still be loaded, so a key is
+// rotated by passing the cipher of the new key followed by the old ones.
+// Data stored before encryption was enabled is loaded as is. The outbox
+// stream gets the encrypted data.
+func WithEncryption(cipher Cipher, previous ...Cipher) Option {
+	return func(s *EventStore) error {
+		if cipher == nil {
+			return fmt.Errorf("%w: cipher must not be nil", ErrInvalidOption)
+		}
+
+		s.cipher = cipher
+		s.ciphers = map[string]Cipher{}
+		for _, c := range append([]Cipher{cipher}, previous...) {
+			if c == nil {
+				return fmt.Errorf("%w: cipher must not be nil", ErrInvalidOption)
+			}
+			if _, ok := s.ciphers[c.KeyID()]; !ok {
+				s.ciphers[c.KeyID()] = c
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithMetadataEncryption encrypts the stored event metadata too, which is
+// stored in clear by WithEncryption. It requires WithEncryption.
+func WithMetadataEncryption() Option {
+	return func(s *EventStore) error {
+		s.encryptMetadata = true
+
+		return nil
+	}
+}
+
+// encrypt encrypts the data with the current cipher.
+func (s *EventStore) encrypt(data []byte) ([]byte, error) {
+	ciphertext, err := s.cipher.Encrypt(data)
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotMarshalEvent,
+		}
+	}
+
+	return ciphertext, nil
+}
+
+// decrypt decrypts the data with the cipher of the key.
+func (s *EventStore) decrypt(keyID string, data []byte) ([]byte, error) {
+	cipher, ok := s.ciphers[keyID]
+	if !ok {
+		return nil, eh.EventStoreError{
+			BaseErr: fmt.Errorf("%w: %q", ErrUnknownEncryptionKey, keyID),
+			Err:     ErrCouldNotUnmarshalEvent,
+		}
+	}
+
+	plaintext, err := cipher.Decrypt(data)
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalEvent,
+		}
+	}
+
+	return plaintext, nil
+}
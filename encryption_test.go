@@ -0,0 +1,116 @@
+package ehpg_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+// xorCipher is a test cipher XORing the data with its key.
+type xorCipher struct {
+	id  string
+	key byte
+}
+
+func (c xorCipher) KeyID() string {
+	return c.id
+}
+
+func (c xorCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return c.xor(plaintext), nil
+}
+
+func (c xorCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return c.xor(ciphertext), nil
+}
+
+func (c xorCipher) xor(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ c.key
+	}
+	return out
+}
+
+func TestEventStoreEncryption(t *testing.T) {
+	oldKey := xorCipher{id: "old", key: 0x5a}
+	newKey := xorCipher{id: "new", key: 0xa5}
+
+	store, db := newEventStore(t,
+		rediseventstore.WithEncryption(oldKey),
+		rediseventstore.WithMetadataEncryption(),
+	)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "secret"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1),
+			eh.WithMetadata(map[string]interface{}{"user": "private"})),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	raw, err := db.HGet(ctx, "ns:{"+id.String()+"}", "1").Bytes()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bytes.Contains(raw, []byte("secret")) || bytes.Contains(raw, []byte("private")) {
+		t.Error("the event data and metadata should be encrypted:", string(raw))
+	}
+
+	// Rotate the key, the old data can still be loaded.
+	rotated, _ := newEventStore(t, rediseventstore.WithEncryption(newKey, oldKey))
+	if err := rotated.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2),
+			eh.WithMetadata(map[string]interface{}{"user": "public"})),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	raw, err = db.HGet(ctx, "ns:{"+id.String()+"}", "2").Bytes()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !bytes.Contains(raw, []byte("public")) {
+		t.Error("the metadata should be stored in clear:", string(raw))
+	}
+
+	events, err := rotated.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	if data, ok := events[0].Data().(*mocks.EventData); !ok || data.Content != "secret" {
+		t.Error("the event data should be decrypted:", events[0].Data())
+	}
+	if events[0].Metadata()["user"] != "private" {
+		t.Error("the metadata should be decrypted:", events[0].Metadata())
+	}
+	if data, ok := events[1].Data().(*mocks.EventData); !ok || data.Content != "event" {
+		t.Error("the event data should be decrypted:", events[1].Data())
+	}
+
+	// Without the old key the old data can't be decrypted.
+	newOnly, _ := newEventStore(t, rediseventstore.WithEncryption(newKey))
+	if _, err := newOnly.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUnmarshalEvent) {
+		t.Error("there should be an unmarshal error:", err)
+	}
+}
@@ -0,0 +1,124 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEventIndexDisabled is when events are loaded by ID without the event index.
+var ErrEventIndexDisabled = errors.New("event index is disabled")
+
+// WithEventIndex indexes the saved events by event ID in the hash
+// eventid:{namespace}, written in the same atomic write as the events, so
+// that they can be loaded with LoadByEventID. The index is not supported on
+// Redis Cluster, as the hash is in another slot than the aggregates. Index
+// entries of events expired with WithEventTTL are removed when they are
+// loaded.
+func WithEventIndex() Option {
+	return func(s *EventStore) error {
+		s.eventIndex = true
+
+		return nil
+	}
+}
+
+// eventIndexValue returns the value of an event in the event index, which is
+// the aggregate ID and version of the event.
+func eventIndexValue(e AggregateEvent) string {
+	return e.AggregateID.String() + ":" + strconv.Itoa(e.Version)
+}
+
+// LoadByEventID loads a single event of the namespace by its event ID, for
+// example to find an event referenced in logs. It requires WithEventIndex, and
+// returns ErrEventNotFound for unknown event IDs.
+func (s *EventStore) LoadByEventID(ctx context.Context, id uuid.UUID) (eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadByEventID", namespaceAttribute.String(ns))
+	start := time.Now()
+	event, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (eh.Event, error) {
+		return s.loadByEventID(ctx, ns, id)
+	})
+	events := 0
+	if event != nil {
+		events = 1
+	}
+	span.end(err, eventCountAttribute.Int(events))
+	s.metrics.observeLoad("load_by_event_id", ns, events, start, err)
+
+	return event, err
+}
+
+// loadByEventID loads an event by its event ID, see LoadByEventID.
+func (s *EventStore) loadByEventID(ctx context.Context, ns string, id uuid.UUID) (eh.Event, error) {
+	if !s.eventIndex {
+		return nil, eh.EventStoreError{
+			Err: ErrEventIndexDisabled,
+		}
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	value, err := s.client(ns).HGet(ctx, s.eventIndexKey(ns), id.String()).Result()
+	if err == redis.Nil {
+		return nil, eh.EventStoreError{
+			Err: ErrEventNotFound,
+		}
+	} else if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	aggregateID, field, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, eh.EventStoreError{
+			BaseErr: fmt.Errorf("invalid event index value %q", value),
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	version, err := strconv.Atoi(field)
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: fmt.Errorf("invalid event index value %q", value),
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	dbEvents, err := s.loadRange(ctx, s.client(ns), s.aggregateKey(ns, aggregateID), version, version).events()
+	dbEvent, ok := dbEvents[field]
+	if err == nil && !ok {
+		// The aggregate has expired, remove the stale index entry unless the
+		// store is read-only.
+		if s.isReadOnly() {
+			return nil, eh.EventStoreError{
+				Err: ErrEventNotFound,
+			}
+		}
+		if err := s.client(ns).HDel(ctx, s.eventIndexKey(ns), id.String()).Err(); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+		return nil, eh.EventStoreError{
+			Err: ErrEventNotFound,
+		}
+	} else if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	return s.decodeEvent(dbEvent)
+}
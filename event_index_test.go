@@ -0,0 +1,98 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadByEventID(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":        nil,
+		"watch":         {rediseventstore.WithWatchSave()},
+		"script outbox": {rediseventstore.WithOutboxStream("outbox")},
+		"watch outbox":  {rediseventstore.WithWatchSave(), rediseventstore.WithOutboxStream("outbox")},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, append(options, rediseventstore.WithEventIndex())...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if n := db.Exists(context.Background(), "eventid:ns").Val(); n != 0 {
+					t.Error("the event index should be cleared")
+				}
+			}()
+
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			for _, event := range events {
+				eventID := event.(interface{ EventID() uuid.UUID }).EventID()
+				if eventID == uuid.Nil {
+					t.Fatal("the event should have an event ID")
+				}
+
+				loaded, err := store.LoadByEventID(ctx, eventID)
+				if err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if loaded.AggregateID() != id || loaded.Version() != event.Version() {
+					t.Error("the event should be loaded:", loaded)
+				}
+				if loaded.Data().(*mocks.EventData).Content != event.Data().(*mocks.EventData).Content {
+					t.Error("the event data should be loaded:", loaded.Data())
+				}
+				if loaded.(interface{ EventID() uuid.UUID }).EventID() != eventID {
+					t.Error("the event ID should be stable across loads")
+				}
+			}
+
+			if _, err := store.LoadByEventID(ctx, uuid.New()); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+				t.Error("there should be an event not found error:", err)
+			}
+
+			// The index entries of expired aggregates are removed.
+			eventID := events[0].(interface{ EventID() uuid.UUID }).EventID()
+			db.Del(context.Background(), "ns:{"+id.String()+"}")
+			if _, err := store.LoadByEventID(ctx, eventID); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+				t.Error("there should be an event not found error:", err)
+			}
+			if db.HExists(context.Background(), "eventid:ns", eventID.String()).Val() {
+				t.Error("the stale index entry should be removed")
+			}
+		})
+	}
+}
+
+func TestEventStoreLoadByEventIDDisabled(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	if _, err := store.LoadByEventID(ctx, uuid.New()); !errors.Is(err, rediseventstore.ErrEventIndexDisabled) {
+		t.Error("there should be an event index disabled error:", err)
+	}
+}
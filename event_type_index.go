@@ -0,0 +1,154 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEventTypeIndexDisabled is when events are loaded by type without the
+// event type index.
+var ErrEventTypeIndexDisabled = errors.New("event type index is disabled")
+
+// eventTypeScanCount is the number of set members scanned per round trip by
+// LoadByEventType.
+const eventTypeScanCount = 100
+
+// WithEventTypeIndex indexes the saved events by event type, so that they can
+// be found with LoadByEventType without knowing the aggregate IDs. Every event
+// type has a set eventtype:{namespace}:{type} with the aggregate ID and
+// version of its events, written in the same atomic write as the events.
+//
+// The index costs one SADD and one set member per saved event, and renaming
+// or replacing events with another type moves their members. The index is not
+// supported on Redis Cluster, as the sets are in other slots than the
+// aggregates. Members of expired or compacted events are skipped on load.
+func WithEventTypeIndex() Option {
+	return func(s *EventStore) error {
+		s.eventTypeIndex = true
+
+		return nil
+	}
+}
+
+// LoadByEventType loads up to limit events of an event type from all
+// aggregates of the namespace, for example for debugging. The events are
+// returned in timestamp order. It requires WithEventTypeIndex.
+func (s *EventStore) LoadByEventType(ctx context.Context, t eh.EventType, limit int) ([]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadByEventType", namespaceAttribute.String(ns))
+	start := time.Now()
+	events, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) ([]eh.Event, error) {
+		return s.loadByEventType(ctx, ns, t, limit)
+	})
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("load_by_event_type", ns, len(events), start, err)
+
+	return events, err
+}
+
+// loadByEventType loads the events of an event type, see LoadByEventType.
+func (s *EventStore) loadByEventType(ctx context.Context, ns string, t eh.EventType, limit int) ([]eh.Event, error) {
+	if !s.eventTypeIndex {
+		return nil, eh.EventStoreError{
+			Err: ErrEventTypeIndexDisabled,
+		}
+	}
+	if limit <= 0 {
+		return nil, eh.EventStoreError{
+			BaseErr: fmt.Errorf("limit must be positive, got %d", limit),
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	var events []eh.Event
+	var cursor uint64
+	for {
+		values, next, err := s.client(ns).SScan(ctx, s.eventTypeIndexKey(ns, t), cursor, "", eventTypeScanCount).Result()
+		if err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+
+		batch, err := s.loadIndexedEvents(ctx, ns, values)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+
+		cursor = next
+		if cursor == 0 || len(events) >= limit {
+			break
+		}
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp().Before(events[j].Timestamp())
+	})
+
+	return events, nil
+}
+
+// loadIndexedEvents loads the events of event index values in one round trip,
+// skipping the events that no longer exist.
+func (s *EventStore) loadIndexedEvents(ctx context.Context, ns string, values []string) ([]eh.Event, error) {
+	cmds := make([]eventsCmd, len(values))
+	fields := make([]string, len(values))
+	_, err := s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, value := range values {
+			aggregateID, field, _ := strings.Cut(value, ":")
+			version, _ := strconv.Atoi(field)
+			fields[i] = field
+			cmds[i] = s.loadRange(ctx, pipe, s.aggregateKey(ns, aggregateID), version, version)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	events := make([]eh.Event, 0, len(values))
+	for i, cmd := range cmds {
+		dbEvents, err := cmd.events()
+		dbEvent, ok := dbEvents[fields[i]]
+		if err == nil && !ok {
+			continue
+		} else if err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+
+		e, err := s.decodeEvent(dbEvent)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// eventTypeIndexKey returns the key of the set indexing the events of an
+// event type in a namespace.
+func (s *EventStore) eventTypeIndexKey(ns string, t eh.EventType) string {
+	return fmt.Sprintf("%seventtype:%s:%s", s.keyPrefix, ns, t)
+}
@@ -0,0 +1,110 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadByEventType(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":            nil,
+		"watch":             {rediseventstore.WithWatchSave()},
+		"script sorted set": {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+		"script outbox":     {rediseventstore.WithOutboxStream("outbox")},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, append(options, rediseventstore.WithEventTypeIndex())...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if keys := db.Keys(context.Background(), "eventtype:ns:*").Val(); len(keys) != 0 {
+					t.Error("the event type index should be cleared:", keys)
+				}
+			}()
+
+			// Two aggregates with alternating event types.
+			for i := 0; i < 2; i++ {
+				id := uuid.New()
+				if err := store.Save(ctx, []eh.Event{
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, 1)),
+					eh.NewEvent(mocks.EventOtherType, &mocks.EventData{Content: "event2"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, 2)),
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, 3)),
+				}, 0); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			events, err := store.LoadByEventType(ctx, mocks.EventType, 10)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 4 {
+				t.Fatal("there should be 4 events:", len(events))
+			}
+			for i, e := range events {
+				if e.EventType() != mocks.EventType {
+					t.Error("the event should have the event type:", e.EventType())
+				}
+				if i > 0 && e.Timestamp().Before(events[i-1].Timestamp()) {
+					t.Error("the events should be in timestamp order")
+				}
+			}
+
+			events, err = store.LoadByEventType(ctx, mocks.EventType, 3)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 3 {
+				t.Error("the events should be limited:", len(events))
+			}
+
+			if _, err := store.LoadByEventType(ctx, mocks.EventType, 0); err == nil {
+				t.Error("there should be an error for a limit of 0")
+			}
+
+			if err := store.RenameEvent(ctx, mocks.EventOtherType, mocks.EventType); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			events, err = store.LoadByEventType(ctx, mocks.EventType, 10)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 6 {
+				t.Error("the renamed events should be indexed by the new type:", len(events))
+			}
+			events, err = store.LoadByEventType(ctx, mocks.EventOtherType, 10)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 0 {
+				t.Error("the renamed events should not be indexed by the old type:", len(events))
+			}
+		})
+	}
+}
+
+func TestEventStoreLoadByEventTypeDisabled(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	if _, err := store.LoadByEventType(ctx, mocks.EventType, 10); !errors.Is(err, rediseventstore.ErrEventTypeIndexDisabled) {
+		t.Error("there should be an event type index disabled error:", err)
+	}
+}
@@ -0,0 +1,401 @@
+package ehpg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCouldNotPublishEvent is when an event could not be published to the stream.
+var ErrCouldNotPublishEvent = errors.New("could not publish event")
+
+// ErrCouldNotReceiveEvents is when events could not be read from the stream.
+var ErrCouldNotReceiveEvents = errors.New("could not receive events")
+
+// ErrCouldNotAckEvent is when a handled event could not be acknowledged.
+var ErrCouldNotAckEvent = errors.New("could not acknowledge event")
+
+// EventBus is an eh.EventBus backed by a Redis Stream. Every handler reads the
+// stream in its own consumer group and acknowledges events it handled, so
+// events are delivered at least once. Events a handler failed, or that were
+// left pending by a crashed consumer, are reclaimed after a while.
+type EventBus struct {
+	db         redis.UniversalClient
+	appID      string
+	clientID   string
+	streamName string
+	encoder    Encoder
+	claimIdle  time.Duration
+
+	registered   map[eh.EventHandlerType]struct{}
+	registeredMu sync.RWMutex
+	errCh        chan eh.EventBusError
+	cctx         context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+var _ = eh.EventBus(&EventBus{})
+
+// EventBusOption is an option setter used to configure the event bus.
+type EventBusOption func(*EventBus) error
+
+// WithEventBusEncoder uses the encoder to marshal and unmarshal event data,
+// instead of the default JSON encoder.
+func WithEventBusEncoder(encoder Encoder) EventBusOption {
+	return func(b *EventBus) error {
+		if encoder == nil {
+			return fmt.Errorf("%w: encoder must not be nil", ErrInvalidOption)
+		}
+
+		b.encoder = encoder
+
+		return nil
+	}
+}
+
+// WithClaimIdleTime sets how long an event must be pending before another
+// consumer reclaims it, by default one minute.
+func WithClaimIdleTime(d time.Duration) EventBusOption {
+	return func(b *EventBus) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: claim idle time must be positive, got %s", ErrInvalidOption, d)
+		}
+
+		b.claimIdle = d
+
+		return nil
+	}
+}
+
+// NewEventBus creates an EventBus publishing to the stream {appID}_events.
+// The clientID names the consumer of this process in the consumer groups and
+// must be unique per process. The Redis client is not closed by the bus.
+func NewEventBus(db redis.UniversalClient, appID, clientID string, options ...EventBusOption) (*EventBus, error) {
+	if appID == "" {
+		return nil, fmt.Errorf("%w: app ID must not be empty", ErrInvalidOption)
+	}
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: client ID must not be empty", ErrInvalidOption)
+	}
+
+	b := &EventBus{
+		db:         db,
+		appID:      appID,
+		clientID:   clientID,
+		streamName: appID + "_events",
+		encoder:    NewJSONEncoder(),
+		claimIdle:  time.Minute,
+		registered: map[eh.EventHandlerType]struct{}{},
+		errCh:      make(chan eh.EventBusError, 100),
+	}
+
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, fmt.Errorf("error while applying option: %w", err)
+		}
+	}
+
+	if err := db.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+
+	b.cctx, b.cancel = context.WithCancel(context.Background())
+
+	return b, nil
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (b *EventBus) HandlerType() eh.EventHandlerType {
+	return "eventbus"
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface, publishing the event to the stream.
+func (b *EventBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	values, err := b.marshalEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if err := b.db.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.streamName,
+		Values: values,
+	}).Err(); err != nil {
+		return busError(ErrCouldNotPublishEvent, err)
+	}
+
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddHandler(ctx context.Context, m eh.EventMatcher, h eh.EventHandler) error {
+	if m == nil {
+		return eh.ErrMissingMatcher
+	}
+	if h == nil {
+		return eh.ErrMissingHandler
+	}
+
+	b.registeredMu.Lock()
+	defer b.registeredMu.Unlock()
+
+	if _, ok := b.registered[h.HandlerType()]; ok {
+		return eh.ErrHandlerAlreadyAdded
+	}
+
+	group := fmt.Sprintf("%s_%s", b.appID, h.HandlerType())
+	if err := b.createGroup(ctx, group); err != nil {
+		return err
+	}
+
+	b.registered[h.HandlerType()] = struct{}{}
+
+	b.wg.Add(1)
+	go b.handle(m, h, group)
+
+	return nil
+}
+
+// Errors implements the Errors method of the eventhorizon.EventBus interface.
+func (b *EventBus) Errors() <-chan eh.EventBusError {
+	return b.errCh
+}
+
+// Close stops all handlers and waits for them to finish.
+func (b *EventBus) Close() error {
+	b.cancel()
+	b.wg.Wait()
+
+	return nil
+}
+
+// createGroup creates the consumer group of a handler, starting at new events.
+func (b *EventBus) createGroup(ctx context.Context, group string) error {
+	err := b.db.XGroupCreateMkStream(ctx, b.streamName, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("could not create consumer group %s: %w", group, err)
+	}
+
+	return nil
+}
+
+// handle reads the stream in the consumer group of the handler until the bus
+// is closed, reconnecting after errors.
+func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, group string) {
+	defer b.wg.Done()
+
+	var lastClaim time.Time
+	for b.cctx.Err() == nil {
+		// Reclaim events left pending by failed handlers or crashed consumers.
+		if time.Since(lastClaim) >= b.claimIdle {
+			lastClaim = time.Now()
+			b.claimPending(m, h, group)
+		}
+
+		streams, err := b.db.XReadGroup(b.cctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.clientID,
+			Streams:  []string{b.streamName, ">"},
+			Count:    100,
+			Block:    time.Second,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			if b.cctx.Err() != nil {
+				return
+			}
+			b.sendErr(b.cctx, busError(ErrCouldNotReceiveEvents, err), nil)
+
+			// Back off before reconnecting, the group is gone if Redis
+			// restarted without persistence.
+			select {
+			case <-time.After(time.Second):
+			case <-b.cctx.Done():
+				return
+			}
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				if err := b.createGroup(b.cctx, group); err != nil {
+					b.sendErr(b.cctx, err, nil)
+				}
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				b.handleMessage(m, h, group, msg)
+			}
+		}
+	}
+}
+
+// claimPending claims and handles the events of the group that have been
+// pending for longer than the claim idle time.
+func (b *EventBus) claimPending(m eh.EventMatcher, h eh.EventHandler, group string) {
+	start := "0-0"
+	for b.cctx.Err() == nil {
+		msgs, next, err := b.db.XAutoClaim(b.cctx, &redis.XAutoClaimArgs{
+			Stream:   b.streamName,
+			Group:    group,
+			MinIdle:  b.claimIdle,
+			Start:    start,
+			Count:    100,
+			Consumer: b.clientID,
+		}).Result()
+		if err != nil {
+			if b.cctx.Err() == nil {
+				b.sendErr(b.cctx, busError(ErrCouldNotReceiveEvents, err), nil)
+			}
+			return
+		}
+
+		for _, msg := range msgs {
+			b.handleMessage(m, h, group, msg)
+		}
+
+		if next == "0-0" || len(msgs) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+// handleMessage handles a stream entry and acknowledges it when it was
+// handled, did not match the handler, or could not be decoded.
+func (b *EventBus) handleMessage(m eh.EventMatcher, h eh.EventHandler, group string, msg redis.XMessage) {
+	event, ctx, err := b.unmarshalEvent(b.cctx, msg.Values)
+	if err != nil {
+		// Entries that can't be decoded, like entries of event types not
+		// registered in this process, would fail again when reclaimed, so
+		// they are acknowledged after reporting the error.
+		b.sendErr(b.cctx, err, nil)
+		if err := b.db.XAck(b.cctx, b.streamName, group, msg.ID).Err(); err != nil {
+			b.sendErr(b.cctx, busError(ErrCouldNotAckEvent, err), nil)
+		}
+		return
+	}
+
+	if m.Match(event) {
+		if err := h.HandleEvent(ctx, event); err != nil {
+			// Leave the event pending, to be reclaimed and retried.
+			b.sendErr(ctx, fmt.Errorf("could not handle event (%s): %w", h.HandlerType(), err), event)
+			return
+		}
+	}
+
+	if err := b.db.XAck(b.cctx, b.streamName, group, msg.ID).Err(); err != nil {
+		b.sendErr(ctx, busError(ErrCouldNotAckEvent, err), event)
+	}
+}
+
+// eventBusError is an error of the event bus with the error causing it, which
+// is both the error and, when unwrapped, the cause.
+type eventBusError struct {
+	err   error
+	cause error
+}
+
+// busError returns the error of the event bus with the error causing it.
+func busError(err, cause error) error {
+	return eventBusError{err: err, cause: cause}
+}
+
+func (e eventBusError) Error() string {
+	return e.err.Error() + ": " + e.cause.Error()
+}
+
+func (e eventBusError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+func (e eventBusError) Unwrap() error {
+	return e.cause
+}
+
+// sendErr sends an error on the error channel, dropping it when the channel
+// is full.
+func (b *EventBus) sendErr(ctx context.Context, err error, event eh.Event) {
+	select {
+	case b.errCh <- eh.EventBusError{Err: err, Ctx: ctx, Event: event}:
+	default:
+	}
+}
+
+// marshalEvent returns the stream entry of an event.
+func (b *EventBus) marshalEvent(ctx context.Context, event eh.Event) (map[string]interface{}, error) {
+	data, err := b.encoder.Marshal(event.Data())
+	if err != nil {
+		return nil, busError(ErrCouldNotMarshalEvent, err)
+	}
+	metadata, err := json.Marshal(event.Metadata())
+	if err != nil {
+		return nil, busError(ErrCouldNotMarshalEvent, err)
+	}
+	rawCtx, err := json.Marshal(eh.MarshalContext(ctx))
+	if err != nil {
+		return nil, busError(ErrCouldNotMarshalEvent, err)
+	}
+
+	return map[string]interface{}{
+		"event_type":     event.EventType().String(),
+		"aggregate_type": event.AggregateType().String(),
+		"aggregate_id":   event.AggregateID().String(),
+		"version":        event.Version(),
+		"timestamp":      event.Timestamp().Format(time.RFC3339Nano),
+		"data":           data,
+		"metadata":       metadata,
+		"context":        rawCtx,
+	}, nil
+}
+
+// unmarshalEvent returns the event and context of a stream entry.
+func (b *EventBus) unmarshalEvent(ctx context.Context, values map[string]interface{}) (eh.Event, context.Context, error) {
+	field := func(name string) string {
+		s, _ := values[name].(string)
+		return s
+	}
+
+	id, err := uuid.Parse(field("aggregate_id"))
+	if err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+	version, err := strconv.Atoi(field("version"))
+	if err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, field("timestamp"))
+	if err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+
+	eventType := eh.EventType(field("event_type"))
+	data, err := b.encoder.Unmarshal(eventType, []byte(field("data")))
+	if err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(field("metadata")), &metadata); err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+	var vals map[string]interface{}
+	if err := json.Unmarshal([]byte(field("context")), &vals); err != nil {
+		return nil, nil, busError(ErrCouldNotUnmarshalEvent, err)
+	}
+
+	event := eh.NewEvent(eventType, data, timestamp,
+		eh.ForAggregate(eh.AggregateType(field("aggregate_type")), id, version),
+		eh.WithMetadata(metadata))
+
+	return event, eh.UnmarshalContext(ctx, vals), nil
+}
@@ -0,0 +1,236 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishedEventType is a second event type with registered event data, unlike
+// mocks.EventOtherType, so that the bus can decode its events.
+const publishedEventType eh.EventType = "PublishedEvent"
+
+func init() {
+	eh.RegisterEventData(publishedEventType, func() eh.EventData {
+		return &mocks.EventData{}
+	})
+}
+
+// recordingHandler records handled events, failing the first failures calls.
+type recordingHandler struct {
+	handlerType eh.EventHandlerType
+	failures    int
+
+	mu     sync.Mutex
+	events []eh.Event
+	calls  int
+}
+
+func (h *recordingHandler) HandlerType() eh.EventHandlerType {
+	return h.handlerType
+}
+
+func (h *recordingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("handler failure")
+	}
+	h.events = append(h.events, event)
+
+	return nil
+}
+
+func (h *recordingHandler) handled() []eh.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]eh.Event(nil), h.events...)
+}
+
+func newEventBus(t *testing.T, options ...rediseventstore.EventBusOption) (*rediseventstore.EventBus, redis.UniversalClient) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+	t.Cleanup(func() { db.Close() })
+
+	appID := "app-" + uuid.NewString()
+	t.Cleanup(func() { db.Del(context.Background(), appID+"_events") })
+
+	bus, err := rediseventstore.NewEventBus(db, appID, "client", options...)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	t.Cleanup(func() { bus.Close() })
+
+	return bus, db
+}
+
+func waitForEvents(t *testing.T, h *recordingHandler, n int) []eh.Event {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if events := h.handled(); len(events) >= n {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("there should be %d handled events: %d", n, len(h.handled()))
+
+	return nil
+}
+
+func TestEventBus(t *testing.T) {
+	bus, _ := newEventBus(t)
+	ctx := context.Background()
+
+	all := &recordingHandler{handlerType: "all"}
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, all); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	other := &recordingHandler{handlerType: "other"}
+	if err := bus.AddHandler(ctx, eh.MatchEvents{publishedEventType}, other); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, all); !errors.Is(err, eh.ErrHandlerAlreadyAdded) {
+		t.Error("there should be a handler already added error:", err)
+	}
+	if err := bus.AddHandler(ctx, nil, all); !errors.Is(err, eh.ErrMissingMatcher) {
+		t.Error("there should be a missing matcher error:", err)
+	}
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, nil); !errors.Is(err, eh.ErrMissingHandler) {
+		t.Error("there should be a missing handler error:", err)
+	}
+
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event1 := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, timestamp,
+		eh.ForAggregate(mocks.AggregateType, id, 1),
+		eh.WithMetadata(map[string]interface{}{"meta": "data"}))
+	event2 := eh.NewEvent(publishedEventType, &mocks.EventData{Content: "event2"}, timestamp,
+		eh.ForAggregate(mocks.AggregateType, id, 2))
+
+	for _, event := range []eh.Event{event1, event2} {
+		if err := bus.HandleEvent(ctx, event); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	events := waitForEvents(t, all, 2)
+	if events[0].EventType() != mocks.EventType || events[1].EventType() != publishedEventType {
+		t.Error("the events should be handled in order:", events)
+	}
+	if events[0].AggregateID() != id || events[0].Version() != 1 || !events[0].Timestamp().Equal(timestamp) {
+		t.Error("the event should be decoded:", events[0])
+	}
+	if data, ok := events[0].Data().(*mocks.EventData); !ok || data.Content != "event1" {
+		t.Error("the event data should be decoded:", events[0].Data())
+	}
+	if events[0].Metadata()["meta"] != "data" {
+		t.Error("the event metadata should be decoded:", events[0].Metadata())
+	}
+
+	events = waitForEvents(t, other, 1)
+	if len(events) != 1 || events[0].EventType() != publishedEventType {
+		t.Error("only the matching event should be handled:", events)
+	}
+}
+
+func TestEventBusReclaimsFailedEvents(t *testing.T) {
+	bus, _ := newEventBus(t, rediseventstore.WithClaimIdleTime(50*time.Millisecond))
+	ctx := context.Background()
+
+	h := &recordingHandler{handlerType: "failing", failures: 1}
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, h); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, uuid.New(), 1))
+	if err := bus.HandleEvent(ctx, event); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	select {
+	case err := <-bus.Errors():
+		if err.Event == nil || err.Event.Version() != 1 {
+			t.Error("the error should have the event:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("there should be a handler error")
+	}
+
+	// The failed event is left pending and handled again when reclaimed.
+	events := waitForEvents(t, h, 1)
+	if events[0].Version() != 1 {
+		t.Error("the failed event should be handled again:", events[0])
+	}
+}
+
+func TestEventBusAcksUndecodableEvents(t *testing.T) {
+	bus, _ := newEventBus(t, rediseventstore.WithClaimIdleTime(50*time.Millisecond))
+	ctx := context.Background()
+
+	h := &recordingHandler{handlerType: "undecodable"}
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, h); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The event type is not registered, so the event data can't be decoded.
+	if err := bus.HandleEvent(ctx, eh.NewEvent("UnregisteredEvent", &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, uuid.New(), 1))); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	select {
+	case err := <-bus.Errors():
+		if !errors.Is(err.Err, rediseventstore.ErrCouldNotUnmarshalEvent) {
+			t.Error("there should be an unmarshal error:", err)
+		}
+		if !errors.Is(err.Err, eh.ErrEventDataNotRegistered) {
+			t.Error("the error should have the cause:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("there should be an unmarshal error")
+	}
+
+	// The entry is acknowledged, so it is not reclaimed and reported again.
+	select {
+	case err := <-bus.Errors():
+		t.Error("the entry should not be reclaimed:", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, uuid.New(), 1))
+	if err := bus.HandleEvent(ctx, event); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	waitForEvents(t, h, 1)
+}
+
+func TestNewEventBusOptions(t *testing.T) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+	defer db.Close()
+
+	if _, err := rediseventstore.NewEventBus(db, "", "client"); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventBus(db, "app", ""); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventBus(db, "app", "client", rediseventstore.WithClaimIdleTime(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+}
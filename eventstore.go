@@ -1,16 +1,20 @@
 package ehpg
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis"
 	"github.com/google/uuid"
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,48 +33,200 @@ var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
 // ErrCouldNotSaveAggregate is when an aggregate could not be saved.
 var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 
+// ErrCouldNotLoadAggregate is when an aggregate could not be loaded.
+var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
+
+// ErrEventTooLarge is when the data of an event exceeds the maximum event size.
+var ErrEventTooLarge = errors.New("event too large")
+
+// ErrInvalidEventData is when event data is rejected by the schema validator.
+var ErrInvalidEventData = errors.New("invalid event data")
+
+// ErrBatchTooLarge is when a save has more events than the maximum batch size.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// ErrNamespaceNotAllowed is when the namespace of the context is not in the
+// namespace allowlist.
+var ErrNamespaceNotAllowed = errors.New("namespace not allowed")
+
+// ErrCouldNotPing is when Redis could not be reached.
+var ErrCouldNotPing = errors.New("could not ping redis")
+
 // EventStore implements an eh.EventStore for PostgreSQL.
 type EventStore struct {
-	db      redis.UniversalClient
-	encoder Encoder
+	db           redis.UniversalClient
+	encoder      Encoder
+	keyPrefix    string
+	eventTTL     time.Duration
+	watchSave    bool
+	compression  Compression
+	closeOnce    sync.Once
+	sharedClient bool
+	outboxStream string
+	tracer       Tracer
+	metrics      *metrics
+
+	operationTimeout time.Duration
+	upcasters        []Upcaster
+	cipher           Cipher
+	ciphers          map[string]Cipher
+	encryptMetadata  bool
+	saveRetries      int
+	saveRetryDelay   time.Duration
+	eventIndex       bool
+	maxEventSize     int
+	maxSaveBatch     int
+	reconnectRetry   bool
+	schemaValidator  func(eh.EventType, json.RawMessage) error
+	keyBuilder       func(ns, id string) string
+	logger           Logger
+	globalLog        bool
+	eventTypeIndex   bool
+	lenientLoad      bool
+	writableCheck    bool
+	readOnly         int32
+	retainSnapshots  int
+	clearBatchSize   int64
+	namespaceDB      func(ns string) int
+	versionField     bool
+	afterSave        func(ctx context.Context, events []eh.Event)
+	dbClients        map[int]*redis.Client
+	dbClientsMu      sync.Mutex
+	noUnlink         int32
+	clock            func() time.Time
+	uuidFunc         func() uuid.UUID
+	namespaces       map[string]struct{}
+	storageMode      StorageMode
+	idempotentSave   bool
+	metadataEncoder  MetadataEncoder
+	legacyNames      bool
+	backoff          Backoff
+	contextMetadata  func(context.Context) map[string]interface{}
+	snapshotEncoder  SnapshotEncoder
+	readOnlyRetries  int
+	strictLoad       bool
+	payloadDedup     bool
+	commandTimeout   time.Duration
 }
 
 var _ = eh.EventStore(&EventStore{})
 
+// AggregateRecord is the current version of an aggregate, which is stored
+// next to its events and updated in the same write. Saves, Compact and
+// Version read the version from the record with a single GET, instead of
+// counting the events, except for the aggregates saved before records were
+// added. All stores of a keyspace must write the records, as a save of a store
+// without them leaves a stale record failing later saves with a version
+// conflict.
 type AggregateRecord struct {
 	Namespace   string
 	AggregateID uuid.UUID
 	Version     int
 }
 
+func (a AggregateRecord) MarshalBinary() (data []byte, err error) {
+	return json.Marshal(a)
+}
+
+func (a *AggregateRecord) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, a)
+}
+
 type AggregateEvent struct {
-	EventID       uuid.UUID
-	Namespace     string
-	AggregateID   uuid.UUID
-	AggregateType eh.AggregateType
-	EventType     eh.EventType
-	RawEventData  json.RawMessage
-	Timestamp     time.Time
-	Version       int
-	MetaData      map[string]interface{}
+	EventID       uuid.UUID              `json:"id"`
+	Namespace     string                 `json:"ns"`
+	AggregateID   uuid.UUID              `json:"aid"`
+	AggregateType eh.AggregateType       `json:"at"`
+	EventType     eh.EventType           `json:"et"`
+	RawEventData  json.RawMessage        `json:"d,omitempty"`
+	Timestamp     time.Time              `json:"ts"`
+	Version       int                    `json:"v"`
+	MetaData      map[string]interface{} `json:"m,omitempty"`
 	data          eh.EventData
-	RawMetaData   json.RawMessage
+	RawMetaData   json.RawMessage `json:"rm"`
+	// BinaryEventData holds compressed event data and event data of encoders
+	// not producing JSON, prefixed with the Compression codec byte.
+	BinaryEventData []byte `json:"bd,omitempty"`
+	// BinaryMetaData holds encrypted meta data, instead of RawMetaData.
+	BinaryMetaData []byte `json:"bm,omitempty"`
+	// EncodedMetaData holds the meta data of a MetadataEncoder not producing
+	// JSON, instead of RawMetaData.
+	EncodedMetaData []byte `json:"em,omitempty"`
+	// MetaDataEncoding is the name of the MetadataEncoder of binary meta data,
+	// which is empty for JSON.
+	MetaDataEncoding string `json:"me,omitempty"`
+	// EncryptionKeyID is the key of the cipher the binary data is encrypted with.
+	EncryptionKeyID string `json:"k,omitempty"`
+	// PayloadHash is the hash of the encoded event data of WithPayloadDedup.
+	PayloadHash string `json:"ph,omitempty"`
+	// PayloadRef is the version of the event holding the event data of an
+	// event deduplicated by WithPayloadDedup, which has no event data itself.
+	PayloadRef int `json:"pr,omitempty"`
+	// payload is the stored event data of a deduplicated event, for the
+	// outbox stream.
+	payload []byte
+	// legacyNames marshals the event with the field names of legacyEvent, see
+	// WithLegacyFieldNames.
+	legacyNames bool
 }
 
 func (a AggregateEvent) MarshalBinary() (data []byte, err error) {
-	return json.Marshal(a)
+	// The stored event is not embedded in HTML, so it is not HTML escaped,
+	// which keeps event data marshaled without HTML escaping as is.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	var v interface{} = shortEvent(a)
+	if a.legacyNames {
+		v = legacyEvent(a)
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 func (a *AggregateEvent) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, a)
 }
 
+// storedEventData returns the event data as stored, either JSON or binary
+// data prefixed with the compression codec byte.
+func (a AggregateEvent) storedEventData() []byte {
+	if a.payload != nil {
+		return a.payload
+	}
+	if a.BinaryEventData != nil {
+		return a.BinaryEventData
+	}
+	return a.RawEventData
+}
+
+// versionedEvent is an event record with the hash field of its version.
+type versionedEvent struct {
+	field string
+	event AggregateEvent
+}
+
 // NewUUID for mocking in tests
+//
+// Deprecated: Use WithUUIDFunc, as mutating the package variable races with
+// tests running in parallel. Stores without WithUUIDFunc still use NewUUID.
 var NewUUID = uuid.New
 
+// newEventID returns a new event ID from the generator of WithUUIDFunc, or
+// NewUUID by default.
+func (s *EventStore) newEventID() uuid.UUID {
+	if s.uuidFunc != nil {
+		return s.uuidFunc()
+	}
+	return NewUUID()
+}
+
 // newDBEvent returns a new dbEvent for an event.
 func (s *EventStore) newDBEvent(ctx context.Context, event eh.Event) (*AggregateEvent, error) {
-	ns := namespace.FromContext(ctx)
+	ns := namespaceFromContext(ctx)
 
 	// Marshal event data if there is any.
 	rawEventData, err := s.encoder.Marshal(event.Data())
@@ -81,8 +237,31 @@ func (s *EventStore) newDBEvent(ctx context.Context, event eh.Event) (*Aggregate
 		}
 	}
 
+	if s.maxEventSize > 0 && len(rawEventData) > s.maxEventSize {
+		return nil, eh.EventStoreError{
+			BaseErr: fmt.Errorf("data of %s event %s@%d is %d bytes, the maximum is %d bytes",
+				event.EventType(), event.AggregateID(), event.Version(), len(rawEventData), s.maxEventSize),
+			Err: ErrEventTooLarge,
+		}
+	}
+
+	if s.schemaValidator != nil && rawEventData != nil {
+		if err := s.schemaValidator(event.EventType(), rawEventData); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: fmt.Errorf("data of %s event %s@%d: %w",
+					event.EventType(), event.AggregateID(), event.Version(), err),
+				Err: ErrInvalidEventData,
+			}
+		}
+	}
+
+	metadata := event.Metadata()
+	if s.contextMetadata != nil {
+		metadata = mergeMetadata(s.contextMetadata(ctx), metadata)
+	}
+
 	// Marshal meta data if there is any.
-	rawMetaData, err := json.Marshal(event.Metadata())
+	rawMetaData, err := s.metadataEncoder.Marshal(metadata)
 	if err != nil {
 		return nil, eh.EventStoreError{
 			BaseErr: err,
@@ -90,29 +269,154 @@ func (s *EventStore) newDBEvent(ctx context.Context, event eh.Event) (*Aggregate
 		}
 	}
 
-	return &AggregateEvent{
-		EventID:       NewUUID(),
+	eventID := s.newEventID()
+	if e, ok := event.(eventIDer); ok && s.idempotentSave && e.EventID() != uuid.Nil {
+		eventID = e.EventID()
+	}
+
+	e := &AggregateEvent{
+		EventID:       eventID,
 		AggregateID:   event.AggregateID(),
 		AggregateType: event.AggregateType(),
 		EventType:     event.EventType(),
 		Version:       event.Version(),
 		Timestamp:     event.Timestamp(),
 		Namespace:     ns,
-		RawEventData:  rawEventData,
 		RawMetaData:   rawMetaData,
-	}, nil
+		legacyNames:   s.legacyNames,
+	}
+	if s.metadataEncoder.String() != "json" {
+		e.RawMetaData = nil
+		e.EncodedMetaData = rawMetaData
+		e.MetaDataEncoding = s.metadataEncoder.String()
+	}
+
+	if s.cipher != nil && s.encryptMetadata {
+		if e.BinaryMetaData, err = s.encrypt(rawMetaData); err != nil {
+			return nil, err
+		}
+		e.RawMetaData = nil
+		e.EncodedMetaData = nil
+		e.EncryptionKeyID = s.cipher.KeyID()
+	}
+
+	if s.payloadDedup && rawEventData != nil {
+		e.PayloadHash = payloadHash(rawEventData)
+	}
+
+	// Uncompressed JSON event data is embedded as is, compressed or encrypted
+	// event data and other encodings are stored as binary.
+	if rawEventData == nil {
+		return e, nil
+	} else if s.encoder.String() == "json" && s.compression == NoCompression && s.cipher == nil {
+		e.RawEventData = rawEventData
+	} else if e.BinaryEventData, err = s.compression.compress(rawEventData); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotMarshalEvent,
+		}
+	}
+
+	// Encrypt the compressed data, including the codec byte.
+	if e.BinaryEventData != nil && s.cipher != nil {
+		if e.BinaryEventData, err = s.encrypt(e.BinaryEventData); err != nil {
+			return nil, err
+		}
+		e.EncryptionKeyID = s.cipher.KeyID()
+	}
+
+	return e, nil
 }
 
-// NewEventStore creates a new EventStore.
-func NewEventStore(db redis.UniversalClient) (*EventStore, error) {
+// mergeMetadata returns the meta data of the context with the meta data of
+// the event, which is kept for keys in both.
+func mergeMetadata(contextMetadata, eventMetadata map[string]interface{}) map[string]interface{} {
+	if len(contextMetadata) == 0 {
+		return eventMetadata
+	}
 
-	if response := db.Ping(); response.Err() != nil {
-		return nil, response.Err()
+	metadata := make(map[string]interface{}, len(contextMetadata)+len(eventMetadata))
+	for k, v := range contextMetadata {
+		metadata[k] = v
 	}
+	for k, v := range eventMetadata {
+		metadata[k] = v
+	}
+	return metadata
+}
 
+// NewEventStore creates a new EventStore. It pings Redis, and returns
+// ErrAuthenticationFailed when Redis rejects the credentials of the client,
+// like a wrong password or an unknown ACL username.
+func NewEventStore(db redis.UniversalClient, options ...Option) (*EventStore, error) {
 	s := &EventStore{
-		db:      db,
-		encoder: &jsonEncoder{},
+		db:              db,
+		encoder:         NewJSONEncoder(),
+		metadataEncoder: NewJSONMetadataEncoder(),
+		snapshotEncoder: NewJSONSnapshotEncoder(),
+		keyBuilder:      defaultKeyBuilder,
+		clock:           time.Now,
+		retainSnapshots: 1,
+		clearBatchSize:  clearBatchSize,
+	}
+
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, fmt.Errorf("error while applying option: %w", err)
+		}
+	}
+
+	if s.encryptMetadata && s.cipher == nil {
+		return nil, fmt.Errorf("%w: metadata encryption requires encryption", ErrInvalidOption)
+	}
+	if s.payloadDedup && s.cipher != nil {
+		return nil, fmt.Errorf("%w: payload deduplication is not supported with encryption", ErrInvalidOption)
+	}
+
+	// The outbox stream, event index, global log and event type index of a
+	// namespace are in another slot than the aggregates.
+	if _, ok := db.(*redis.ClusterClient); ok && s.outboxStream != "" {
+		return nil, fmt.Errorf("%w: outbox streams are not supported on Redis Cluster", ErrInvalidOption)
+	}
+	if _, ok := db.(*redis.ClusterClient); ok && s.eventIndex {
+		return nil, fmt.Errorf("%w: the event index is not supported on Redis Cluster", ErrInvalidOption)
+	}
+	if _, ok := db.(*redis.ClusterClient); ok && s.globalLog {
+		return nil, fmt.Errorf("%w: the global log is not supported on Redis Cluster", ErrInvalidOption)
+	}
+	if _, ok := db.(*redis.ClusterClient); ok && s.eventTypeIndex {
+		return nil, fmt.Errorf("%w: the event type index is not supported on Redis Cluster", ErrInvalidOption)
+	}
+	// The scripts of KeyPerEventStorage build the event keys from the
+	// aggregate key, which are only in its slot when the id is the hash tag.
+	if _, ok := db.(*redis.ClusterClient); ok && s.storageMode == KeyPerEventStorage && hashTag(s.aggregateKey("ns", "id")) != "id" {
+		return nil, fmt.Errorf("%w: a key per event requires keys with the id as hash tag on Redis Cluster", ErrInvalidOption)
+	}
+	if s.schemaValidator != nil && s.encoder.String() != "json" {
+		return nil, fmt.Errorf("%w: schema validation requires the JSON encoder", ErrInvalidOption)
+	}
+	if s.versionField && s.storageMode != HashStorage {
+		return nil, fmt.Errorf("%w: the version field requires hash storage", ErrInvalidOption)
+	}
+	if s.eventTTL > 0 && s.storageMode == KeyPerEventStorage {
+		return nil, fmt.Errorf("%w: the event TTL is not supported with a key per event", ErrInvalidOption)
+	}
+	if _, ok := db.(*redis.Client); !ok && s.namespaceDB != nil {
+		return nil, fmt.Errorf("%w: namespace databases require a *redis.Client, as SELECT is not allowed on Redis Cluster", ErrInvalidOption)
+	}
+
+	if err := db.Ping(context.Background()).Err(); isAuthError(err) {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrAuthenticationFailed,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if s.writableCheck {
+		if err := s.CheckWritable(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 
 	return s, nil
@@ -120,20 +424,61 @@ func NewEventStore(db redis.UniversalClient) (*EventStore, error) {
 
 // Save implements the Save method of the eventhorizon.EventStore interface.
 func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
-	ns := namespace.FromContext(ctx)
+	attrs := []Attribute{
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		eventCountAttribute.Int(len(events)),
+	}
+	var aggregateID uuid.UUID
+	if len(events) > 0 {
+		aggregateID = events[0].AggregateID()
+		attrs = append(attrs, aggregateIDAttribute.String(aggregateID.String()))
+	}
+	ctx, span := s.startSpan(ctx, "Save", attrs...)
+	start := time.Now()
+	_, err := withTimeout(ctx, s, ErrCouldNotSaveAggregate, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.save(ctx, events, originalVersion)
+	})
+	err = withOperation(err, "save", namespaceFromContext(ctx), aggregateID)
+	span.end(err)
+	s.metrics.observeSave(namespaceFromContext(ctx), len(events), start, err)
+	if err == nil && s.afterSave != nil {
+		s.afterSave(ctx, events)
+	}
+	if err != nil {
+		s.logError(err, "could not save events",
+			"namespace", namespaceFromContext(ctx),
+			"aggregate_id", aggregateID,
+			"version", originalVersion,
+			"event_count", len(events))
+	}
+
+	return err
+}
+
+// SaveWithVersion saves the events like Save, returning the version of the
+// aggregate after the save, which is the version of the last event, for
+// example to return it to the client of a command.
+func (s *EventStore) SaveWithVersion(ctx context.Context, events []eh.Event, originalVersion int) (int, error) {
+	if err := s.Save(ctx, events, originalVersion); err != nil {
+		return 0, err
+	}
+
+	return events[len(events)-1].Version(), nil
+}
 
+// ValidateBatch checks the events like Save does before writing, without
+// calling Redis: there must be events, all of the same aggregate, with
+// contiguous versions starting after the original version. An incorrect
+// version is reported with the expected and the actual version.
+func ValidateBatch(events []eh.Event, originalVersion int) error {
 	if len(events) == 0 {
 		return eh.EventStoreError{
 			Err: eh.ErrNoEventsToAppend,
 		}
 	}
 
-	// Build all event records, with incrementing versions starting from the
-	// original aggregate version.
-	dbEvents := make(map[string]interface{})
 	aggregateID := events[0].AggregateID()
-	version := originalVersion
-	for _, event := range events {
+	for i, event := range events {
 		// Only accept events belonging to the same aggregate.
 		if event.AggregateID() != aggregateID {
 			return eh.EventStoreError{
@@ -142,34 +487,108 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		}
 
 		// Only accept events that apply to the correct aggregate version.
-		if event.Version() != version+1 {
+		if event.Version() != originalVersion+i+1 {
 			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("event %d of the batch has version %d, expected version %d after original version %d",
+					i, event.Version(), originalVersion+i+1, originalVersion),
 				Err: eh.ErrIncorrectEventVersion,
 			}
 		}
+	}
+
+	return nil
+}
+
+// save saves the events, see Save.
+func (s *EventStore) save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	ns := namespaceFromContext(ctx)
 
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+	if err := ValidateBatch(events, originalVersion); err != nil {
+		return err
+	}
+	if err := s.checkBatchSize(len(events)); err != nil {
+		return err
+	}
+
+	// Build all event records, with incrementing versions starting from the
+	// original aggregate version. The records are kept in version order so
+	// that they are also written in version order.
+	dbEvents := make([]versionedEvent, 0, len(events))
+	for _, event := range events {
 		// Create the event record for the DB.
 		e, err := s.newDBEvent(ctx, event)
 		if err != nil {
 			return err
 		}
-		dbEvents[strconv.Itoa(event.Version())] = *e
-		version++
+		dbEvents = append(dbEvents, versionedEvent{
+			field: strconv.Itoa(event.Version()),
+			event: *e,
+		})
 	}
 
-	err := s.db.Watch(func(tx *redis.Tx) error {
-		for version, event := range dbEvents {
-			if result := tx.HSetNX(fmt.Sprintf("%s:%s", ns, aggregateID), version, event); result.Val() == false {
-				return eh.EventStoreError{
-					BaseErr: result.Err(),
-					Err:     ErrVersionConflict,
-				}
-			}
+	if s.payloadDedup {
+		if err := s.dedupPayloads(ctx, ns, originalVersion, dbEvents); err != nil {
+			return err
 		}
-		return nil
-	}, fmt.Sprintf("%s:%s", ns, aggregateID))
+	}
 
-	if err != nil {
+	return s.saveDBEvents(ctx, ns, originalVersion, 0, dbEvents)
+}
+
+// checkBatchSize returns ErrBatchTooLarge when a save of n events exceeds the
+// maximum batch size of WithMaxSaveBatch.
+func (s *EventStore) checkBatchSize(n int) error {
+	if s.maxSaveBatch > 0 && n > s.maxSaveBatch {
+		return eh.EventStoreError{
+			BaseErr: fmt.Errorf("%d events exceed the maximum batch size of %d events", n, s.maxSaveBatch),
+			Err:     ErrBatchTooLarge,
+		}
+	}
+
+	return nil
+}
+
+// saveDBEvents writes the event records of an aggregate in version order,
+// checking that the stored version is the original version. When compacted is
+// the original version, a new aggregate is saved too, with the versions up to
+// it stored as compacted, for imports of compacted aggregates.
+func (s *EventStore) saveDBEvents(ctx context.Context, ns string, originalVersion, compacted int, dbEvents []versionedEvent) error {
+	aggregateID := dbEvents[0].event.AggregateID
+	key := s.aggregateKey(ns, aggregateID)
+	record := AggregateRecord{
+		Namespace:   ns,
+		AggregateID: aggregateID,
+		Version:     originalVersion + len(dbEvents),
+	}
+
+	write := func() error {
+		if s.watchSave {
+			return s.saveWatch(ctx, ns, key, originalVersion, compacted, record, dbEvents)
+		}
+		return s.saveScript(ctx, ns, key, originalVersion, compacted, record, dbEvents)
+	}
+	err := s.retryReadOnly(ctx, func() error {
+		return s.retrySave(ctx, func() error {
+			err := write()
+			if err == errPayloadOriginChanged {
+				// The event holding the deduplicated event data was compacted
+				// or replaced since dedupPayloads read it.
+				s.keepPayloads(originalVersion, dbEvents)
+				err = write()
+			}
+			return err
+		})
+	})
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) && storeErr.Err == ErrRedisReadOnly {
+		return storeErr
+	} else if err != nil && !s.replayed(ctx, ns, key, dbEvents, err) {
 		return eh.EventStoreError{
 			BaseErr: err,
 			Err:     ErrCouldNotSaveAggregate,
@@ -179,80 +598,1012 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 	return nil
 }
 
-// Load implements the Load method of the eventhorizon.EventStore interface.
-func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
-	ns := namespace.FromContext(ctx)
-	cmd := s.db.HGetAll(fmt.Sprintf("%s:%s", ns, id.String()))
-	var events []eh.Event
+// saveScript writes the events with a Lua script, which checks all versions
+// and writes all events atomically on the server.
+func (s *EventStore) saveScript(ctx context.Context, ns, key string, originalVersion, compacted int, record AggregateRecord, dbEvents []versionedEvent) error {
+	keys := []string{key, s.recordKey(ns, record.AggregateID), s.compactedKey(ns, record.AggregateID)}
+	extended := s.outboxStream != "" || s.eventIndex || s.globalLog || s.eventTypeIndex
+	if extended {
+		outboxKey, eventIndexKey, globalLogKey := "", "", ""
+		if s.outboxStream != "" {
+			outboxKey = s.outboxKey(ns)
+		}
+		if s.eventIndex {
+			eventIndexKey = s.eventIndexKey(ns)
+		}
+		if s.globalLog {
+			globalLogKey = s.globalLogKey(ns)
+		}
+		keys = append(keys, outboxKey, eventIndexKey, globalLogKey)
+	}
+	if s.eventTypeIndex {
+		for _, e := range dbEvents {
+			keys = append(keys, s.eventTypeIndexKey(ns, e.event.EventType))
+		}
+	}
 
-	for _, dbEvent := range cmd.Val() {
-		e := AggregateEvent{}
+	origin, hash := payloadOrigin(originalVersion, dbEvents)
+	args := make([]interface{}, 0, 6+2*len(dbEvents))
+	args = append(args, s.eventTTL.Milliseconds(), originalVersion, record, compacted, origin, hash)
+	for _, e := range dbEvents {
+		args = append(args, e.field, e.event)
+		if extended {
+			args = append(args,
+				e.event.AggregateID.String(),
+				e.event.EventType.String(),
+				e.event.storedEventData(),
+				e.event.EventID.String(),
+				eventIndexValue(e.event))
+		}
+	}
 
-		if err := json.Unmarshal([]byte(dbEvent), &e); err != nil {
-			return nil, eh.EventStoreError{
-				BaseErr: err,
-				Err:     ErrCouldNotUnmarshalEvent,
+	res, err := s.eventsScript().Run(ctx, s.client(ns), keys, args...).Result()
+	if err != nil {
+		return err
+	}
+	conflict, ok := res.(int64)
+	if !ok {
+		return errPayloadOriginChanged
+	}
+	if conflict < 0 {
+		return eh.EventStoreError{
+			BaseErr: fmt.Errorf("original version %d does not match stored version %d", originalVersion, -conflict-1),
+			Err:     ErrVersionConflict,
+		}
+	} else if conflict != 0 {
+		return eh.EventStoreError{
+			BaseErr: fmt.Errorf("version %d already exists", conflict),
+			Err:     ErrVersionConflict,
+		}
+	}
+
+	return nil
+}
+
+// saveWatch writes the events in an optimistic WATCH/MULTI/EXEC transaction.
+func (s *EventStore) saveWatch(ctx context.Context, ns, key string, originalVersion, compacted int, record AggregateRecord, dbEvents []versionedEvent) error {
+	return s.client(ns).Watch(ctx, func(tx commands) error {
+		// Check that the stored version is the original version and that none
+		// of the versions are taken before writing, the WATCH aborts the write
+		// if the aggregate is changed in the meantime.
+		stored, err := s.storedVersion(ctx, tx, ns, record.AggregateID, key)
+		if err != nil {
+			return err
+		}
+		newCompacted := stored == 0 && compacted > 0 && compacted == originalVersion
+		if stored != originalVersion && !newCompacted {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("original version %d does not match stored version %d", originalVersion, stored),
+				Err:     ErrVersionConflict,
 			}
 		}
 
-		if e.RawEventData != nil {
-			if eventData, err := s.encoder.Unmarshal(e.EventType, e.RawEventData); err != nil {
-				return nil, eh.EventStoreError{
-					BaseErr: err,
-					Err:     ErrCouldNotUnmarshalEvent,
+		existing, err := s.loadRange(ctx, tx, key, originalVersion+1, record.Version).events()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return eh.EventStoreError{
+				Err: ErrVersionConflict,
+			}
+		}
+		if err := s.checkPayloadOrigin(ctx, tx, key, originalVersion, dbEvents); err != nil {
+			return err
+		}
+
+		// Write all events in a single MULTI/EXEC round trip.
+		added := make([]func() bool, 0, len(dbEvents))
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, e := range dbEvents {
+				added = append(added, s.addEvent(ctx, pipe, key, e))
+				if s.outboxStream != "" {
+					pipe.XAdd(ctx, &redis.XAddArgs{
+						Stream: s.outboxKey(ns),
+						Values: outboxValues(e.event),
+					})
+				}
+				if s.eventIndex {
+					pipe.HSet(ctx, s.eventIndexKey(ns), e.event.EventID.String(), eventIndexValue(e.event))
+				}
+				if s.globalLog {
+					pipe.XAdd(ctx, &redis.XAddArgs{
+						Stream: s.globalLogKey(ns),
+						Values: globalLogValues(e.event),
+					})
 				}
-			} else {
-				e.data = eventData
+				if s.eventTypeIndex {
+					pipe.SAdd(ctx, s.eventTypeIndexKey(ns, e.event.EventType), eventIndexValue(e.event))
+				}
+			}
+
+			if newCompacted {
+				pipe.Set(ctx, s.compactedKey(ns, record.AggregateID), compacted, s.eventTTL)
+			}
+			if s.versionField {
+				pipe.HSet(ctx, key, versionField, record.Version)
 			}
+			pipe.Set(ctx, s.recordKey(ns, record.AggregateID), record, s.eventTTL)
+
+			// Slide the expiry forward on every save.
+			if s.eventTTL > 0 {
+				pipe.PExpire(ctx, key, s.eventTTL)
+				pipe.PExpire(ctx, s.compactedKey(ns, record.AggregateID), s.eventTTL)
+			}
+
+			return nil
+		})
+		if err != nil {
+			// An aborted transaction is retried by retrySave.
+			return err
 		}
-		e.RawEventData = nil
 
-		if e.RawMetaData != nil {
-			if err := json.Unmarshal(e.RawMetaData, &e.MetaData); err != nil {
-				return nil, eh.EventStoreError{
-					BaseErr: err,
-					Err:     ErrCouldNotUnmarshalEvent,
+		for i, ok := range added {
+			if !ok() {
+				return eh.EventStoreError{
+					BaseErr: fmt.Errorf("version %s already exists", dbEvents[i].field),
+					Err:     ErrVersionConflict,
 				}
 			}
 		}
-		e.RawEventData = nil
 
-		events = append(events, event{
-			AggregateEvent: e,
+		return nil
+	}, key, s.compactedKey(ns, record.AggregateID), s.recordKey(ns, record.AggregateID))
+}
+
+// saveEventsScript sets the fields of the hash KEYS[1] from the field/value
+// pairs in ARGV[7:] unless any of the fields exist, sets the aggregate record KEYS[2] to
+// ARGV[3], and slides the expiry forward when ARGV[1] is a positive number of
+// milliseconds. It returns the first existing version, or 0 when all events
+// were written. When the stored version, the version of the aggregate record,
+// or without a record the number of stored events plus the number of
+// compacted events in KEYS[3], is not the original version in ARGV[2] nothing
+// is written and it returns the negated stored version minus one. A new
+// aggregate is written at the original version too when ARGV[4] is the
+// original version, setting the compacted events to it. When ARGV[5] is the
+// version of the event holding the event data of deduplicated events, nothing
+// is written and it returns "origin" unless that event has the payload hash in
+// ARGV[6]. The scripts define the version, fieldVersion, setVersion, exists,
+// get and add functions of their data type.
+//
+// With an outbox stream as KEYS[4], an event index as KEYS[5] or a global log
+// as KEYS[6], of which the unused ones are empty strings, each field/value
+// pair is followed by the aggregate ID, event type, event data, event ID and
+// event index value. The events are added to the outbox stream, the event
+// index and the global log. With an event type index, KEYS[7:] are the event
+// type index sets of the events, to which the event index values are added.
+var saveEventsScript = redis.NewScript(`
+local function version(key, compactedKey)
+	return redis.call("HLEN", key) + (tonumber(redis.call("GET", compactedKey)) or 0)
+end
+local function fieldVersion(key)
+	return nil
+end
+local function setVersion(key, version)
+end
+local function exists(key, version)
+	return redis.call("HEXISTS", key, version) == 1
+end
+local function get(key, version)
+	return redis.call("HGET", key, version)
+end
+local function add(key, version, event)
+	redis.call("HSET", key, version, event)
+end
+` + saveEventsLua)
+
+// saveSortedSetEventsScript is saveEventsScript for the sorted sets of
+// SortedSetStorage, adding the events with the version as score.
+var saveSortedSetEventsScript = redis.NewScript(`
+local function version(key, compactedKey)
+	return redis.call("ZCARD", key) + (tonumber(redis.call("GET", compactedKey)) or 0)
+end
+local function fieldVersion(key)
+	return nil
+end
+local function setVersion(key, version)
+end
+local function exists(key, version)
+	return redis.call("ZCOUNT", key, version, version) > 0
+end
+local function get(key, version)
+	return redis.call("ZRANGEBYSCORE", key, version, version)[1]
+end
+local function add(key, version, event)
+	redis.call("ZADD", key, version, event)
+end
+` + saveEventsLua)
+
+// saveKeyPerEventScript is saveEventsScript for KeyPerEventStorage, setting
+// the event keys of the versions and counting the stored events in KEYS[1].
+var saveKeyPerEventScript = redis.NewScript(`
+local function version(key, compactedKey)
+	return (tonumber(redis.call("GET", key)) or 0) + (tonumber(redis.call("GET", compactedKey)) or 0)
+end
+local function fieldVersion(key)
+	return nil
+end
+local function setVersion(key, version)
+end
+local function exists(key, version)
+	return redis.call("EXISTS", key .. ":" .. version) == 1
+end
+local function get(key, version)
+	return redis.call("GET", key .. ":" .. version)
+end
+local function add(key, version, event)
+	redis.call("SET", key .. ":" .. version, event)
+	redis.call("INCR", key)
+end
+` + saveEventsLua)
+
+// saveVersionFieldEventsScript is saveEventsScript for WithVersionField,
+// checking and updating the version field of the hash. Hashes without the
+// field are checked like saveEventsScript.
+var saveVersionFieldEventsScript = redis.NewScript(`
+local function version(key, compactedKey)
+	return redis.call("HLEN", key) + (tonumber(redis.call("GET", compactedKey)) or 0)
+end
+local function fieldVersion(key)
+	return tonumber(redis.call("HGET", key, "` + versionField + `"))
+end
+local function setVersion(key, version)
+	redis.call("HSET", key, "` + versionField + `", version)
+end
+local function exists(key, version)
+	return redis.call("HEXISTS", key, version) == 1
+end
+local function get(key, version)
+	return redis.call("HGET", key, version)
+end
+local function add(key, version, event)
+	redis.call("HSET", key, version, event)
+end
+` + saveEventsLua)
+
+// saveEventsLua is the body of the save scripts, see saveEventsScript.
+const saveEventsLua = `
+local step = 2
+if #KEYS > 3 then
+	step = 7
+end
+local stored = fieldVersion(KEYS[1])
+if not stored then
+	local record = redis.call("GET", KEYS[2])
+	if record then
+		stored = cjson.decode(record).Version
+	else
+		stored = version(KEYS[1], KEYS[3])
+	end
+end
+local compacted = tonumber(ARGV[4])
+if stored ~= tonumber(ARGV[2]) then
+	if stored ~= 0 or compacted == 0 or compacted ~= tonumber(ARGV[2]) then
+		return -stored - 1
+	end
+	stored = compacted
+else
+	compacted = 0
+end
+for i = 7, #ARGV, step do
+	if exists(KEYS[1], ARGV[i]) then
+		return tonumber(ARGV[i])
+	end
+end
+if ARGV[5] ~= "0" then
+	local origin = get(KEYS[1], ARGV[5])
+	local ok, e = false, nil
+	if origin then
+		ok, e = pcall(cjson.decode, origin)
+	end
+	if not ok or type(e) ~= "table" or (e.ph or e.PayloadHash) ~= ARGV[6] or (e.pr or e.PayloadRef) then
+		return "origin"
+	end
+end
+if compacted > 0 then
+	redis.call("SET", KEYS[3], compacted)
+end
+for i = 7, #ARGV, step do
+	add(KEYS[1], ARGV[i], ARGV[i + 1])
+	if #KEYS > 3 and KEYS[4] ~= "" then
+		redis.call("XADD", KEYS[4], "*",
+			"aggregate_id", ARGV[i + 2],
+			"version", ARGV[i],
+			"event_type", ARGV[i + 3],
+			"data", ARGV[i + 4])
+	end
+	if #KEYS > 4 and KEYS[5] ~= "" then
+		redis.call("HSET", KEYS[5], ARGV[i + 5], ARGV[i + 6])
+	end
+	if #KEYS > 5 and KEYS[6] ~= "" then
+		redis.call("XADD", KEYS[6], "*",
+			"aggregate_id", ARGV[i + 2],
+			"version", ARGV[i])
+	end
+	if #KEYS > 6 then
+		redis.call("SADD", KEYS[7 + (i - 7) / step], ARGV[i + 6])
+	end
+end
+setVersion(KEYS[1], stored + (#ARGV - 6) / step)
+redis.call("SET", KEYS[2], ARGV[3])
+if tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	redis.call("PEXPIRE", KEYS[2], ARGV[1])
+	redis.call("PEXPIRE", KEYS[3], ARGV[1])
+end
+return 0
+`
+
+// outboxValues returns the outbox stream entry of an event.
+func outboxValues(e AggregateEvent) []interface{} {
+	return []interface{}{
+		"aggregate_id", e.AggregateID.String(),
+		"version", e.Version,
+		"event_type", e.EventType.String(),
+		"data", e.storedEventData(),
+	}
+}
+
+// Load implements the Load method of the eventhorizon.EventStore interface.
+func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "Load",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (map[string]string, error) {
+			if !s.strictLoad {
+				return s.loadAll(ctx, s.client(ns), s.aggregateKey(ns, id)).events()
+			}
+
+			var events eventsCmd
+			var compacted *redis.StringCmd
+			// The errors of the commands are handled below.
+			_, _ = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				events = s.loadAll(ctx, pipe, s.aggregateKey(ns, id))
+				compacted = pipe.Get(ctx, s.compactedKey(ns, id))
+				return nil
+			})
+			dbEvents, err := events.events()
+			if err != nil {
+				return nil, err
+			}
+			return dbEvents, checkStrictLoad(compacted, dbEvents, 1)
+		})
+	}
+
+	var events []eh.Event
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else {
+		events, err = s.loadEvents(dbEvents, 1, nil)
+	}
+	err = withOperation(err, "load", ns, id)
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("load", ns, len(events), start, err)
+
+	return events, err
+}
+
+// LoadVersion loads the single event of the aggregate id at version, for
+// example to inspect the event a save conflicted with, without fetching the
+// other events. It returns ErrEventNotFound when there is no event at the
+// version, including compacted events.
+func (s *EventStore) LoadVersion(ctx context.Context, id uuid.UUID, version int) (eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadVersion",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (map[string]string, error) {
+			return s.loadRange(ctx, s.client(ns), s.aggregateKey(ns, id), version, version).events()
+		})
+	}
+
+	var event eh.Event
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else if dbEvent, ok := dbEvents[strconv.Itoa(version)]; !ok {
+		err = eh.EventStoreError{
+			BaseErr: fmt.Errorf("no event at version %d", version),
+			Err:     ErrEventNotFound,
+		}
+	} else {
+		event, err = s.decodeEvent(dbEvent)
+	}
+	events := 0
+	if event != nil {
+		events = 1
+	}
+	span.end(err, eventCountAttribute.Int(events))
+	s.metrics.observeLoad("load_version", ns, events, start, err)
+
+	return event, err
+}
+
+// LoadOrError loads all events for the aggregate id like Load, but returns
+// eh.ErrAggregateNotFound when the aggregate has no events, instead of no
+// events and no error.
+func (s *EventStore) LoadOrError(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
+	events, err := s.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, eh.EventStoreError{
+			Err: eh.ErrAggregateNotFound,
+		}
+	}
+
+	return events, nil
+}
+
+// LoadFrom loads all events for the aggregate id starting from version.
+func (s *EventStore) LoadFrom(ctx context.Context, id uuid.UUID, version int) ([]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadFrom",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	// The events from the version and the number of events are fetched in
+	// one round trip, as a sorted set only returns the requested versions.
+	type result struct {
+		events    eventsCmd
+		count     countCmd
+		compacted *redis.StringCmd
+	}
+	var r result
+	err := s.checkNamespace(ns)
+	if err == nil {
+		r, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (result, error) {
+			var r result
+			key := s.aggregateKey(ns, id)
+			// The errors of the commands are handled below.
+			_, _ = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				r.events = s.loadFrom(ctx, pipe, key, version)
+				r.count = s.countEvents(ctx, pipe, key)
+				if s.strictLoad {
+					r.compacted = pipe.Get(ctx, s.compactedKey(ns, id))
+				}
+				return nil
+			})
+			return r, nil
 		})
 	}
+	if err != nil {
+		span.end(err, eventCountAttribute.Int(0))
+		s.metrics.observeLoad("load_from", ns, 0, start, err)
+
+		return nil, err
+	}
+
+	dbEvents, err := r.events.events()
+	if len(dbEvents) == 0 && r.count.Val() == 0 {
+		err := eh.EventStoreError{
+			BaseErr: err,
+			Err:     eh.ErrAggregateNotFound,
+		}
+		span.end(err, eventCountAttribute.Int(0))
+		s.metrics.observeLoad("load_from", ns, 0, start, err)
+
+		return nil, err
+	} else if err != nil {
+		err := eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+		span.end(err, eventCountAttribute.Int(0))
+		s.metrics.observeLoad("load_from", ns, 0, start, err)
+
+		return nil, err
+	}
+
+	var events []eh.Event
+	if s.strictLoad {
+		err = checkStrictLoad(r.compacted, dbEvents, version)
+	}
+	if err == nil {
+		events, err = s.loadEvents(dbEvents, version, nil)
+	}
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("load_from", ns, len(events), start, err)
+
+	return events, err
+}
+
+// Count returns the number of stored events of an aggregate, which is 0 for
+// an aggregate that does not exist.
+func (s *EventStore) Count(ctx context.Context, id uuid.UUID) (int, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	n, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (int64, error) {
+		return s.countEvents(ctx, s.client(ns), s.aggregateKey(ns, id)).Result()
+	})
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return 0, storeErr
+	} else if err != nil {
+		return 0, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	return int(n), nil
+}
+
+// Has returns true when the aggregate has stored events, checking the
+// existence of its key without loading the events.
+func (s *EventStore) Has(ctx context.Context, id uuid.UUID) (bool, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return false, err
+	}
+
+	n, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (int64, error) {
+		return s.client(ns).Exists(ctx, s.aggregateKey(ns, id)).Result()
+	})
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return false, storeErr
+	} else if err != nil {
+		return false, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	return n == 1, nil
+}
+
+// Version returns the current version of an aggregate, which is the original
+// version for the next save, without loading the events. It is the version of
+// the aggregate record, or the version field of WithVersionField, and 0 for an
+// aggregate without events. Aggregates without either have the number of
+// stored and compacted events as version.
+func (s *EventStore) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	version, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (int, error) {
+		return s.storedVersion(ctx, s.client(ns), ns, id, s.aggregateKey(ns, id))
+	})
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return 0, storeErr
+	} else if err != nil {
+		return 0, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	return version, nil
+}
+
+// LoadAggregateRecord loads the aggregate record with the current version of
+// an aggregate. It returns nil without an error when the aggregate has no
+// record, which is the case for aggregates not saved since records were added.
+func (s *EventStore) LoadAggregateRecord(ctx context.Context, id uuid.UUID) (*AggregateRecord, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	raw, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) ([]byte, error) {
+		return s.client(ns).Get(ctx, s.recordKey(ns, id)).Bytes()
+	})
+	var storeErr eh.EventStoreError
+	if err == redis.Nil {
+		return nil, nil
+	} else if errors.As(err, &storeErr) {
+		return nil, storeErr
+	} else if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	record := &AggregateRecord{}
+	if err := record.UnmarshalBinary(raw); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalEvent,
+		}
+	}
+
+	return record, nil
+}
+
+// aggregateIDsBatchSize is the number of keys scanned per round trip in AggregateIDs.
+const aggregateIDsBatchSize = 500
+
+// AggregateIDs returns the IDs of all aggregates with stored events in the
+// namespace, in no particular order. The keyspace is scanned in batches, so
+// aggregates saved or cleared while scanning may or may not be returned.
+func (s *EventStore) AggregateIDs(ctx context.Context) ([]uuid.UUID, error) {
+	ns := namespaceFromContext(ctx)
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	pattern := s.aggregateKey(ns, "*")
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]struct{}{}
+
+	err := s.scanKeys(ctx, ns, pattern, aggregateIDsBatchSize, func(keys []string) error {
+		for _, key := range keys {
+			// Skip keys in the pattern that are not aggregates, like streams.
+			if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+				continue
+			}
+			id, err := uuid.Parse(key[len(prefix) : len(key)-len(suffix)])
+			if err != nil {
+				continue
+			}
+			// SCAN may return a key more than once.
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	return ids, nil
+}
+
+// loadEvents decodes the stored events with a version of at least version and
+// meta data matching the filter, if any, sorted ascending by version. With
+// WithLenientLoad events that can't be
+// decoded are skipped and returned in a SkippedEventsError.
+func (s *EventStore) loadEvents(dbEvents map[string]string, version int, filter func(map[string]interface{}) bool) ([]eh.Event, error) {
+	var events []eh.Event
+	var skipped map[int]error
+
+	for field, dbEvent := range dbEvents {
+		// Skip events before the requested version without decoding them.
+		v, err := strconv.Atoi(field)
+		if err == nil && v < version {
+			continue
+		}
+
+		e, err := s.decodeMatchingEvent(dbEvent, filter)
+		if err != nil && s.lenientLoad {
+			if skipped == nil {
+				skipped = map[int]error{}
+			}
+			skipped[v] = err
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if e == nil {
+			continue
+		}
+		events = append(events, e)
+	}
 
 	sort.Slice(events, func(i, j int) bool {
 		return events[i].Version() < events[j].Version()
 	})
+	if skipped != nil {
+		if events == nil {
+			events = []eh.Event{}
+		}
+		return events, SkippedEventsError{Errors: skipped}
+	}
 	return events, nil
 }
 
-func (s *EventStore) Close() error {
-	return s.db.Close()
+// decodeEvent decodes a stored event, including its data and meta data.
+func (s *EventStore) decodeEvent(dbEvent string) (eh.Event, error) {
+	return s.decodeMatchingEvent(dbEvent, nil)
 }
 
-// Clear clears the event storage.
-func (s *EventStore) Clear(ctx context.Context) error {
-	ns := namespace.FromContext(ctx)
+// decodeMatchingEvent decodes a stored event like decodeEvent, but returns no
+// event without decoding the event data when its meta data doesn't match the
+// filter. A nil filter matches all events.
+func (s *EventStore) decodeMatchingEvent(dbEvent string, filter func(map[string]interface{}) bool) (eh.Event, error) {
+	e := AggregateEvent{}
 
-	err := s.db.Watch(func(tx *redis.Tx) error {
-		iter := tx.Scan(0, fmt.Sprintf("%s:*", ns), 0).Iterator()
+	event, err := s.decodeAggregateEvent(dbEvent, &e, filter)
+	if err != nil {
+		s.logError(err, "could not unmarshal event",
+			"namespace", e.Namespace,
+			"aggregate_id", e.AggregateID,
+			"version", e.Version)
+	}
 
-		for iter.Next() {
-			err := s.db.Del(iter.Val()).Err()
-			if err != nil {
-				return err
+	return event, err
+}
+
+// decodeAggregateEvent decodes a stored event into e, see decodeMatchingEvent.
+func (s *EventStore) decodeAggregateEvent(dbEvent string, e *AggregateEvent, filter func(map[string]interface{}) bool) (eh.Event, error) {
+	if err := json.Unmarshal([]byte(dbEvent), e); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalEvent,
+		}
+	}
+
+	// The meta data is decoded first, so that the event data of events not
+	// matching the filter is never decoded.
+	encryptionKeyID := e.EncryptionKeyID
+	if err := s.decodeMetadata(e); err != nil {
+		return nil, err
+	}
+	if filter != nil && !filter(e.MetaData) {
+		return nil, nil
+	}
+
+	// Events without data are stored without RawEventData, or with null by
+	// earlier versions, and are loaded without calling the encoder.
+	rawEventData := []byte(e.RawEventData)
+	if bytes.Equal(rawEventData, []byte("null")) {
+		rawEventData = nil
+	}
+	if e.BinaryEventData != nil {
+		var err error
+		data := e.BinaryEventData
+		if encryptionKeyID != "" {
+			if data, err = s.decrypt(encryptionKeyID, data); err != nil {
+				return nil, err
 			}
 		}
-		if err := iter.Err(); err != nil {
+		if rawEventData, err = decompress(data); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalEvent,
+			}
+		}
+	}
+	if len(s.upcasters) > 0 {
+		var err error
+		if e.EventType, rawEventData, err = s.upcast(e.EventType, e.Version, rawEventData); err != nil {
+			return nil, err
+		}
+	}
+	if len(rawEventData) > 0 {
+		if eventData, err := s.encoder.Unmarshal(e.EventType, rawEventData); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalEvent,
+			}
+		} else {
+			e.data = eventData
+		}
+	}
+	e.RawEventData = nil
+	e.BinaryEventData = nil
+
+	return event{
+		AggregateEvent: *e,
+	}, nil
+}
+
+// decodeMetadata decrypts and unmarshals the meta data of a stored event.
+func (s *EventStore) decodeMetadata(e *AggregateEvent) error {
+	raw := []byte(e.RawMetaData)
+	if e.EncodedMetaData != nil {
+		raw = e.EncodedMetaData
+	}
+	if e.BinaryMetaData != nil {
+		var err error
+		if raw, err = s.decrypt(e.EncryptionKeyID, e.BinaryMetaData); err != nil {
 			return err
 		}
+	}
+	encoding := e.MetaDataEncoding
+	e.RawMetaData = nil
+	e.BinaryMetaData = nil
+	e.EncodedMetaData = nil
+	e.MetaDataEncoding = ""
+	e.EncryptionKeyID = ""
 
+	if raw == nil {
 		return nil
-	}, fmt.Sprintf("%s:*", ns))
+	}
+
+	var err error
+	if encoding == "" {
+		err = json.Unmarshal(raw, &e.MetaData)
+	} else if encoding != s.metadataEncoder.String() {
+		err = fmt.Errorf("meta data is encoded as %s, the metadata encoder is %s", encoding, s.metadataEncoder)
+	} else {
+		e.MetaData, err = s.metadataEncoder.Unmarshal(raw)
+	}
+	if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalEvent,
+		}
+	}
+
+	return nil
+}
+
+// Ping checks that Redis can be reached with a round trip, for example for
+// readiness probes. It returns ErrAuthenticationFailed when Redis rejects the
+// credentials of the client.
+func (s *EventStore) Ping(ctx context.Context) error {
+	_, err := withTimeout(ctx, s, ErrCouldNotPing, func(ctx context.Context) (string, error) {
+		return s.wrapClient(s.db).Ping(ctx).Result()
+	})
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return storeErr
+	} else if isAuthError(err) {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrAuthenticationFailed,
+		}
+	} else if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotPing,
+		}
+	}
+
+	return nil
+}
+
+// Client returns the Redis client the store was created with, for commands
+// the store doesn't offer, like MEMORY USAGE of an aggregate key. Writing to
+// the keys managed by the store, see the keyspace in the README, bypasses the
+// version checks and indexes of the store and can corrupt the stored
+// aggregates. The client is closed by Close, unless the store is created with
+// WithSharedClient. With WithNamespaceDB the namespaces of other databases use
+// other clients.
+func (s *EventStore) Client() redis.UniversalClient {
+	return s.db
+}
+
+// Close closes the Redis client and the clients of WithNamespaceDB. The store
+// takes ownership of the client passed to NewEventStore, which must not be
+// used after closing the store, unless the store is created with
+// WithSharedClient. Calling Close more than once is a no-op.
+func (s *EventStore) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.closeDBClients()
+		if !s.sharedClient {
+			if closeErr := s.db.Close(); closeErr != nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
 
+// Clear clears the event storage. When the context is done it stops between
+// batches of keys, returning the context error as base error. Clearing is not
+// atomic: aggregates saved while clearing may be kept, in part or whole, so
+// saves to the namespace should be stopped first.
+func (s *EventStore) Clear(ctx context.Context) error {
+	ctx, span := s.startSpan(ctx, "Clear", namespaceAttribute.String(namespaceFromContext(ctx)))
+	start := time.Now()
+	err := withOperation(s.clear(ctx), "clear", namespaceFromContext(ctx), uuid.Nil)
+	span.end(err)
+	s.metrics.observe("clear", namespaceFromContext(ctx), start, err)
 	if err != nil {
+		s.logError(err, "could not clear events", "namespace", namespaceFromContext(ctx))
+	}
+
+	return err
+}
+
+// clear clears the event storage, see Clear.
+func (s *EventStore) clear(ctx context.Context) error {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+
+	// Clear the events, snapshots, retained snapshots, records, compaction
+	// counts, outbox, event index, global log and event type index of the
+	// namespace.
+	patterns := []string{s.aggregateKey(ns, "*"), s.snapshotKey(ns, "*"), s.snapshotsKey(ns, "*"), s.recordKey(ns, "*"), s.compactedKey(ns, "*")}
+	if s.storageMode == KeyPerEventStorage {
+		patterns = append(patterns, s.aggregateKey(ns, "*")+":*")
+	}
+	if s.outboxStream != "" {
+		patterns = append(patterns, s.outboxKey(ns))
+	}
+	if s.eventIndex {
+		patterns = append(patterns, s.eventIndexKey(ns))
+	}
+	if s.globalLog {
+		patterns = append(patterns, s.globalLogKey(ns))
+	}
+	if s.eventTypeIndex {
+		patterns = append(patterns, s.eventTypeIndexKey(ns, "*"))
+	}
+
+	// Clearing is idempotent, so a clear failing with a READONLY error is
+	// retried by scanning the keys again.
+	err := s.retryReadOnly(ctx, func() error {
+		if cluster, ok := s.db.(*redis.ClusterClient); ok {
+			// The keys are spread over the masters, and can't be deleted in a
+			// single transaction.
+			return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+				for _, pattern := range patterns {
+					if err := scanBatches(ctx, client, pattern, s.clearBatchSize, func(keys []string) error {
+						err := s.deleteKeys(ctx, client.Pipelined, keys)
+						if isRedirect(err) {
+							// Keys of migrating slots are deleted through the
+							// cluster client, which follows the redirects.
+							err = s.deleteKeys(ctx, cluster.Pipelined, keys)
+						}
+						if isRedirect(err) {
+							err = fmt.Errorf("%w: %v", ErrSlotMoved, err)
+						}
+						return err
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		c := s.client(ns)
+		for _, pattern := range patterns {
+			if err := scanBatches(ctx, c, pattern, s.clearBatchSize, func(keys []string) error {
+				return s.deleteKeys(ctx, c.Pipelined, keys)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, ErrRedisReadOnly) {
+		return err
+	} else if err != nil {
 		return eh.EventStoreError{
 			BaseErr: err,
 			Err:     ErrCouldNotClearDB,
@@ -262,12 +1613,192 @@ func (s *EventStore) Clear(ctx context.Context) error {
 	return nil
 }
 
+// checkNamespace returns ErrNamespaceNotAllowed for namespaces not in the
+// allowlist, see WithNamespaceAllowlist.
+func (s *EventStore) checkNamespace(ns string) error {
+	if s.namespaces == nil {
+		return nil
+	}
+	if _, ok := s.namespaces[ns]; ok {
+		return nil
+	}
+
+	return eh.EventStoreError{
+		BaseErr: fmt.Errorf("namespace %q is not in the allowlist", ns),
+		Err:     ErrNamespaceNotAllowed,
+	}
+}
+
+// namespaceFromContext returns the namespace of ctx, which is the default
+// namespace when ctx has none or the empty namespace, so that no keys start
+// with the separator of the namespace.
+func namespaceFromContext(ctx context.Context) string {
+	if ns := namespace.FromContext(ctx); ns != "" {
+		return ns
+	}
+	return namespace.DefaultNamespace
+}
+
+// defaultKeyBuilder builds the aggregate part of the keys, see WithKeyBuilder.
+// The keys of an aggregate have the aggregate ID as hash tag, so that they
+// are in the same slot on Redis Cluster and can be written atomically.
+func defaultKeyBuilder(ns, id string) string {
+	return fmt.Sprintf("%s:{%s}", ns, id)
+}
+
+// hashTag returns the hash tag of a key, which Redis Cluster hashes to find
+// the slot of the key instead of the whole key, or "" when it has none.
+func hashTag(key string) string {
+	start := strings.Index(key, "{")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(key[start+1:], "}")
+	if end < 0 {
+		return ""
+	}
+	return key[start+1 : start+1+end]
+}
+
+// aggregateKey returns the key of the hash holding the events of an aggregate.
+func (s *EventStore) aggregateKey(ns string, id interface{}) string {
+	return s.keyPrefix + s.keyBuilder(ns, fmt.Sprint(id))
+}
+
+// outboxKey returns the key of the outbox stream of a namespace.
+func (s *EventStore) outboxKey(ns string) string {
+	return fmt.Sprintf("%s%s:%s", s.keyPrefix, s.outboxStream, ns)
+}
+
+// eventIndexKey returns the key of the hash indexing the events of a
+// namespace by event ID.
+func (s *EventStore) eventIndexKey(ns string) string {
+	return fmt.Sprintf("%seventid:%s", s.keyPrefix, ns)
+}
+
+// globalLogKey returns the key of the global log stream of a namespace.
+func (s *EventStore) globalLogKey(ns string) string {
+	return fmt.Sprintf("%sglobal:%s", s.keyPrefix, ns)
+}
+
+// snapshotKey returns the key holding the snapshot of an aggregate.
+func (s *EventStore) snapshotKey(ns string, id interface{}) string {
+	return s.keyPrefix + "snapshot:" + s.keyBuilder(ns, fmt.Sprint(id))
+}
+
+// recordKey returns the key holding the aggregate record of an aggregate.
+func (s *EventStore) recordKey(ns string, id interface{}) string {
+	return s.keyPrefix + "aggregate:" + s.keyBuilder(ns, fmt.Sprint(id))
+}
+
+// clearBatchSize is the default number of keys deleted per pipeline in Clear,
+// see WithClearBatchSize.
+const clearBatchSize = 500
+
+// scanner is a client or transaction which can scan keys.
+type scanner interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// scanBatches calls fn with batches of up to count keys matching the pattern.
+// The batch is reused and must not be retained by fn.
+func scanBatches(ctx context.Context, c scanner, pattern string, count int64, fn func(keys []string) error) error {
+	iter := c.Scan(ctx, 0, pattern, count).Iterator()
+
+	keys := make([]string, 0, count)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if int64(len(keys)) < count {
+			continue
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+		keys = keys[:0]
+
+		// Stop between batches when the context is done, as a scan of a
+		// large keyspace can take long.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return fn(keys)
+}
+
+// scanKeys calls fn with batches of the keys of the namespace matching the
+// pattern, see scanBatches. On Redis Cluster the keys of all masters are
+// scanned, without calling fn concurrently.
+func (s *EventStore) scanKeys(ctx context.Context, ns, pattern string, count int64, fn func(keys []string) error) error {
+	cluster, ok := s.db.(*redis.ClusterClient)
+	if !ok {
+		return scanBatches(ctx, s.client(ns), pattern, count, fn)
+	}
+
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		return scanBatches(ctx, client, pattern, count, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return fn(keys)
+		})
+	})
+}
+
+// deleteKeys deletes the keys in a single pipeline. The keys
+// are unlinked, which frees their memory in the background instead of
+// blocking Redis, falling back to DEL on servers without UNLINK.
+func (s *EventStore) deleteKeys(ctx context.Context, pipelined func(context.Context, func(redis.Pipeliner) error) ([]redis.Cmder, error), keys []string) error {
+	if atomic.LoadInt32(&s.noUnlink) == 0 {
+		_, err := pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Unlink(ctx, key)
+			}
+			return nil
+		})
+		if err == nil || !isUnknownCommand(err) {
+			return err
+		}
+		atomic.StoreInt32(&s.noUnlink, 1)
+	}
+
+	_, err := pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// isUnknownCommand returns true for errors of commands the server doesn't
+// support.
+func isUnknownCommand(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
 // event is the private implementation of the eventhorizon.Event interface
 // for a redis event store.
 type event struct {
 	AggregateEvent
 }
 
+// EventID returns the ID the event was saved with, which is stable across
+// loads.
+func (e event) EventID() uuid.UUID {
+	return e.AggregateEvent.EventID
+}
+
 func (e event) Metadata() map[string]interface{} {
 	return e.AggregateEvent.MetaData
 }
@@ -2,11 +2,22 @@ package ehpg_test
 
 import (
 	"context"
-	"github.com/go-redis/redis"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
 	testsuite "github.com/looplab/eventhorizon/eventstore"
+	"github.com/looplab/eventhorizon/mocks"
 	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
 	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEventStore(t *testing.T) {
@@ -51,3 +62,2196 @@ func TestEventStore(t *testing.T) {
 	testsuite.AcceptanceTest(t, store, namespace.NewContext(context.Background(), "other"))
 
 }
+
+func TestEventStoreSnapshot(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+
+	snapshot, err := store.LoadSnapshot(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if snapshot != nil {
+		t.Fatal("there should be no snapshot")
+	}
+
+	timestamp := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       3,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     timestamp,
+		State:         map[string]interface{}{"content": "state"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	snapshot, err = store.LoadSnapshot(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if snapshot == nil {
+		t.Fatal("there should be a snapshot")
+	}
+	if snapshot.Version != 3 {
+		t.Error("the version should be correct:", snapshot.Version)
+	}
+	if !snapshot.Timestamp.Equal(timestamp) {
+		t.Error("the timestamp should be correct:", snapshot.Timestamp)
+	}
+	if state, ok := snapshot.State.(map[string]interface{}); !ok || state["content"] != "state" {
+		t.Error("the state should be correct:", snapshot.State)
+	}
+
+	// A late snapshot of an earlier version doesn't replace the latest.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       2,
+		AggregateType: mocks.AggregateType,
+		State:         map[string]interface{}{"content": "late"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if snapshot, err := store.LoadSnapshot(ctx, id); err != nil || snapshot == nil || snapshot.Version != 3 {
+		t.Error("the latest snapshot should be kept:", snapshot, err)
+	}
+
+	// A snapshot of the same version replaces it.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       3,
+		AggregateType: mocks.AggregateType,
+		State:         map[string]interface{}{"content": "again"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	snapshot, err = store.LoadSnapshot(ctx, id)
+	if err != nil || snapshot == nil {
+		t.Fatal("there should be a snapshot:", err)
+	}
+	if state, ok := snapshot.State.(map[string]interface{}); !ok || state["content"] != "again" {
+		t.Error("the snapshot should be replaced:", snapshot.State)
+	}
+}
+
+func TestEventStoreLoadFrom(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	var events []eh.Event
+	for version := 1; version <= 12; version++ {
+		events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: fmt.Sprint("event", version)}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, version)))
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The versions are sorted numerically, not as strings.
+	loaded, err := store.LoadFrom(ctx, id, 9)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(loaded) != 4 {
+		t.Fatal("the events from the version should be loaded:", loaded)
+	}
+	for i, e := range loaded {
+		if e.Version() != 9+i {
+			t.Error("the events should be in ascending version order:", e.Version())
+		}
+		if data, ok := e.Data().(*mocks.EventData); !ok || data.Content != fmt.Sprint("event", 9+i) {
+			t.Error("the event data should be loaded:", e.Data())
+		}
+	}
+
+	if loaded, err := store.LoadFrom(ctx, id, 1); err != nil || len(loaded) != 12 {
+		t.Error("all events should be loaded:", len(loaded), err)
+	}
+	if loaded, err := store.LoadFrom(ctx, id, 13); err != nil || len(loaded) != 0 {
+		t.Error("there should be no events after the stored version:", loaded, err)
+	}
+
+	if _, err := store.LoadFrom(ctx, uuid.New(), 1); !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be an aggregate not found error:", err)
+	}
+}
+
+func TestEventStoreClear(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		ids = append(ids, id)
+
+		event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1))
+		if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	for _, id := range ids {
+		events, err := store.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != 0 {
+			t.Error("there should be no events:", events)
+		}
+	}
+}
+
+func TestEventStoreClearCancel(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "cancel")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	if _, err := db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < 2000; i++ {
+			pipe.HSet(ctx, "cancel:{"+uuid.NewString()+"}", "1", "{}")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Cancel when the first batch is deleted.
+	clearCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	db.AddHook(cancelHook{name: "unlink", cancel: cancel})
+
+	start := time.Now()
+	err := store.Clear(clearCtx)
+	if time.Since(start) > time.Second {
+		t.Error("the clear should return fast:", time.Since(start))
+	}
+
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, context.Canceled) {
+		t.Fatal("there should be a cancellation error:", err)
+	}
+	if keys, _ := db.Keys(ctx, "cancel:*").Result(); len(keys) == 0 {
+		t.Error("the clear should stop before deleting all keys")
+	}
+}
+
+func TestEventStoreClearUnlink(t *testing.T) {
+	testCases := map[string]struct {
+		err     error
+		command string
+	}{
+		"unlink":          {command: "unlink"},
+		"fallback to del": {err: errors.New("ERR unknown command 'unlink'"), command: "del"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, rediseventstore.WithClearBatchSize(2))
+
+			ctx := namespace.NewContext(context.Background(), "unlink")
+
+			for i := 0; i < 5; i++ {
+				event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, uuid.New(), 1))
+				if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			if tc.err != nil {
+				db.AddHook(newFailingHook("unlink", tc.err, 1000))
+			}
+			hook := newFailingHook(tc.command, nil, 0)
+			db.AddHook(hook)
+
+			if err := store.Clear(ctx); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if keys, _ := db.Keys(ctx, "unlink:*").Result(); len(keys) != 0 {
+				t.Error("all keys should be deleted:", keys)
+			}
+			if calls := atomic.LoadInt32(hook.calls); calls != 10 {
+				t.Error("the aggregate and record keys should be deleted with "+tc.command+":", calls)
+			}
+		})
+	}
+}
+
+// cancelHook is a redis hook cancelling a context when a pipeline with a
+// specific command has been processed.
+type cancelHook struct {
+	name   string
+	cancel context.CancelFunc
+}
+
+func (h cancelHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h cancelHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h cancelHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if cmd.Name() == h.name {
+				h.cancel()
+				break
+			}
+		}
+		return err
+	}
+}
+
+// newEventStore creates an event store against the local test Redis.
+func newEventStore(t testing.TB, options ...rediseventstore.Option) (*rediseventstore.EventStore, redis.UniversalClient) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	store, err := rediseventstore.NewEventStore(db, options...)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	return store, db
+}
+
+func TestEventStoreLoadClearsRawFields(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1),
+		eh.WithMetadata(map[string]interface{}{"meta": "data"}))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+
+	marshaler, ok := events[0].(encoding.BinaryMarshaler)
+	if !ok {
+		t.Fatal("the event should be binary marshalable")
+	}
+	raw, err := marshaler.MarshalBinary()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var e rediseventstore.AggregateEvent
+	if err := e.UnmarshalBinary(raw); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.RawEventData != nil && string(e.RawEventData) != "null" {
+		t.Error("the raw event data should be cleared:", string(e.RawEventData))
+	}
+	if e.RawMetaData != nil && string(e.RawMetaData) != "null" {
+		t.Error("the raw meta data should be cleared:", string(e.RawMetaData))
+	}
+}
+
+func TestNewEventStoreOptions(t *testing.T) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	defer db.Close()
+
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithEncoder(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithKeyPrefix("app*")); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithEventTTL(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithOperationTimeout(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithOperationTimeout(time.Second)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMetadataEncryption()); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSaveRetries(-1, time.Millisecond)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMaxEventSize(-1)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithKeyBuilder(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithLogger(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSnapshotRetention(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithClearBatchSize(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithNamespaceDB(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithAfterSave(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMetadataEncoder(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMaxSaveBatch(-1)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSchemaValidator(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithBackoff(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMetadataFromContext(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSnapshotEncoder(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithReadonlyErrorRetry(-1)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithMetrics(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithTracer(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithCommandTimeout(0)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithCommandTimeout(time.Second)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db,
+		rediseventstore.WithEncoder(rediseventstore.NewMsgpackEncoder()),
+		rediseventstore.WithSchemaValidator(func(eh.EventType, json.RawMessage) error { return nil }),
+	); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithVersionField(), rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db,
+		rediseventstore.WithPayloadDedup(),
+		rediseventstore.WithEncryption(xorCipher{id: "key", key: 0x5a}),
+	); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithUUIDFunc(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithClock(nil)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithStorageMode(9)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithKeyBuilder(func(ns, id string) string {
+		return ns
+	})); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+	defer cluster.Close()
+	if _, err := rediseventstore.NewEventStore(cluster, rediseventstore.WithOutboxStream("outbox")); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(cluster, rediseventstore.WithEventIndex()); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(cluster, rediseventstore.WithGlobalLog()); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(cluster, rediseventstore.WithEventTypeIndex()); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(cluster, rediseventstore.WithNamespaceDB(func(string) int { return 1 })); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+	if _, err := rediseventstore.NewEventStore(cluster,
+		rediseventstore.WithStorageMode(rediseventstore.KeyPerEventStorage),
+		rediseventstore.WithKeyBuilder(func(ns, id string) string {
+			return ns + ":" + id
+		}),
+	); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+
+	store, err := rediseventstore.NewEventStore(db,
+		rediseventstore.WithKeyPrefix("app"),
+		rediseventstore.WithEventTTL(time.Hour),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	key := "app:ns:{" + id.String() + "}"
+	if n := db.Exists(context.Background(), key).Val(); n != 1 {
+		t.Error("the aggregate should be stored under the prefixed key")
+	}
+	if ttl := db.TTL(context.Background(), key).Val(); ttl <= 0 || ttl > time.Hour {
+		t.Error("the aggregate should expire within the TTL:", ttl)
+	}
+}
+
+func TestEventStoreSaveOrder(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testSaveOrder(t, "evalsha", func(args []interface{}) []interface{} {
+			// EVALSHA sha numkeys key recordKey compactedKey ttl version record compacted origin hash field value ...
+			var fields []interface{}
+			for i := 12; i < len(args); i += 2 {
+				fields = append(fields, args[i])
+			}
+			return fields
+		})
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testSaveOrder(t, "hsetnx", func(args []interface{}) []interface{} {
+			// HSETNX key field value
+			return args[2:3]
+		}, rediseventstore.WithWatchSave())
+	})
+}
+
+func testSaveOrder(t *testing.T, command string, fields func([]interface{}) []interface{}, options ...rediseventstore.Option) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	defer db.Close()
+
+	hook := &commandRecorder{name: command}
+	db.AddHook(hook)
+
+	store, err := rediseventstore.NewEventStore(db, options...)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	var events []eh.Event
+	for i := 1; i <= 5; i++ {
+		events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, i)))
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var written []string
+	for _, args := range hook.args {
+		for _, field := range fields(args) {
+			written = append(written, fmt.Sprint(field))
+		}
+	}
+	if strings.Join(written, ",") != "1,2,3,4,5" {
+		t.Error("the events should be written in version order:", written)
+	}
+}
+
+// commandRecorder is a redis hook recording the arguments of all commands
+// with a specific name.
+type commandRecorder struct {
+	name string
+	args [][]interface{}
+}
+
+func (h *commandRecorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *commandRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == h.name {
+			h.args = append(h.args, cmd.Args())
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *commandRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() == h.name {
+				h.args = append(h.args, cmd.Args())
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestEventStoreSaveConflictIsAtomic(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testSaveConflictIsAtomic(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testSaveConflictIsAtomic(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testSaveConflictIsAtomic(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, options...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Take version 2 of the aggregate behind the store's back.
+	id := uuid.New()
+	key := "ns:{" + id.String() + "}"
+	if err := db.HSet(context.Background(), key, "2", "{}").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var events []eh.Event
+	for i := 1; i <= 3; i++ {
+		events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, i)))
+	}
+	if err := store.Save(ctx, events, 0); err == nil {
+		t.Fatal("there should be a version conflict")
+	}
+
+	for _, field := range []string{"1", "3"} {
+		if db.HExists(context.Background(), key, field).Val() {
+			t.Error("the event should not be persisted:", field)
+		}
+	}
+}
+
+func TestEventStoreMaxEventSize(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithMaxEventSize(64))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: strings.Repeat("x", 100)}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1)
+	if !errors.Is(err, rediseventstore.ErrEventTooLarge) {
+		t.Error("there should be an event too large error:", err)
+	}
+	if n := db.HLen(context.Background(), "ns:{"+id.String()+"}").Val(); n != 1 {
+		t.Error("the oversized event should not be saved:", n)
+	}
+}
+
+func TestEventStoreMaxSaveBatch(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithMaxSaveBatch(2))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	var events []eh.Event
+	for version := 1; version <= 3; version++ {
+		events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, version)))
+	}
+
+	err := store.Save(ctx, events, 0)
+	if !errors.Is(err, rediseventstore.ErrBatchTooLarge) {
+		t.Error("there should be a batch too large error:", err)
+	}
+	if n := db.Exists(context.Background(), "ns:{"+id.String()+"}").Val(); n != 0 {
+		t.Error("no events of the oversized batch should be saved:", n)
+	}
+
+	if err := store.Save(ctx, events[:2], 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, events[2:], 2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
+
+func TestEventStoreSchemaValidator(t *testing.T) {
+	errEmptyContent := errors.New("content must not be empty")
+	store, db := newEventStore(t, rediseventstore.WithSchemaValidator(func(t eh.EventType, data json.RawMessage) error {
+		var content struct {
+			Content string
+		}
+		if err := json.Unmarshal(data, &content); err != nil {
+			return err
+		}
+		if content.Content == "" {
+			return errEmptyContent
+		}
+		return nil
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0)
+	var storeErr eh.EventStoreError
+	if !errors.Is(err, rediseventstore.ErrInvalidEventData) || !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, errEmptyContent) {
+		t.Error("there should be an invalid event data error:", err)
+	}
+	if n := db.Exists(context.Background(), "ns:{"+id.String()+"}").Val(); n != 0 {
+		t.Error("no events should be saved:", n)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
+
+func TestEventStoreKeyBuilder(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithKeyBuilder(func(ns, id string) string {
+		return "tenant:" + ns + ":{" + id + "}"
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	for _, key := range []string{
+		"tenant:ns:{" + id.String() + "}",
+		"aggregate:tenant:ns:{" + id.String() + "}",
+	} {
+		if n := db.Exists(context.Background(), key).Val(); n != 1 {
+			t.Error("the key should be built with the key builder:", key)
+		}
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the event should be loaded:", events)
+	}
+
+	ids, err := store.AggregateIDs(ctx)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Error("the aggregate ID should be listed:", ids)
+	}
+
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := db.Exists(context.Background(), "tenant:ns:{"+id.String()+"}").Val(); n != 0 {
+		t.Error("the aggregate should be cleared")
+	}
+}
+
+func TestEventStoreConcurrentCreate(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testConcurrentCreate(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testConcurrentCreate(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testConcurrentCreate(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, options...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Creators save one to ten events, so that they write different fields.
+	const creators = 10
+	id := uuid.New()
+	errs := make([]error, creators)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < creators; i++ {
+		var events []eh.Event
+		for v := 1; v <= i+1; v++ {
+			events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: fmt.Sprint(i)}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, v)))
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = store.Save(ctx, events, 0)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			if winner >= 0 {
+				t.Fatal("only one creator should win:", winner, i)
+			}
+			winner = i
+			continue
+		}
+
+		var storeErr eh.EventStoreError
+		if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+			t.Error("the other creators should get a version conflict:", err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("one creator should win")
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != winner+1 {
+		t.Error("only the events of the winner should be saved:", len(events), winner+1)
+	}
+	for _, event := range events {
+		if event.Data().(*mocks.EventData).Content != fmt.Sprint(winner) {
+			t.Error("the events should be of the winner:", event.Data())
+		}
+	}
+	if n := db.HLen(context.Background(), "ns:{"+id.String()+"}").Val(); int(n) != winner+1 {
+		t.Error("there should be no events of other creators:", n)
+	}
+}
+
+func TestEventStoreNamespaceAllowlist(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithNamespaceAllowlist([]string{"ns"}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+	otherCtx := namespace.NewContext(context.Background(), "other")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := store.Save(otherCtx, events, 0); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.Load(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.LoadFrom(otherCtx, id, 1); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if err := store.Clear(otherCtx); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if err := store.SaveSnapshot(otherCtx, id, rediseventstore.Snapshot{Version: 1}); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.Version(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.Has(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.LoadAggregateRecord(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.LoadMany(otherCtx, []uuid.UUID{id}); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.LoadMetadata(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.Count(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.AggregateIDs(otherCtx); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, err := store.Subscribe(otherCtx, id); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+	if _, errs := store.LoadStream(otherCtx, id); !errors.Is(<-errs, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error")
+	}
+	if _, err := store.RenameAggregateType(otherCtx, mocks.AggregateType, "Renamed"); !errors.Is(err, rediseventstore.ErrNamespaceNotAllowed) {
+		t.Error("there should be a namespace not allowed error:", err)
+	}
+
+	// An empty allowlist allows all namespaces.
+	permissive, _ := newEventStore(t, rediseventstore.WithNamespaceAllowlist(nil))
+	if _, err := permissive.Load(otherCtx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	id := uuid.New()
+	newEvent := func(id uuid.UUID, version int) eh.Event {
+		return eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, version))
+	}
+
+	testCases := map[string]struct {
+		events          []eh.Event
+		originalVersion int
+		err             error
+		message         string
+	}{
+		"valid": {
+			events:          []eh.Event{newEvent(id, 3), newEvent(id, 4)},
+			originalVersion: 2,
+		},
+		"no events": {
+			err: eh.ErrNoEventsToAppend,
+		},
+		"other aggregate": {
+			events: []eh.Event{newEvent(id, 1), newEvent(uuid.New(), 2)},
+			err:    eh.ErrInvalidEvent,
+		},
+		"wrong first version": {
+			events:          []eh.Event{newEvent(id, 5)},
+			originalVersion: 0,
+			err:             eh.ErrIncorrectEventVersion,
+			message:         "event 0 of the batch has version 5, expected version 1 after original version 0",
+		},
+		"gap": {
+			events:  []eh.Event{newEvent(id, 1), newEvent(id, 3)},
+			err:     eh.ErrIncorrectEventVersion,
+			message: "event 1 of the batch has version 3, expected version 2 after original version 0",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := rediseventstore.ValidateBatch(tc.events, tc.originalVersion)
+			if tc.err == nil && err != nil {
+				t.Error("there should be no error:", err)
+			} else if !errors.Is(err, tc.err) {
+				t.Error("the error should be correct:", err)
+			}
+			if tc.message != "" && !strings.Contains(fmt.Sprint(err), tc.message) {
+				t.Error("the error should tell the versions:", err)
+			}
+		})
+	}
+}
+
+func TestEventStoreSaveOriginalVersion(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testSaveOriginalVersion(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testSaveOriginalVersion(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testSaveOriginalVersion(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, options...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// An original version ahead of the stored version would leave a gap.
+	err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3)),
+	}, 2)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Fatal("there should be a version conflict:", err)
+	}
+	if db.HExists(context.Background(), "ns:{"+id.String()+"}", "3").Val() {
+		t.Error("the event should not be persisted")
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
+
+func TestEventStoreReplace(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	timestamp := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, timestamp,
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	missing := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "missing"}, timestamp,
+		eh.ForAggregate(mocks.AggregateType, id, 2))
+	if err := store.Replace(ctx, missing); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+		t.Error("there should be an event not found error:", err)
+	}
+
+	replacement := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "replaced"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Replace(ctx, replacement); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	if data, ok := events[0].Data().(*mocks.EventData); !ok || data.Content != "replaced" {
+		t.Error("the event data should be replaced:", events[0].Data())
+	}
+	if !events[0].Timestamp().Equal(timestamp) {
+		t.Error("the timestamp should be preserved:", events[0].Timestamp())
+	}
+}
+
+// renamedEventType is an event type with registered event data, unlike
+// mocks.EventOtherType, so that events renamed to it can be loaded.
+const renamedEventType eh.EventType = "RenamedEvent"
+
+func init() {
+	eh.RegisterEventData(renamedEventType, func() eh.EventData {
+		return &mocks.EventData{}
+	})
+}
+
+func TestEventStoreRenameEvent(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	n, err := store.RenameEventCount(ctx, mocks.EventType, renamedEventType)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n != 2 {
+		t.Error("there should be two renamed events:", n)
+	}
+
+	// Renaming again is a no-op.
+	if n, err := store.RenameEventCount(ctx, mocks.EventType, renamedEventType); err != nil || n != 0 {
+		t.Error("there should be no renamed events:", n, err)
+	}
+
+	loaded, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, event := range loaded {
+		if event.EventType() != renamedEventType {
+			t.Error("the event type should be renamed:", event.EventType())
+		}
+		if data, ok := event.Data().(*mocks.EventData); !ok || data.Content != "event" {
+			t.Error("the event data should be loaded:", event.Data())
+		}
+	}
+}
+
+// beforeRenameHook is a redis hook calling before once before the pipeline
+// replacing renamed events, found by the ZSCORE of its script.
+type beforeRenameHook struct {
+	before func()
+	called *int32
+}
+
+func (h beforeRenameHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h beforeRenameHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h beforeRenameHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			args := cmd.Args()
+			if cmd.Name() == "eval" && strings.Contains(fmt.Sprint(args[1]), "ZSCORE") && atomic.CompareAndSwapInt32(h.called, 0, 1) {
+				h.before()
+				break
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestEventStoreRenameEventConcurrentChanges(t *testing.T) {
+	for _, mode := range []rediseventstore.StorageMode{
+		rediseventstore.HashStorage,
+		rediseventstore.SortedSetStorage,
+		rediseventstore.KeyPerEventStorage,
+	} {
+		t.Run(mode.String(), func(t *testing.T) {
+			store, db := newEventStore(t, rediseventstore.WithStorageMode(mode))
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			var events []eh.Event
+			for version := 1; version <= 3; version++ {
+				events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, version)))
+			}
+			if err := store.Save(ctx, events, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       3,
+				AggregateType: mocks.AggregateType,
+				Timestamp:     time.Now(),
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			// Version 1 is compacted and version 3 replaced between loading and
+			// replacing the renamed events.
+			var called int32
+			db.AddHook(beforeRenameHook{called: &called, before: func() {
+				if _, err := store.Compact(ctx, id, 2); err != nil {
+					t.Error("there should be no error:", err)
+				}
+				if err := store.Replace(ctx, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "replaced"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 3))); err != nil {
+					t.Error("there should be no error:", err)
+				}
+			}})
+
+			n, err := store.RenameEventCount(ctx, mocks.EventType, renamedEventType)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if n != 2 {
+				t.Error("the stored events should be renamed once:", n)
+			}
+			if atomic.LoadInt32(&called) != 1 {
+				t.Error("the events should change while renaming")
+			}
+
+			loaded, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(loaded) != 2 {
+				t.Fatal("the compacted event should not be written back:", loaded)
+			}
+			for _, event := range loaded {
+				if event.EventType() != renamedEventType {
+					t.Error("the event type should be renamed:", event)
+				}
+			}
+			if data, ok := loaded[1].Data().(*mocks.EventData); !ok || data.Content != "replaced" {
+				t.Error("the replaced event should be kept:", loaded[1].Data())
+			}
+
+			// The version still matches the stored events.
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 4)),
+			}, 3); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		})
+	}
+}
+
+func TestEventStoreRenameAggregateType(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	const renamedType eh.AggregateType = "RenamedAggregate"
+	id, otherID := uuid.New(), uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate("OtherAggregate", otherID, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	n, err := store.RenameAggregateType(ctx, mocks.AggregateType, renamedType)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n != 2 {
+		t.Error("there should be two renamed events:", n)
+	}
+
+	// Renaming again is a no-op.
+	if n, err := store.RenameAggregateType(ctx, mocks.AggregateType, renamedType); err != nil || n != 0 {
+		t.Error("there should be no renamed events:", n, err)
+	}
+
+	loaded, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(loaded) != 2 {
+		t.Fatal("there should be two events:", len(loaded))
+	}
+	for _, event := range loaded {
+		if event.AggregateType() != renamedType {
+			t.Error("the aggregate type should be renamed:", event.AggregateType())
+		}
+	}
+
+	other, err := store.Load(ctx, otherID)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(other) != 1 || other[0].AggregateType() != "OtherAggregate" {
+		t.Error("other aggregate types should not be renamed:", other)
+	}
+}
+
+func TestEventStoreCustomEncoder(t *testing.T) {
+	encoder := &countingEncoder{Encoder: rediseventstore.NewJSONEncoder()}
+	store, _ := newEventStore(t, rediseventstore.WithEncoder(encoder))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if encoder.marshaled != 1 || encoder.unmarshaled != 1 {
+		t.Error("the custom encoder should be used:", encoder.marshaled, encoder.unmarshaled)
+	}
+}
+
+// countingEncoder is an encoder counting the events it encodes.
+type countingEncoder struct {
+	rediseventstore.Encoder
+	marshaled, unmarshaled int
+}
+
+func (e *countingEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	e.marshaled++
+	return e.Encoder.Marshal(data)
+}
+
+func (e *countingEncoder) Unmarshal(eventType eh.EventType, raw []byte) (eh.EventData, error) {
+	e.unmarshaled++
+	return e.Encoder.Unmarshal(eventType, raw)
+}
+
+func TestEventStoreNilEventData(t *testing.T) {
+	const datalessEventType eh.EventType = "DatalessEvent"
+
+	testCases := map[string]rediseventstore.Encoder{
+		"json":    rediseventstore.NewJSONEncoder(),
+		"msgpack": rediseventstore.NewMsgpackEncoder(),
+	}
+
+	for name, encoder := range testCases {
+		t.Run(name, func(t *testing.T) {
+			counting := &countingEncoder{Encoder: encoder}
+			store, db := newEventStore(t, rediseventstore.WithEncoder(counting))
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(datalessEventType, nil, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			raw, err := db.HGet(ctx, "ns:{"+id.String()+"}", "1").Result()
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if strings.Contains(raw, `"d":`) || strings.Contains(raw, `"bd":`) {
+				t.Error("the event should be stored without data:", raw)
+			}
+
+			// Events stored with null data by earlier versions.
+			if err := db.HSet(ctx, "ns:{"+id.String()+"}", "2",
+				`{"EventID":"`+uuid.New().String()+`","Namespace":"ns","AggregateID":"`+id.String()+
+					`","AggregateType":"`+string(mocks.AggregateType)+`","EventType":"`+string(datalessEventType)+
+					`","RawEventData":null,"Timestamp":"2020-01-01T00:00:00Z","Version":2,"MetaData":null,"RawMetaData":null}`).Err(); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 2 {
+				t.Fatal("there should be two events:", events)
+			}
+			for _, event := range events {
+				if event.Data() != nil {
+					t.Error("the event should have no data:", event.Data())
+				}
+			}
+			if counting.unmarshaled != 0 {
+				t.Error("the encoder should not be called for events without data:", counting.unmarshaled)
+			}
+		})
+	}
+}
+
+func TestEventStoreCloseTwice(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	if err := store.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Error("there should be no error when closing again:", err)
+	}
+}
+
+func TestEventStoreClock(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := newEventStore(t, rediseventstore.WithClock(func() time.Time {
+		return now
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       1,
+		AggregateType: mocks.AggregateType,
+		State:         map[string]interface{}{"content": "state"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	snapshot, err := store.LoadSnapshot(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !snapshot.Timestamp.Equal(now) {
+		t.Error("the snapshot should be stamped with the clock:", snapshot.Timestamp)
+	}
+}
+
+func TestEventStoreUUIDFunc(t *testing.T) {
+	eventID := uuid.New()
+	store, _ := newEventStore(t, rediseventstore.WithUUIDFunc(func() uuid.UUID {
+		return eventID
+	}))
+	other, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	for _, s := range []*rediseventstore.EventStore{store, other} {
+		id := uuid.New()
+		if err := s.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 1)),
+		}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+
+		events, err := s.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != 1 {
+			t.Fatal("there should be one event:", len(events))
+		}
+		generated := events[0].(interface{ EventID() uuid.UUID }).EventID() == eventID
+		if generated != (s == store) {
+			t.Error("only the store with the UUID func should use it:", events[0])
+		}
+	}
+}
+
+func TestEventStoreMetadataFromContext(t *testing.T) {
+	type correlationKey struct{}
+	store, _ := newEventStore(t, rediseventstore.WithMetadataFromContext(func(ctx context.Context) map[string]interface{} {
+		id, ok := ctx.Value(correlationKey{}).(string)
+		if !ok {
+			return nil
+		}
+		return map[string]interface{}{"correlation_id": id, "source": "context"}
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(context.WithValue(ctx, correlationKey{}, "request-1"), []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1),
+			eh.WithMetadata(map[string]interface{}{"source": "event"})),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	if metadata := events[0].Metadata(); metadata["correlation_id"] != "request-1" || metadata["source"] != "event" {
+		t.Error("the meta data of the context should be added without overwriting the event:", metadata)
+	}
+	if metadata := events[1].Metadata(); metadata["correlation_id"] != nil {
+		t.Error("there should be no meta data without a correlation ID:", metadata)
+	}
+}
+
+func TestEventStoreAfterSave(t *testing.T) {
+	var saved [][]eh.Event
+	store, _ := newEventStore(t, rediseventstore.WithAfterSave(func(ctx context.Context, events []eh.Event) {
+		if namespace.FromContext(ctx) != "ns" {
+			t.Error("the hook should get the context of the save:", namespace.FromContext(ctx))
+		}
+		saved = append(saved, events)
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(saved) != 1 || len(saved[0]) != 2 || saved[0][1] != events[1] {
+		t.Fatal("the hook should be called with the saved events:", saved)
+	}
+
+	// The hook is not called for a version conflict.
+	if err := store.Save(ctx, events[:1], 0); err == nil {
+		t.Fatal("there should be a version conflict")
+	}
+	if len(saved) != 1 {
+		t.Error("the hook should not be called for a failed save:", saved)
+	}
+}
+
+func TestEventStorePing(t *testing.T) {
+	store, db := newEventStore(t)
+
+	if err := store.Ping(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	_ = db.Close()
+	if err := store.Ping(context.Background()); !errors.Is(err, rediseventstore.ErrCouldNotPing) {
+		t.Error("there should be a ping error:", err)
+	}
+}
+
+func TestEventStoreClient(t *testing.T) {
+	store, db := newEventStore(t)
+
+	if store.Client() != db {
+		t.Error("the client of the store should be returned")
+	}
+}
+
+func TestEventStoreSharedClient(t *testing.T) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	defer db.Close()
+
+	store, err := rediseventstore.NewEventStore(db, rediseventstore.WithSharedClient())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := db.Ping(context.Background()).Err(); err != nil {
+		t.Error("the shared client should still be open:", err)
+	}
+}
+
+func TestEventStoreEventTTL(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testEventTTL(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testEventTTL(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testEventTTL(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, append(options, rediseventstore.WithEventTTL(time.Hour))...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	key := "ns:{" + id.String() + "}"
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Pretend most of the TTL has passed.
+	if err := db.Expire(context.Background(), key, time.Minute).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if ttl := db.PTTL(context.Background(), key).Val(); ttl <= time.Minute || ttl > time.Hour {
+		t.Error("the TTL should slide forward on save:", ttl)
+	}
+	if ttl := db.PTTL(context.Background(), "aggregate:"+key).Val(); ttl <= time.Minute || ttl > time.Hour {
+		t.Error("the aggregate record should expire with the events:", ttl)
+	}
+}
+
+func TestEventStoreLoadOrError(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if events, err := store.LoadOrError(ctx, id); !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be an aggregate not found error:", events, err)
+	}
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 0 {
+		t.Error("there should be no events and no error:", events, err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if events, err := store.LoadOrError(ctx, id); err != nil || len(events) != 1 {
+		t.Error("there should be one event:", events, err)
+	}
+}
+
+func TestEventStoreLoadVersion(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"hash":       nil,
+		"sorted set": {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			event, err := store.LoadVersion(ctx, id, 2)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if event.Version() != 2 || event.Data().(*mocks.EventData).Content != "event2" {
+				t.Error("the event at the version should be loaded:", event)
+			}
+
+			if _, err := store.LoadVersion(ctx, id, 3); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+				t.Error("there should be an event not found error:", err)
+			}
+			if _, err := store.LoadVersion(ctx, uuid.New(), 1); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+				t.Error("there should be an event not found error:", err)
+			}
+		})
+	}
+}
+
+func TestEventStoreCount(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if n, err := store.Count(ctx, id); err != nil || n != 0 {
+		t.Error("there should be no events:", n, err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if n, err := store.Count(ctx, id); err != nil || n != 2 {
+		t.Error("there should be two events:", n, err)
+	}
+}
+
+func TestEventStoreHas(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if ok, err := store.Has(ctx, id); err != nil || ok {
+		t.Error("the aggregate should not exist:", ok, err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if ok, err := store.Has(ctx, id); err != nil || !ok {
+		t.Error("the aggregate should exist:", ok, err)
+	}
+
+	db.AddHook(newFailingHook("exists", errors.New("connection lost"), 1))
+	if _, err := store.Has(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotLoadAggregate) {
+		t.Error("there should be a could not load error:", err)
+	}
+}
+
+func TestEventStoreSaveWithVersion(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	version, err := store.SaveWithVersion(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if version != 2 {
+		t.Error("the version after the save should be returned:", version)
+	}
+
+	version, err = store.SaveWithVersion(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1)
+	if !errors.Is(err, rediseventstore.ErrCouldNotSaveAggregate) {
+		t.Error("there should be a version conflict:", err)
+	}
+	if version != 0 {
+		t.Error("there should be no version:", version)
+	}
+
+	if _, err := store.SaveWithVersion(ctx, nil, 2); !errors.Is(err, eh.ErrNoEventsToAppend) {
+		t.Error("there should be a no events to append error:", err)
+	}
+}
+
+func TestEventStoreVersion(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"hash":          nil,
+		"sorted set":    {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+		"version field": {rediseventstore.WithVersionField()},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			if version, err := store.Version(ctx, id); err != nil || version != 0 {
+				t.Error("the version should be 0:", version, err)
+			}
+
+			for version := 1; version <= 3; version++ {
+				if err := store.Save(ctx, []eh.Event{
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, version)),
+				}, version-1); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			if version, err := store.Version(ctx, id); err != nil || version != 3 {
+				t.Error("the version should be 3:", version, err)
+			}
+
+			// Compacted events are counted.
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       3,
+				AggregateType: mocks.AggregateType,
+				Timestamp:     time.Now(),
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if _, err := store.Compact(ctx, id, 3); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if version, err := store.Version(ctx, id); err != nil || version != 3 {
+				t.Error("the version should still be 3:", version, err)
+			}
+		})
+	}
+}
+
+func TestEventStoreAggregateRecord(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testAggregateRecord(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testAggregateRecord(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testAggregateRecord(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, options...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if record, err := store.LoadAggregateRecord(ctx, id); err != nil || record != nil {
+		t.Error("there should be no record:", record, err)
+	}
+
+	for version := 1; version <= 3; version++ {
+		if err := store.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, version)),
+		}, version-1); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	record, err := store.LoadAggregateRecord(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := &rediseventstore.AggregateRecord{
+		Namespace:   "ns",
+		AggregateID: id,
+		Version:     3,
+	}
+	if record == nil || *record != *expected {
+		t.Error("the record should be the current version:", record)
+	}
+
+	// A failed save leaves the record unchanged.
+	_ = store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1)
+	if record, err := store.LoadAggregateRecord(ctx, id); err != nil || record.Version != 3 {
+		t.Error("the record should be unchanged:", record, err)
+	}
+
+	// The version is read from the record, not counted.
+	recordKey := "aggregate:ns:{" + id.String() + "}"
+	expected.Version = 5
+	if err := db.Set(ctx, recordKey, expected, 0).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if version, err := store.Version(ctx, id); err != nil || version != 5 {
+		t.Error("the version should be the version of the record:", version, err)
+	}
+	err = store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 4)),
+	}, 3)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	// Aggregates without a record are counted.
+	if err := db.Del(ctx, recordKey).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if version, err := store.Version(ctx, id); err != nil || version != 3 {
+		t.Error("the version should be counted:", version, err)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 4)),
+	}, 3); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if record, err := store.LoadAggregateRecord(ctx, id); err != nil || record.Version != 4 {
+		t.Error("the record should be written again:", record, err)
+	}
+
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if record, err := store.LoadAggregateRecord(ctx, id); err != nil || record != nil {
+		t.Error("the record should be cleared:", record, err)
+	}
+}
+
+func TestEventStoreAggregateIDs(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithOutboxStream("ns"))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	want := map[uuid.UUID]bool{}
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		want[id] = true
+		if err := store.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 1)),
+		}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if err := store.SaveSnapshot(ctx, uuid.New(), rediseventstore.Snapshot{Version: 1, State: "state"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	// Other keys matching the namespace pattern are skipped.
+	if err := db.Set(ctx, "ns:{other}", "value", 0).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer db.Del(ctx, "ns:{other}")
+
+	ids, err := store.AggregateIDs(ctx)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(ids) != len(want) {
+		t.Fatal("there should be three aggregate IDs:", ids)
+	}
+	for _, id := range ids {
+		if !want[id] {
+			t.Error("the aggregate ID should have been saved:", id)
+		}
+	}
+
+	ids, err = store.AggregateIDs(namespace.NewContext(context.Background(), "empty"))
+	if err != nil || len(ids) != 0 {
+		t.Error("there should be no aggregate IDs in another namespace:", ids, err)
+	}
+}
+
+func TestEventStoreOutboxStream(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		testOutboxStream(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testOutboxStream(t, rediseventstore.WithWatchSave())
+	})
+}
+
+func testOutboxStream(t *testing.T, options ...rediseventstore.Option) {
+	store, db := newEventStore(t, append(options, rediseventstore.WithOutboxStream("outbox"))...)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventOtherType, &mocks.EventData{Content: "other"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A conflicting save must not reach the outbox.
+	if err := store.Save(ctx, events[:1], 0); err == nil {
+		t.Fatal("there should be a version conflict")
+	}
+
+	entries, err := db.XRange(context.Background(), "outbox:ns", "-", "+").Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("there should be two outbox entries:", entries)
+	}
+	for i, entry := range entries {
+		if entry.Values["aggregate_id"] != id.String() {
+			t.Error("the aggregate ID should be correct:", entry.Values)
+		}
+		if entry.Values["version"] != fmt.Sprint(i+1) {
+			t.Error("the version should be correct:", entry.Values)
+		}
+		if entry.Values["event_type"] != events[i].EventType().String() {
+			t.Error("the event type should be correct:", entry.Values)
+		}
+	}
+	if entries[1].Values["data"] != `{"Content":"other"}` {
+		t.Error("the data should be correct:", entries[1].Values)
+	}
+}
+
+func TestEventStoreEmptyNamespace(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The empty namespace is the default namespace.
+	if n, err := db.Exists(ctx, ":{"+id.String()+"}").Result(); err != nil || n != 0 {
+		t.Error("there should be no key starting with a colon:", n, err)
+	}
+	if n, err := db.Exists(ctx, namespace.DefaultNamespace+":{"+id.String()+"}").Result(); err != nil || n != 1 {
+		t.Error("the aggregate should be stored in the default namespace:", n, err)
+	}
+	events, err := store.Load(context.Background(), id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the event should be loaded from the default namespace:", events)
+	}
+}
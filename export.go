@@ -0,0 +1,193 @@
+package ehpg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrCouldNotExportAggregate is when an aggregate could not be exported.
+var ErrCouldNotExportAggregate = errors.New("could not export aggregate")
+
+// ErrCouldNotImportAggregate is when an exported aggregate could not be
+// imported.
+var ErrCouldNotImportAggregate = errors.New("could not import aggregate")
+
+// Export writes all events of an aggregate to w as a JSON array of the stored
+// AggregateEvent records in version order, for example to attach the history
+// of an aggregate to a support ticket. The event data is exported as stored,
+// so compressed or encrypted data can only be loaded by stores with the same
+// configuration. It returns eh.ErrAggregateNotFound for aggregates without
+// events.
+func (s *EventStore) Export(ctx context.Context, id uuid.UUID, w io.Writer) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "Export",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotExportAggregate, func(ctx context.Context) (map[string]string, error) {
+			return s.loadAll(ctx, s.client(ns), s.aggregateKey(ns, id)).events()
+		})
+	}
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotExportAggregate,
+		}
+	} else if len(dbEvents) == 0 {
+		err = eh.EventStoreError{
+			Err: eh.ErrAggregateNotFound,
+		}
+	} else {
+		err = writeExport(w, dbEvents)
+	}
+	span.end(err, eventCountAttribute.Int(len(dbEvents)))
+	s.metrics.observe("export", ns, start, err)
+
+	return err
+}
+
+// writeExport writes the stored events to w as a JSON array in version order.
+func writeExport(w io.Writer, dbEvents map[string]string) error {
+	versions, err := exportVersions(dbEvents)
+	if err != nil {
+		return err
+	}
+
+	// The stored records are written as is, without decoding them.
+	if _, err := io.WriteString(w, "["); err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotExportAggregate,
+		}
+	}
+	for i, version := range versions {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return eh.EventStoreError{
+					BaseErr: err,
+					Err:     ErrCouldNotExportAggregate,
+				}
+			}
+		}
+		if _, err := io.WriteString(w, dbEvents[strconv.Itoa(version)]); err != nil {
+			return eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotExportAggregate,
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotExportAggregate,
+		}
+	}
+
+	return nil
+}
+
+// exportVersions returns the versions of the stored events in order.
+func exportVersions(dbEvents map[string]string) ([]int, error) {
+	versions := make([]int, 0, len(dbEvents))
+	for field := range dbEvents {
+		version, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: fmt.Errorf("invalid version %q", field),
+				Err:     ErrCouldNotExportAggregate,
+			}
+		}
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	return versions, nil
+}
+
+// Import saves the events of an aggregate exported with Export into the
+// namespace of the context, keeping their event IDs and stored data. The
+// events must be of a single aggregate with contiguous versions, and are
+// saved like Save after the version before the first event, so importing
+// fails with a version conflict when the aggregate already has other events.
+// An export of a compacted aggregate can be imported as a new aggregate, with
+// the versions before the first event stored as compacted, like Compact.
+func (s *EventStore) Import(ctx context.Context, r io.Reader) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "Import", namespaceAttribute.String(ns))
+	start := time.Now()
+
+	dbEvents, err := readExport(r, ns)
+	if err == nil {
+		err = s.checkBatchSize(len(dbEvents))
+	}
+	if err == nil {
+		err = s.checkWrite()
+	}
+	if err == nil {
+		err = s.checkNamespace(ns)
+	}
+	if err == nil {
+		_, err = withTimeout(ctx, s, ErrCouldNotSaveAggregate, func(ctx context.Context) (struct{}, error) {
+			return struct{}{}, s.saveDBEvents(ctx, ns, dbEvents[0].event.Version-1, dbEvents[0].event.Version-1, dbEvents)
+		})
+	}
+	span.end(err, eventCountAttribute.Int(len(dbEvents)))
+	s.metrics.observe("import", ns, start, err)
+
+	return err
+}
+
+// readExport reads the events of an export into the namespace, checking
+// them like Save does.
+func readExport(r io.Reader, ns string) ([]versionedEvent, error) {
+	var records []AggregateEvent
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotImportAggregate,
+		}
+	}
+
+	return importEvents(records, ns)
+}
+
+// importEvents returns the exported records of an aggregate as events of the
+// namespace, checking them like Save does.
+func importEvents(records []AggregateEvent, ns string) ([]versionedEvent, error) {
+	events := make([]eh.Event, 0, len(records))
+	dbEvents := make([]versionedEvent, 0, len(records))
+	for _, e := range records {
+		e.Namespace = ns
+		events = append(events, event{AggregateEvent: e})
+		dbEvents = append(dbEvents, versionedEvent{
+			field: strconv.Itoa(e.Version),
+			event: e,
+		})
+	}
+
+	originalVersion := 0
+	if len(records) > 0 {
+		originalVersion = records[0].Version - 1
+	}
+	if err := ValidateBatch(events, originalVersion); err != nil {
+		return nil, err
+	}
+
+	return dbEvents, nil
+}
@@ -0,0 +1,176 @@
+package ehpg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"io"
+	"strconv"
+	"time"
+)
+
+// exportNamespaceBatchSize is the number of keys scanned per round trip in
+// ExportNamespace.
+const exportNamespaceBatchSize = 100
+
+// ExportNamespace writes the events of all aggregates of the namespace to w as
+// newline delimited JSON, with a stored AggregateEvent record per line and the
+// events of an aggregate on consecutive lines in version order, for example to
+// back up a namespace or to copy it to another environment. The aggregates are
+// scanned and loaded one at a time, so besides the keys of the exported
+// aggregates, which are kept as SCAN may return a key more than once, only the
+// events of a single aggregate are held in memory. Like Export, the event data
+// is exported as stored. Aggregates saved while exporting may or may not be
+// exported.
+func (s *EventStore) ExportNamespace(ctx context.Context, w io.Writer) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "ExportNamespace", namespaceAttribute.String(ns))
+	start := time.Now()
+
+	n, err := s.exportNamespace(ctx, ns, w)
+	span.end(err, eventCountAttribute.Int(n))
+	s.metrics.observe("export_namespace", ns, start, err)
+
+	return err
+}
+
+// exportNamespace exports a namespace, see ExportNamespace. It returns the
+// number of exported events.
+func (s *EventStore) exportNamespace(ctx context.Context, ns string, w io.Writer) (int, error) {
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	seen := map[string]struct{}{}
+
+	err := s.scanKeys(ctx, ns, s.aggregateKey(ns, "*"), exportNamespaceBatchSize, func(keys []string) error {
+		for _, key := range keys {
+			// Skip keys in the pattern that are not aggregates, like streams.
+			if _, ok := seen[key]; ok || !s.isAggregateKey(ns, key) {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			dbEvents, err := withTimeout(ctx, s, ErrCouldNotExportAggregate, func(ctx context.Context) (map[string]string, error) {
+				return s.loadAll(ctx, s.client(ns), key).events()
+			})
+			if err != nil {
+				return err
+			}
+			versions, err := exportVersions(dbEvents)
+			if err != nil {
+				return err
+			}
+
+			// The stored records are written as is, without decoding them.
+			for _, version := range versions {
+				if _, err := bw.WriteString(dbEvents[strconv.Itoa(version)]); err != nil {
+					return err
+				}
+				if err := bw.WriteByte('\n'); err != nil {
+					return err
+				}
+			}
+			n += len(versions)
+		}
+		return nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return n, storeErr
+	} else if err != nil {
+		return n, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotExportAggregate,
+		}
+	}
+
+	return n, nil
+}
+
+// ImportNamespace saves the events of an export of ExportNamespace into the
+// namespace of the context, keeping their event IDs and stored data. The
+// aggregates are read and saved one at a time, like Import, so only the events
+// of a single aggregate are held in memory. The events of every aggregate are
+// checked like Save does, and an aggregate that already has other events fails
+// the import with a version conflict, keeping the aggregates imported before.
+// Compacted aggregates are imported as compacted, like Import does.
+func (s *EventStore) ImportNamespace(ctx context.Context, r io.Reader) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "ImportNamespace", namespaceAttribute.String(ns))
+	start := time.Now()
+
+	n, err := s.importNamespace(ctx, ns, r)
+	span.end(err, eventCountAttribute.Int(n))
+	s.metrics.observe("import_namespace", ns, start, err)
+
+	return err
+}
+
+// importNamespace imports a namespace, see ImportNamespace. It returns the
+// number of imported events.
+func (s *EventStore) importNamespace(ctx context.Context, ns string, r io.Reader) (int, error) {
+	if err := s.checkWrite(); err != nil {
+		return 0, err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var records []AggregateEvent
+	save := func() error {
+		if len(records) == 0 {
+			return nil
+		}
+
+		dbEvents, err := importEvents(records, ns)
+		if err == nil {
+			err = s.checkBatchSize(len(dbEvents))
+		}
+		if err == nil {
+			_, err = withTimeout(ctx, s, ErrCouldNotSaveAggregate, func(ctx context.Context) (struct{}, error) {
+				return struct{}{}, s.saveDBEvents(ctx, ns, dbEvents[0].event.Version-1, dbEvents[0].event.Version-1, dbEvents)
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		n += len(records)
+		records = records[:0]
+		return nil
+	}
+
+	// The events of an aggregate are on consecutive lines, so the events read
+	// are saved when the next aggregate starts.
+	dec := json.NewDecoder(r)
+	for {
+		e := AggregateEvent{}
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return n, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotImportAggregate,
+			}
+		}
+
+		if len(records) > 0 && e.AggregateID != records[0].AggregateID {
+			if err := save(); err != nil {
+				return n, err
+			}
+		}
+		records = append(records, e)
+	}
+
+	return n, save()
+}
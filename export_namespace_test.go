@@ -0,0 +1,107 @@
+package ehpg_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreExportImportNamespace(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithOutboxStream("outbox"))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+	otherCtx := namespace.NewContext(context.Background(), "other")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if err := store.Clear(otherCtx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for i, id := range ids {
+		for version := 1; version <= i+2; version++ {
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, version)),
+			}, version-1); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}
+	if err := store.SaveSnapshot(ctx, ids[0], rediseventstore.Snapshot{Version: 2, State: "state"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.ExportNamespace(ctx, &buf); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	export := buf.String()
+
+	// Every line is an event, with the events of an aggregate in order.
+	lines := 0
+	versions := map[uuid.UUID]int{}
+	scanner := bufio.NewScanner(strings.NewReader(export))
+	for scanner.Scan() {
+		lines++
+		e := rediseventstore.AggregateEvent{}
+		if err := e.UnmarshalBinary(scanner.Bytes()); err != nil {
+			t.Fatal("every line should be an event:", err)
+		}
+		if e.Version != versions[e.AggregateID]+1 {
+			t.Error("the events should be in version order:", e.AggregateID, e.Version)
+		}
+		versions[e.AggregateID] = e.Version
+	}
+	if lines != 9 || len(versions) != 3 {
+		t.Error("all events should be exported:", lines, versions)
+	}
+
+	if err := store.ImportNamespace(otherCtx, strings.NewReader(export)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i, id := range ids {
+		events, err := store.Load(otherCtx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != i+2 {
+			t.Error("all events should be imported:", events)
+		}
+	}
+
+	// Importing into aggregates with events conflicts.
+	err := store.ImportNamespace(otherCtx, strings.NewReader(export))
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	if err := store.ImportNamespace(otherCtx, strings.NewReader("not json")); !errors.Is(err, rediseventstore.ErrCouldNotImportAggregate) {
+		t.Error("there should be an import error:", err)
+	}
+	id := uuid.New().String()
+	gap := `{"aid":"` + id + `","v":1}` + "\n" + `{"aid":"` + id + `","v":3}` + "\n"
+	if err := store.ImportNamespace(otherCtx, strings.NewReader(gap)); !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be an incorrect version error:", err)
+	}
+
+	// An empty namespace exports nothing.
+	buf.Reset()
+	if err := store.ExportNamespace(namespace.NewContext(context.Background(), "empty"), &buf); err != nil || buf.Len() != 0 {
+		t.Error("there should be no events:", buf.String(), err)
+	}
+}
@@ -0,0 +1,183 @@
+package ehpg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportedEventType is a second event type with registered event data, unlike
+// mocks.EventOtherType, so that the exported events can be loaded.
+const exportedEventType eh.EventType = "ExportedEvent"
+
+func init() {
+	eh.RegisterEventData(exportedEventType, func() eh.EventData {
+		return &mocks.EventData{}
+	})
+}
+
+func TestEventStoreExportImport(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+	otherCtx := namespace.NewContext(context.Background(), "other")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if err := store.Clear(otherCtx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+		eh.NewEvent(exportedEventType, &mocks.EventData{Content: "event3"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.Export(ctx, id, &buf); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	export := buf.String()
+
+	var records []rediseventstore.AggregateEvent
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatal("the export should be a JSON array:", err)
+	}
+	for i, record := range records {
+		if record.Version != i+1 || len(record.RawEventData) == 0 {
+			t.Error("the export should have the records in version order:", record)
+		}
+	}
+
+	if err := store.Import(otherCtx, strings.NewReader(export)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	imported, err := store.Load(otherCtx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(imported) != len(events) {
+		t.Fatal("all events should be imported:", len(imported))
+	}
+	for i, e := range imported {
+		if e.(interface{ EventID() uuid.UUID }).EventID() != events[i].(interface{ EventID() uuid.UUID }).EventID() ||
+			e.EventType() != events[i].EventType() ||
+			e.Data().(*mocks.EventData).Content != events[i].Data().(*mocks.EventData).Content {
+			t.Error("the imported event should equal the exported event:", e, events[i])
+		}
+	}
+
+	// Importing into an aggregate with events conflicts.
+	err = store.Import(otherCtx, strings.NewReader(export))
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	if err := store.Import(otherCtx, strings.NewReader("not json")); !errors.Is(err, rediseventstore.ErrCouldNotImportAggregate) {
+		t.Error("there should be an import error:", err)
+	}
+	if err := store.Import(otherCtx, strings.NewReader(`[{"Version":1},{"Version":3}]`)); !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be an incorrect version error:", err)
+	}
+
+	if err := store.Export(ctx, uuid.New(), &buf); !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be an aggregate not found error:", err)
+	}
+}
+
+func TestEventStoreImportCompacted(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":        nil,
+		"watch":         {rediseventstore.WithWatchSave()},
+		"sorted set":    {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+		"key per event": {rediseventstore.WithStorageMode(rediseventstore.KeyPerEventStorage)},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+			otherCtx := namespace.NewContext(context.Background(), "other")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if err := store.Clear(otherCtx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			newEvent := func(version int) eh.Event {
+				return eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, version))
+			}
+			if err := store.Save(ctx, []eh.Event{newEvent(1), newEvent(2), newEvent(3)}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       3,
+				AggregateType: mocks.AggregateType,
+				Timestamp:     time.Now(),
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if _, err := store.Compact(ctx, id, 3); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			var buf bytes.Buffer
+			if err := store.Export(ctx, id, &buf); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			export := buf.String()
+
+			// The versions before the export are compacted in the new aggregate.
+			if err := store.Import(otherCtx, strings.NewReader(export)); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if events, err := store.Load(otherCtx, id); err != nil || len(events) != 1 || events[0].Version() != 3 {
+				t.Error("the exported event should be imported:", events, err)
+			}
+			if version, err := store.Version(otherCtx, id); err != nil || version != 3 {
+				t.Error("the version should include the compacted events:", version, err)
+			}
+			if err := store.Save(otherCtx, []eh.Event{newEvent(4)}, 3); err != nil {
+				t.Error("there should be no error:", err)
+			}
+
+			err := store.Import(otherCtx, strings.NewReader(export))
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+		})
+	}
+}
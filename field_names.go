@@ -0,0 +1,77 @@
+package ehpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"time"
+)
+
+// WithLegacyFieldNames stores events with the long field names of earlier
+// versions, like "AggregateType" and "RawEventData", instead of the short
+// names. Events with either names are always loaded, so this is only needed
+// while instances of earlier versions still load the aggregates, for example
+// during a rolling upgrade.
+func WithLegacyFieldNames() Option {
+	return func(s *EventStore) error {
+		s.legacyNames = true
+
+		return nil
+	}
+}
+
+// shortEvent is an AggregateEvent without its methods, to marshal and
+// unmarshal it with the short field names of its json tags.
+type shortEvent AggregateEvent
+
+// legacyEvent is an AggregateEvent with the long field names events were
+// stored with before the short names. Its fields must match the fields of
+// AggregateEvent for the conversion between both.
+type legacyEvent struct {
+	EventID          uuid.UUID
+	Namespace        string
+	AggregateID      uuid.UUID
+	AggregateType    eh.AggregateType
+	EventType        eh.EventType
+	RawEventData     json.RawMessage `json:",omitempty"`
+	Timestamp        time.Time
+	Version          int
+	MetaData         map[string]interface{}
+	data             eh.EventData
+	RawMetaData      json.RawMessage
+	BinaryEventData  []byte `json:",omitempty"`
+	BinaryMetaData   []byte `json:",omitempty"`
+	EncodedMetaData  []byte `json:",omitempty"`
+	MetaDataEncoding string `json:",omitempty"`
+	EncryptionKeyID  string `json:",omitempty"`
+	PayloadHash      string `json:",omitempty"`
+	PayloadRef       int    `json:",omitempty"`
+	payload          []byte
+	legacyNames      bool
+}
+
+// legacyPrefix is the start of the events marshaled with the long field
+// names, which always begin with the event ID.
+var legacyPrefix = []byte(`{"EventID":`)
+
+// UnmarshalJSON unmarshals an event stored with the short or the long field
+// names.
+func (a *AggregateEvent) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(data, legacyPrefix) {
+		err := json.Unmarshal(data, (*shortEvent)(a))
+		if err != nil || a.Version != 0 || a.AggregateID != uuid.Nil {
+			return err
+		}
+	}
+
+	// Events of other sources, like edited exports, may have the long names
+	// in another order, which leaves the short fields empty.
+	legacy := legacyEvent{}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*a = AggregateEvent(legacy)
+
+	return nil
+}
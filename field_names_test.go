@@ -0,0 +1,118 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreFieldNames(t *testing.T) {
+	store, db := newEventStore(t)
+	legacy, _ := newEventStore(t, rediseventstore.WithLegacyFieldNames())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := legacy.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "legacy"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1),
+			eh.WithMetadata(map[string]interface{}{"user": "legacy"})),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "short"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2),
+			eh.WithMetadata(map[string]interface{}{"user": "short"})),
+	}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	raws, err := db.HMGet(ctx, "ns:{"+id.String()+"}", "1", "2").Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if raw := raws[0].(string); !strings.Contains(raw, `"AggregateType":`) {
+		t.Error("the event should be stored with the long field names:", raw)
+	}
+	if raw := raws[1].(string); !strings.HasPrefix(raw, `{"id":`) || strings.Contains(raw, "AggregateType") {
+		t.Error("the event should be stored with the short field names:", raw)
+	}
+
+	// Both stores load events with either field names.
+	for _, s := range []*rediseventstore.EventStore{store, legacy} {
+		events, err := s.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != 2 {
+			t.Fatal("there should be two events:", events)
+		}
+		for i, content := range []string{"legacy", "short"} {
+			if events[i].AggregateID() != id || events[i].Version() != i+1 {
+				t.Error("the event should be for the aggregate:", events[i])
+			}
+			if data, ok := events[i].Data().(*mocks.EventData); !ok || data.Content != content {
+				t.Error("the event data should be loaded:", events[i].Data())
+			}
+			if user := events[i].Metadata()["user"]; user != content {
+				t.Error("the meta data should be loaded:", user)
+			}
+		}
+	}
+}
+
+func BenchmarkEventStoreFieldNames(b *testing.B) {
+	const events = 1000
+
+	testCases := map[string][]rediseventstore.Option{
+		"short":  nil,
+		"legacy": {rediseventstore.WithLegacyFieldNames()},
+	}
+
+	for name, options := range testCases {
+		b.Run(name, func(b *testing.B) {
+			store, db := newEventStore(b, options...)
+
+			ctx := namespace.NewContext(context.Background(), "bench")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					b.Fatal("there should be no error:", err)
+				}
+			}()
+
+			var size int64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := uuid.New()
+				batch := make([]eh.Event, 0, events)
+				for version := 1; version <= events; version++ {
+					batch = append(batch, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+						eh.ForAggregate(mocks.AggregateType, id, version)))
+				}
+				if err := store.Save(ctx, batch, 0); err != nil {
+					b.Fatal("there should be no error:", err)
+				}
+
+				size = 0
+				for _, raw := range db.HVals(context.Background(), "bench:{"+id.String()+"}").Val() {
+					size += int64(len(raw))
+				}
+			}
+			b.ReportMetric(float64(size), "stored-bytes/aggregate")
+		})
+	}
+}
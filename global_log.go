@@ -0,0 +1,147 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// ErrGlobalLogDisabled is when the global log is read without WithGlobalLog.
+var ErrGlobalLogDisabled = errors.New("global log is disabled")
+
+// WithGlobalLog appends a pointer to every saved event to the stream
+// global:{namespace}, in the same atomic write as the events, so that all
+// events of the namespace can be read in the order they were saved with
+// ReadGlobal. The global log is not supported on Redis Cluster, as the stream
+// is in another slot than the aggregates. The stream is not trimmed.
+func WithGlobalLog() Option {
+	return func(s *EventStore) error {
+		s.globalLog = true
+
+		return nil
+	}
+}
+
+// GlobalEvent is an event in the global log.
+type GlobalEvent struct {
+	// Position is the stream entry ID of the event in the global log, which
+	// increases monotonically.
+	Position string
+	Event    eh.Event
+}
+
+// globalLogValues returns the global log stream entry of an event.
+func globalLogValues(e AggregateEvent) []interface{} {
+	return []interface{}{
+		"aggregate_id", e.AggregateID.String(),
+		"version", e.Version,
+	}
+}
+
+// ReadGlobal reads up to count events of the namespace from the global log,
+// in the order they were saved, starting after the position from. An empty
+// from reads from the start, and reading continues after the position of the
+// last returned event. Events of aggregates that have expired or were cleared
+// are skipped. Fewer than count events are only returned at the end of the
+// log. It requires WithGlobalLog.
+func (s *EventStore) ReadGlobal(ctx context.Context, from string, count int64) ([]GlobalEvent, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "ReadGlobal", namespaceAttribute.String(ns))
+	start := time.Now()
+	events, err := withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) ([]GlobalEvent, error) {
+		return s.readGlobal(ctx, ns, from, count)
+	})
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("read_global", ns, len(events), start, err)
+
+	return events, err
+}
+
+// readGlobal reads events from the global log, see ReadGlobal.
+func (s *EventStore) readGlobal(ctx context.Context, ns string, from string, count int64) ([]GlobalEvent, error) {
+	if !s.globalLog {
+		return nil, eh.EventStoreError{
+			Err: ErrGlobalLogDisabled,
+		}
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	var events []GlobalEvent
+	for int64(len(events)) < count {
+		start := "-"
+		if from != "" {
+			start = "(" + from
+		}
+		entries, err := s.client(ns).XRangeN(ctx, s.globalLogKey(ns), start, "+", count-int64(len(events))).Result()
+		if err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		batch, err := s.loadGlobalEntries(ctx, ns, entries)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+		from = entries[len(entries)-1].ID
+	}
+
+	return events, nil
+}
+
+// loadGlobalEntries loads the events of global log entries in one round
+// trip, skipping the events that no longer exist.
+func (s *EventStore) loadGlobalEntries(ctx context.Context, ns string, entries []redis.XMessage) ([]GlobalEvent, error) {
+	cmds := make([]eventsCmd, len(entries))
+	fields := make([]string, len(entries))
+	_, err := s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			aggregateID, _ := entry.Values["aggregate_id"].(string)
+			fields[i], _ = entry.Values["version"].(string)
+			version, _ := strconv.Atoi(fields[i])
+			cmds[i] = s.loadRange(ctx, pipe, s.aggregateKey(ns, aggregateID), version, version)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	events := make([]GlobalEvent, 0, len(entries))
+	for i, cmd := range cmds {
+		dbEvents, err := cmd.events()
+		dbEvent, ok := dbEvents[fields[i]]
+		if err == nil && !ok {
+			continue
+		} else if err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+
+		e, err := s.decodeEvent(dbEvent)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, GlobalEvent{
+			Position: entries[i].ID,
+			Event:    e,
+		})
+	}
+
+	return events, nil
+}
@@ -0,0 +1,104 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreReadGlobal(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":       nil,
+		"watch":        {rediseventstore.WithWatchSave()},
+		"script index": {rediseventstore.WithEventIndex(), rediseventstore.WithOutboxStream("outbox")},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, append(options, rediseventstore.WithGlobalLog())...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if n := db.Exists(context.Background(), "global:ns").Val(); n != 0 {
+					t.Error("the global log should be cleared")
+				}
+			}()
+
+			// Interleave the events of three aggregates.
+			ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+			type saved struct {
+				id      uuid.UUID
+				version int
+			}
+			var order []saved
+			for version := 1; version <= 2; version++ {
+				for _, id := range ids {
+					if err := store.Save(ctx, []eh.Event{
+						eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+							eh.ForAggregate(mocks.AggregateType, id, version)),
+					}, version-1); err != nil {
+						t.Fatal("there should be no error:", err)
+					}
+					order = append(order, saved{id, version})
+				}
+			}
+
+			// The events of an expired aggregate are skipped.
+			db.Del(context.Background(), "ns:{"+ids[1].String()+"}")
+			var expected []saved
+			for _, e := range order {
+				if e.id != ids[1] {
+					expected = append(expected, e)
+				}
+			}
+
+			var read []saved
+			from := ""
+			for {
+				events, err := store.ReadGlobal(ctx, from, 3)
+				if err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				for _, e := range events {
+					if e.Position == "" || e.Position == from {
+						t.Error("the event should have a new position:", e.Position)
+					}
+					from = e.Position
+					read = append(read, saved{e.Event.AggregateID(), e.Event.Version()})
+				}
+				if len(events) < 3 {
+					break
+				}
+			}
+
+			if len(read) != len(expected) {
+				t.Fatal("all events should be read:", read)
+			}
+			for i := range expected {
+				if read[i] != expected[i] {
+					t.Error("the events should be read in save order:", i, read[i], expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEventStoreReadGlobalDisabled(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	if _, err := store.ReadGlobal(ctx, "", 10); !errors.Is(err, rediseventstore.ErrGlobalLogDisabled) {
+		t.Error("there should be a global log disabled error:", err)
+	}
+}
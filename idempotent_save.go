@@ -0,0 +1,69 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"strconv"
+)
+
+// WithIdempotentSave makes saving already saved events a successful no-op, so
+// that commands can be rerun when a message is delivered more than once.
+// Events implementing EventID() uuid.UUID, like the events loaded from the
+// store, are saved with that ID instead of a new one. When a save conflicts
+// and every event of the batch is stored at its version with the same event
+// ID, the save succeeds without writing. Events without an ID still conflict.
+//
+// This also makes a retry of WithSaveRetries succeed when the first attempt
+// was saved before the connection was lost.
+func WithIdempotentSave() Option {
+	return func(s *EventStore) error {
+		s.idempotentSave = true
+
+		return nil
+	}
+}
+
+// eventIDer is implemented by events with an event ID.
+type eventIDer interface {
+	EventID() uuid.UUID
+}
+
+// isReplay returns true when all events of a batch are stored with the same
+// versions and event IDs, which are then saved already.
+func (s *EventStore) isReplay(ctx context.Context, ns, key string, dbEvents []versionedEvent) (bool, error) {
+	from, to := dbEvents[0].event.Version, dbEvents[len(dbEvents)-1].event.Version
+	stored, err := s.loadRange(ctx, s.client(ns), key, from, to).events()
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range dbEvents {
+		raw, ok := stored[strconv.Itoa(e.event.Version)]
+		if !ok {
+			return false, nil
+		}
+
+		storedEvent := AggregateEvent{}
+		if err := storedEvent.UnmarshalBinary([]byte(raw)); err != nil {
+			return false, err
+		}
+		if storedEvent.EventID != e.event.EventID {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// replayed returns true when a save failing with err can be treated as
+// successful, see WithIdempotentSave.
+func (s *EventStore) replayed(ctx context.Context, ns, key string, dbEvents []versionedEvent, err error) bool {
+	if !s.idempotentSave || !errors.Is(err, ErrVersionConflict) {
+		return false
+	}
+
+	replay, loadErr := s.isReplay(ctx, ns, key, dbEvents)
+
+	return loadErr == nil && replay
+}
@@ -0,0 +1,119 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreIdempotentSave(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script":            nil,
+		"watch":             {rediseventstore.WithWatchSave()},
+		"script sorted set": {rediseventstore.WithStorageMode(rediseventstore.SortedSetStorage)},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newEventStore(t, append(options, rediseventstore.WithIdempotentSave())...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			saved, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			// Replaying the saved events is a no-op.
+			if err := store.Save(ctx, saved, 0); err != nil {
+				t.Error("there should be no error:", err)
+			}
+			if err := store.Save(ctx, saved[1:], 1); err != nil {
+				t.Error("there should be no error:", err)
+			}
+
+			// Events with other event IDs conflict.
+			err = store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+			}, 0)
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+
+			// A batch that is only partly saved conflicts.
+			err = store.Save(ctx, append(saved[1:], eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 3))), 1)
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 2 {
+				t.Fatal("there should be 2 events:", len(events))
+			}
+			for i, e := range events {
+				if e.(interface{ EventID() uuid.UUID }).EventID() != saved[i].(interface{ EventID() uuid.UUID }).EventID() {
+					t.Error("the stored event should not change:", e)
+				}
+			}
+		})
+	}
+}
+
+func TestEventStoreSaveWithoutIdempotentSave(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	saved, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	err = store.Save(ctx, saved, 0)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Error("there should be a version conflict:", err)
+	}
+}
@@ -6,19 +6,52 @@ import (
 	eh "github.com/looplab/eventhorizon"
 )
 
+// Encoder marshals and unmarshals event data for storage. Custom encoders, for
+// example msgpack or CBOR, are set with WithEncoder.
+//
+// Unmarshal should create the concrete event data for an event type with
+// eh.CreateEventData, which resolves the factories registered with
+// eh.RegisterEventData, the same registry the default JSON encoder uses.
 type Encoder interface {
+	// Marshal marshals the event data, returning nil for nil data.
 	Marshal(eh.EventData) ([]byte, error)
+	// Unmarshal unmarshals the raw data into the event data of the event type.
 	Unmarshal(eh.EventType, []byte) (eh.EventData, error)
+	// String returns the name of the encoding. Data of the "json" encoding is
+	// embedded as JSON in the stored event, any other encoding is stored as
+	// binary data.
 	String() string
 }
 
-type jsonEncoder struct{}
+// NewJSONEncoder returns the default Encoder, marshaling event data as JSON.
+// The options configure the json.Encoder marshaling the data, for example
+// with SetEscapeHTML(false). Unmarshaling is not affected by the options.
+func NewJSONEncoder(options ...func(*json.Encoder)) Encoder {
+	return &jsonEncoder{options: options}
+}
+
+type jsonEncoder struct {
+	options []func(*json.Encoder)
+}
 
-func (jsonEncoder) Marshal(data eh.EventData) ([]byte, error) {
-	if data != nil {
+func (e jsonEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	} else if len(e.options) == 0 {
 		return json.Marshal(data)
 	}
-	return nil, nil
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, option := range e.options {
+		option(enc)
+	}
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+
+	// Encode terminates the value with a newline, unlike Marshal.
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 func (jsonEncoder) Unmarshal(eventType eh.EventType, raw []byte) (data eh.EventData, err error) {
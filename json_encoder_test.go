@@ -0,0 +1,114 @@
+package ehpg_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+const initializedEventType eh.EventType = "InitializedEvent"
+
+func init() {
+	eh.RegisterEventData(initializedEventType, func() eh.EventData {
+		return &mocks.EventData{Content: "default"}
+	})
+}
+
+func TestJSONEncoderUnmarshal(t *testing.T) {
+	encoder := rediseventstore.NewJSONEncoder()
+
+	// Every decode creates new event data.
+	first, err := encoder.Unmarshal(mocks.EventType, []byte(`{"Content":"first"}`))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	second, err := encoder.Unmarshal(mocks.EventType, []byte(`{"Content":"second"}`))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if first.(*mocks.EventData).Content != "first" || second.(*mocks.EventData).Content != "second" {
+		t.Error("the data should be decoded into new event data:", first, second)
+	}
+
+	// The data is created by the registered factory.
+	for i := 0; i < 2; i++ {
+		data, err := encoder.Unmarshal(initializedEventType, []byte(`{}`))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if data.(*mocks.EventData).Content != "default" {
+			t.Error("the data should be created by the factory:", data)
+		}
+	}
+
+	if _, err := encoder.Unmarshal("Unregistered", []byte(`{}`)); err == nil {
+		t.Error("there should be an error for an unregistered event type")
+	}
+}
+
+func TestEventStoreJSONOptions(t *testing.T) {
+	escaping, db := newEventStore(t)
+	store, _ := newEventStore(t, rediseventstore.WithJSONOptions(func(enc *json.Encoder) {
+		enc.SetEscapeHTML(false)
+	}))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	const url = "https://example.com/?a=1&b=<2>"
+	for _, s := range []*rediseventstore.EventStore{escaping, store} {
+		id := uuid.New()
+		if err := s.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: url}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 1)),
+		}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+
+		raw := db.HGet(context.Background(), "ns:{"+id.String()+"}", "1").Val()
+		if escaped := strings.Contains(raw, `\u0026`); escaped != (s == escaping) {
+			t.Error("the data should only be HTML escaped by default:", raw)
+		}
+
+		// Both stores load escaped and unescaped data.
+		for _, loader := range []*rediseventstore.EventStore{escaping, store} {
+			events, err := loader.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 1 || events[0].Data().(*mocks.EventData).Content != url {
+				t.Error("the data should be loaded:", events)
+			}
+		}
+	}
+}
+
+// BenchmarkJSONEncoderUnmarshal measures 100k decodes. eventhorizon only
+// exposes the event data registry through eh.CreateEventData, and the one
+// allocation per decode is the event data created by the factory, so caching
+// the types of the event data would not reduce the allocations.
+func BenchmarkJSONEncoderUnmarshal(b *testing.B) {
+	raw := []byte(`{"Content":"event"}`)
+	encoder := rediseventstore.NewJSONEncoder()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100000; j++ {
+			if _, err := encoder.Unmarshal(mocks.EventType, raw); err != nil {
+				b.Fatal("there should be no error:", err)
+			}
+		}
+	}
+}
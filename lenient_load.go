@@ -0,0 +1,42 @@
+package ehpg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SkippedEventsError is returned with the decoded events by loads with
+// WithLenientLoad when some events could not be decoded, with the error of
+// every skipped event by version.
+type SkippedEventsError struct {
+	Errors map[int]error
+}
+
+// Error implements the Error method of the error interface.
+func (e SkippedEventsError) Error() string {
+	versions := make([]int, 0, len(e.Errors))
+	for version := range e.Errors {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	msgs := make([]string, 0, len(versions))
+	for _, version := range versions {
+		msgs = append(msgs, fmt.Sprintf("version %d: %s", version, e.Errors[version]))
+	}
+
+	return fmt.Sprintf("skipped %d events: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// WithLenientLoad skips events that can't be decoded when loading aggregates,
+// instead of failing the whole load. The decoded events are returned with a
+// SkippedEventsError, and the skipped events are logged, so that an aggregate
+// with a poison event can be loaded until the event is fixed with Replace.
+func WithLenientLoad() Option {
+	return func(s *EventStore) error {
+		s.lenientLoad = true
+
+		return nil
+	}
+}
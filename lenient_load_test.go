@@ -0,0 +1,90 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLenientLoad(t *testing.T) {
+	strict, db := newEventStore(t)
+	store, _ := newEventStore(t, rediseventstore.WithLenientLoad())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Poison the second event with data that can't be decoded.
+	if err := db.HSet(context.Background(), "ns:{"+id.String()+"}", "2",
+		`{"EventType":"Unregistered","Version":2,"RawEventData":{"Content":"poison"}}`).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if _, err := strict.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUnmarshalEvent) {
+		t.Error("there should be an unmarshal error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	var skippedErr rediseventstore.SkippedEventsError
+	if !errors.As(err, &skippedErr) {
+		t.Fatal("there should be a skipped events error:", err)
+	}
+	if _, ok := skippedErr.Errors[2]; !ok || len(skippedErr.Errors) != 1 {
+		t.Error("the poison event should be skipped:", skippedErr)
+	}
+	if len(events) != 2 || events[0].Version() != 1 || events[1].Version() != 3 {
+		t.Error("the other events should be loaded:", events)
+	}
+
+	events, err = store.LoadFrom(ctx, id, 2)
+	if !errors.As(err, &skippedErr) {
+		t.Fatal("there should be a skipped events error:", err)
+	}
+	if len(events) != 1 || events[0].Version() != 3 {
+		t.Error("the other events should be loaded:", events)
+	}
+
+	aggregates, err := store.LoadMany(ctx, []uuid.UUID{id})
+	var loadManyErr rediseventstore.LoadManyError
+	if !errors.As(err, &loadManyErr) || !errors.As(loadManyErr.Errors[id], &skippedErr) {
+		t.Fatal("there should be a skipped events error:", err)
+	}
+	if len(aggregates[id]) != 2 {
+		t.Error("the other events should be loaded:", aggregates[id])
+	}
+
+	// The poison event can be fixed.
+	if err := store.Replace(ctx, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "fixed"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 2))); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err = store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 3 {
+		t.Error("all events should be loaded:", events)
+	}
+}
@@ -0,0 +1,47 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"time"
+)
+
+// LoadFiltered loads the events of an aggregate like Load, but only returns
+// the events whose meta data passes the filter, for example to skip events
+// flagged as internal in projections. The filter is called with the decoded
+// meta data before the event data is decoded, so the data of skipped events is
+// never decoded. The meta data of events without meta data is nil.
+func (s *EventStore) LoadFiltered(ctx context.Context, id uuid.UUID, filter func(meta map[string]interface{}) bool) ([]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadFiltered",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (map[string]string, error) {
+			return s.loadAll(ctx, s.client(ns), s.aggregateKey(ns, id)).events()
+		})
+	}
+
+	var events []eh.Event
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else {
+		events, err = s.loadEvents(dbEvents, 1, filter)
+	}
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("load_filtered", ns, len(events), start, err)
+
+	return events, err
+}
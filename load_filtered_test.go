@@ -0,0 +1,74 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadFiltered(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// The data of an unregistered event type can't be decoded, which is not
+	// needed for filtered events.
+	const unregisteredEventType eh.EventType = "UnregisteredEvent"
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(unregisteredEventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2),
+			eh.WithMetadata(map[string]interface{}{"internal": true})),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3),
+			eh.WithMetadata(map[string]interface{}{"internal": false})),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var calls int
+	events, err := store.LoadFiltered(ctx, id, func(meta map[string]interface{}) bool {
+		calls++
+		return meta["internal"] != true
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if calls != 3 {
+		t.Error("the filter should be called for every event:", calls)
+	}
+	if len(events) != 2 || events[0].Version() != 1 || events[1].Version() != 3 {
+		t.Fatal("the internal event should be skipped:", events)
+	}
+	if data, ok := events[1].Data().(*mocks.EventData); !ok || data.Content != "event3" {
+		t.Error("the event data should be decoded:", events[1].Data())
+	}
+	if events[1].Metadata()["internal"] != false {
+		t.Error("the event should have the meta data:", events[1].Metadata())
+	}
+
+	if _, err := store.LoadFiltered(ctx, id, func(map[string]interface{}) bool { return true }); err == nil {
+		t.Error("the data of the unregistered event should not be decodable")
+	}
+
+	events, err = store.LoadFiltered(ctx, uuid.New(), func(map[string]interface{}) bool { return true })
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 0 {
+		t.Error("there should be no events:", events)
+	}
+}
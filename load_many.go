@@ -0,0 +1,78 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strings"
+)
+
+// LoadManyError is returned by LoadMany when some of the aggregates could not
+// be loaded, with the error of every failed aggregate.
+type LoadManyError struct {
+	Errors map[uuid.UUID]error
+}
+
+// Error implements the Error method of the error interface.
+func (e LoadManyError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for id, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", id, err))
+	}
+	sort.Strings(msgs)
+
+	return fmt.Sprintf("could not load %d aggregates: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// LoadMany loads all events of the aggregates, fetching all aggregates in a
+// single pipeline. The events are returned by aggregate ID, like Load with no
+// events for aggregates that don't exist. When some aggregates could not be
+// loaded, the events of the other aggregates are returned with a
+// LoadManyError.
+func (s *EventStore) LoadMany(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	cmds := make([]eventsCmd, len(ids))
+	// The errors of the commands are handled per aggregate below.
+	_, _ = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = s.loadAll(ctx, pipe, s.aggregateKey(ns, id))
+		}
+		return nil
+	})
+
+	aggregates := make(map[uuid.UUID][]eh.Event, len(ids))
+	errs := map[uuid.UUID]error{}
+	for i, id := range ids {
+		dbEvents, err := cmds[i].events()
+		if err != nil {
+			errs[id] = eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+			continue
+		}
+
+		events, err := s.loadEvents(dbEvents, 1, nil)
+		if err != nil {
+			errs[id] = err
+		}
+		// With WithLenientLoad the decoded events are returned with the error.
+		if err == nil || events != nil {
+			aggregates[id] = events
+		}
+	}
+
+	if len(errs) > 0 {
+		return aggregates, LoadManyError{Errors: errs}
+	}
+
+	return aggregates, nil
+}
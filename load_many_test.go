@@ -0,0 +1,66 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadMany(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	for i, id := range ids {
+		var events []eh.Event
+		for version := 1; version <= i+1; version++ {
+			events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, version)))
+		}
+		if err := store.Save(ctx, events, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	missing := uuid.New()
+	aggregates, err := store.LoadMany(ctx, append(ids, missing))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(aggregates[ids[0]]) != 1 || len(aggregates[ids[1]]) != 2 {
+		t.Error("the events should be loaded per aggregate:", aggregates)
+	}
+	if events, ok := aggregates[missing]; !ok || len(events) != 0 {
+		t.Error("there should be no events for a missing aggregate:", events)
+	}
+
+	// A corrupt aggregate fails without failing the others.
+	corrupt := uuid.New()
+	if err := db.HSet(ctx, "ns:{"+corrupt.String()+"}", "1", "corrupt").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	aggregates, err = store.LoadMany(ctx, append(ids, corrupt))
+	var loadErr rediseventstore.LoadManyError
+	if !errors.As(err, &loadErr) {
+		t.Fatal("there should be a load many error:", err)
+	}
+	if len(loadErr.Errors) != 1 || !errors.Is(loadErr.Errors[corrupt], rediseventstore.ErrCouldNotUnmarshalEvent) {
+		t.Error("the corrupt aggregate should fail:", loadErr.Errors)
+	}
+	if len(aggregates[ids[0]]) != 1 || len(aggregates[ids[1]]) != 2 {
+		t.Error("the other aggregates should be loaded:", aggregates)
+	}
+}
@@ -0,0 +1,95 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"sort"
+	"time"
+)
+
+// EventHeader is a stored event without its event data.
+type EventHeader struct {
+	EventID       uuid.UUID
+	Namespace     string
+	AggregateID   uuid.UUID
+	AggregateType eh.AggregateType
+	// EventType is the type the event is stored with, before upcasting.
+	EventType eh.EventType
+	Version   int
+	Timestamp time.Time
+	MetaData  map[string]interface{}
+}
+
+// LoadMetadata loads the headers of all events of an aggregate, sorted by
+// version, without decoding the event data, for example for audit views of
+// events with large data. It returns no headers for an aggregate that does
+// not exist.
+func (s *EventStore) LoadMetadata(ctx context.Context, id uuid.UUID) ([]EventHeader, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadMetadata",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (map[string]string, error) {
+			return s.loadAll(ctx, s.client(ns), s.aggregateKey(ns, id)).events()
+		})
+	}
+
+	var headers []EventHeader
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else {
+		headers, err = s.decodeHeaders(dbEvents)
+	}
+
+	span.end(err, eventCountAttribute.Int(len(headers)))
+	s.metrics.observe("load_metadata", ns, start, err)
+
+	return headers, err
+}
+
+// decodeHeaders decodes the headers of the stored events, sorted ascending by
+// version.
+func (s *EventStore) decodeHeaders(dbEvents map[string]string) ([]EventHeader, error) {
+	headers := make([]EventHeader, 0, len(dbEvents))
+	for _, dbEvent := range dbEvents {
+		e := AggregateEvent{}
+		if err := e.UnmarshalBinary([]byte(dbEvent)); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalEvent,
+			}
+		}
+		if err := s.decodeMetadata(&e); err != nil {
+			return nil, err
+		}
+
+		headers = append(headers, EventHeader{
+			EventID:       e.EventID,
+			Namespace:     e.Namespace,
+			AggregateID:   e.AggregateID,
+			AggregateType: e.AggregateType,
+			EventType:     e.EventType,
+			Version:       e.Version,
+			Timestamp:     e.Timestamp,
+			MetaData:      e.MetaData,
+		})
+	}
+
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Version < headers[j].Version
+	})
+	return headers, nil
+}
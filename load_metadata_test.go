@@ -0,0 +1,78 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadMetadata(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// The data of an unregistered event type can't be decoded, which
+	// LoadMetadata doesn't need.
+	const unregisteredEventType eh.EventType = "UnregisteredEvent"
+
+	id := uuid.New()
+	timestamp := time.Now().UTC().Truncate(time.Millisecond)
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(unregisteredEventType, &mocks.EventData{Content: "event1"}, timestamp,
+			eh.ForAggregate(mocks.AggregateType, id, 1),
+			eh.WithMetadata(map[string]interface{}{"user": "alice"})),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, timestamp,
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(ctx, id); err == nil {
+		t.Fatal("the event data should not be decodable")
+	}
+
+	headers, err := store.LoadMetadata(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(headers) != 2 {
+		t.Fatal("there should be two headers:", headers)
+	}
+	for i, header := range headers {
+		if header.Version != i+1 {
+			t.Error("the headers should be sorted by version:", header.Version)
+		}
+		if header.AggregateID != id || header.AggregateType != mocks.AggregateType || header.Namespace != "ns" {
+			t.Error("the header should have the aggregate:", header)
+		}
+		if header.EventID == uuid.Nil {
+			t.Error("the header should have the event ID:", header)
+		}
+		if !header.Timestamp.Equal(timestamp) {
+			t.Error("the header should have the timestamp:", header.Timestamp)
+		}
+	}
+	if headers[0].EventType != unregisteredEventType || headers[1].EventType != mocks.EventType {
+		t.Error("the headers should have the event types:", headers)
+	}
+	if headers[0].MetaData["user"] != "alice" {
+		t.Error("the header should have the meta data:", headers[0].MetaData)
+	}
+
+	headers, err = store.LoadMetadata(ctx, uuid.New())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(headers) != 0 {
+		t.Error("there should be no headers:", headers)
+	}
+}
@@ -0,0 +1,159 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// LoadSince loads the events of an aggregate like Load, but only returns the
+// events with a Timestamp after t, for example to sync the new events of an
+// aggregate to a data warehouse incrementally. The Timestamp is the time the
+// event was created, as set by the aggregate, not the time it was saved.
+//
+// With SortedSetStorage and KeyPerEventStorage the events are filtered on the
+// server in a Lua script, which decodes every stored event of the aggregate
+// but only returns the events after t. Hashes are fetched whole and filtered
+// by the store.
+func (s *EventStore) LoadSince(ctx context.Context, id uuid.UUID, t time.Time) ([]eh.Event, error) {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "LoadSince",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	var dbEvents map[string]string
+	err := s.checkNamespace(ns)
+	if err == nil {
+		dbEvents, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (map[string]string, error) {
+			return s.loadSince(ctx, s.client(ns), s.aggregateKey(ns, id), t).events()
+		})
+	}
+
+	var events []eh.Event
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else {
+		// The script only skips events with a timestamp it could parse, so
+		// all events are checked again.
+		events, err = s.loadEvents(dbEvents, 1, nil)
+		n := 0
+		for _, e := range events {
+			if e.Timestamp().After(t) {
+				events[n] = e
+				n++
+			}
+		}
+		events = events[:n]
+	}
+	span.end(err, eventCountAttribute.Int(len(events)))
+	s.metrics.observeLoad("load_since", ns, len(events), start, err)
+
+	return events, err
+}
+
+// loadSince queues fetching the events of the aggregate key, skipping the
+// events with a timestamp at or before t on the server when the storage mode
+// supports it, with the event data of deduplicated events resolved.
+func (s *EventStore) loadSince(ctx context.Context, c commands, key string, t time.Time) eventsCmd {
+	if s.storageMode == HashStorage {
+		return s.loadAll(ctx, c, key)
+	}
+
+	mode := "zset"
+	if s.storageMode == KeyPerEventStorage {
+		mode = "keys"
+	}
+	// The compacted key is the aggregate key after the compacted prefix, see
+	// loadEventKeys.
+	keys := []string{key, s.keyPrefix + "compacted:" + strings.TrimPrefix(key, s.keyPrefix)}
+	t = t.UTC()
+	cmd := keyEventsCmd{loadSinceScript.Eval(ctx, c, keys, t.Unix(), t.Nanosecond(), mode)}
+
+	return s.resolvePayloads(ctx, key, cmd)
+}
+
+// loadSinceScript returns the version/event pairs of the events of a sorted
+// set or of the event keys of KeyPerEventStorage with a timestamp after the
+// Unix time of ARGV[1] seconds and ARGV[2] nanoseconds. The timestamps are
+// parsed from the RFC 3339 times of the stored events, and events with a
+// timestamp that can't be parsed are returned.
+var loadSinceScript = redis.NewScript(`
+local sec = tonumber(ARGV[1])
+local nsec = tonumber(ARGV[2])
+
+local function days(y, m, d)
+	if m <= 2 then
+		y = y - 1
+	end
+	local era = math.floor(y / 400)
+	local yoe = y - era * 400
+	local doy = math.floor((153 * ((m + 9) % 12) + 2) / 5) + d - 1
+	return era * 146097 + yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy - 719468
+end
+
+local function after(event)
+	local ok, e = pcall(cjson.decode, event)
+	if not ok or type(e) ~= "table" then
+		return true
+	end
+	local ts = e.ts or e.Timestamp
+	if type(ts) ~= "string" then
+		return true
+	end
+	local y, mo, d, h, mi, s, frac, zone = string.match(ts, "^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)%.?(%d*)(.*)$")
+	if not y then
+		return true
+	end
+	local secs = days(tonumber(y), tonumber(mo), tonumber(d)) * 86400 + tonumber(h) * 3600 + tonumber(mi) * 60 + tonumber(s)
+	if zone ~= "Z" then
+		local sign, zh, zm = string.match(zone, "^([+-])(%d+):(%d+)$")
+		if not sign then
+			return true
+		end
+		local offset = tonumber(zh) * 3600 + tonumber(zm) * 60
+		if sign == "+" then
+			secs = secs - offset
+		else
+			secs = secs + offset
+		end
+	end
+	local nanos = tonumber(string.sub(frac .. "000000000", 1, 9))
+	return secs > sec or (secs == sec and nanos > nsec)
+end
+
+local events = {}
+local function add(v, event)
+	if after(event) then
+		events[#events + 1] = tostring(v)
+		events[#events + 1] = event
+	end
+end
+
+if ARGV[3] == "zset" then
+	local members = redis.call("ZRANGE", KEYS[1], 0, -1, "WITHSCORES")
+	for i = 1, #members, 2 do
+		add(members[i + 1], members[i])
+	end
+else
+	local first = (tonumber(redis.call("GET", KEYS[2])) or 0) + 1
+	local last = first - 1 + (tonumber(redis.call("GET", KEYS[1])) or 0)
+	for v = first, last do
+		local event = redis.call("GET", KEYS[1] .. ":" .. v)
+		if event then
+			add(v, event)
+		end
+	end
+end
+return events
+`)
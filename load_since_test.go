@@ -0,0 +1,94 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadSince(t *testing.T) {
+	for _, mode := range []rediseventstore.StorageMode{
+		rediseventstore.HashStorage,
+		rediseventstore.SortedSetStorage,
+		rediseventstore.KeyPerEventStorage,
+	} {
+		t.Run(mode.String(), func(t *testing.T) {
+			store, db := newEventStore(t, rediseventstore.WithStorageMode(mode))
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			// The timestamps are in other zones than the time to load since.
+			since := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+			timestamps := []time.Time{
+				since.Add(-time.Hour).In(time.FixedZone("", 2*3600)),
+				since,
+				since.Add(time.Nanosecond).In(time.FixedZone("", -5*3600-30*60)),
+				since.Add(48 * time.Hour),
+			}
+			id := uuid.New()
+			for i, timestamp := range timestamps {
+				if err := store.Save(ctx, []eh.Event{
+					eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, timestamp,
+						eh.ForAggregate(mocks.AggregateType, id, i+1)),
+				}, i); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			events, err := store.LoadSince(ctx, id, since)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 2 || events[0].Version() != 3 || events[1].Version() != 4 {
+				t.Fatal("the events after the time should be loaded:", events)
+			}
+			if events, err := store.LoadSince(ctx, id, since.Add(72*time.Hour)); err != nil || len(events) != 0 {
+				t.Error("there should be no events:", events, err)
+			}
+			if events, err := store.LoadSince(ctx, uuid.New(), since); err != nil || len(events) != 0 {
+				t.Error("there should be no events:", events, err)
+			}
+
+			// The filter runs on the server, so an undecodable event before the
+			// time is never fetched.
+			if mode == rediseventstore.HashStorage {
+				return
+			}
+			key := "ns:{" + id.String() + "}"
+			if mode == rediseventstore.SortedSetStorage {
+				raw, err := db.ZRange(ctx, key, 0, 0).Result()
+				if err != nil || len(raw) != 1 {
+					t.Fatal("there should be an event:", raw, err)
+				}
+				corrupt := strings.Replace(raw[0], `"Content":"event"`, `"Content":1`, 1)
+				db.ZRem(ctx, key, raw[0])
+				db.ZAdd(ctx, key, redis.Z{Score: 1, Member: corrupt})
+			} else {
+				raw, err := db.Get(ctx, key+":1").Result()
+				if err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				db.Set(ctx, key+":1", strings.Replace(raw, `"Content":"event"`, `"Content":1`, 1), 0)
+			}
+			if _, err := store.Load(ctx, id); err == nil {
+				t.Error("the corrupt event should fail the load")
+			}
+			if events, err := store.LoadSince(ctx, id, since); err != nil || len(events) != 2 {
+				t.Error("the corrupt event should be skipped on the server:", events, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package ehpg
+
+import (
+	"fmt"
+)
+
+// Logger logs errors with structured context as alternating keys and values.
+// A logr.Logger implements it.
+type Logger interface {
+	Error(err error, msg string, keysAndValues ...interface{})
+}
+
+// WithLogger logs failed saves and clears, and events that could not be
+// unmarshaled when loading, with the namespace, aggregate ID and version as
+// keys. Nothing is logged by default.
+func WithLogger(logger Logger) Option {
+	return func(s *EventStore) error {
+		if logger == nil {
+			return fmt.Errorf("%w: logger must not be nil", ErrInvalidOption)
+		}
+
+		s.logger = logger
+
+		return nil
+	}
+}
+
+// logError logs the error when a logger is set.
+func (s *EventStore) logError(err error, msg string, keysAndValues ...interface{}) {
+	if s.logger == nil {
+		return
+	}
+
+	s.logger.Error(err, msg, keysAndValues...)
+}
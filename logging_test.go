@@ -0,0 +1,109 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logEntry is a logged error.
+type logEntry struct {
+	err    error
+	msg    string
+	values map[string]interface{}
+}
+
+// recordingLogger is a logger recording the logged errors.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	values := map[string]interface{}{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		values[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.entries = append(l.entries, logEntry{err: err, msg: msg, values: values})
+}
+
+func (l *recordingLogger) last() logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) == 0 {
+		return logEntry{}
+	}
+	return l.entries[len(l.entries)-1]
+}
+
+func TestEventStoreLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	store, db := newEventStore(t, rediseventstore.WithLogger(logger))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(logger.entries) != 0 {
+		t.Error("nothing should be logged for a successful save:", logger.entries)
+	}
+
+	// A version conflict.
+	err := store.Save(ctx, []eh.Event{event}, 0)
+	if err == nil {
+		t.Fatal("there should be an error")
+	}
+	entry := logger.last()
+	if !errors.Is(entry.err, rediseventstore.ErrCouldNotSaveAggregate) || entry.msg != "could not save events" {
+		t.Error("the save error should be logged:", entry)
+	}
+	if entry.values["namespace"] != "ns" || entry.values["aggregate_id"] != id || entry.values["version"] != 0 {
+		t.Error("the save error should be logged with the aggregate:", entry.values)
+	}
+
+	// An event that can't be unmarshaled.
+	db.HSet(context.Background(), "ns:{"+id.String()+"}", "2",
+		`{"Namespace":"ns","AggregateID":"`+id.String()+`","Version":2,"EventType":"`+string(mocks.EventType)+`","RawEventData":"invalid"}`)
+	if _, err := store.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUnmarshalEvent) {
+		t.Fatal("there should be an unmarshal error:", err)
+	}
+	entry = logger.last()
+	if !errors.Is(entry.err, rediseventstore.ErrCouldNotUnmarshalEvent) || entry.msg != "could not unmarshal event" {
+		t.Error("the unmarshal error should be logged:", entry)
+	}
+	if entry.values["namespace"] != "ns" || entry.values["aggregate_id"] != id || entry.values["version"] != 2 {
+		t.Error("the unmarshal error should be logged with the event:", entry.values)
+	}
+
+	// A cancelled clear.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := store.Clear(cancelled); err == nil {
+		t.Fatal("there should be an error")
+	}
+	entry = logger.last()
+	if !errors.Is(entry.err, rediseventstore.ErrCouldNotClearDB) || entry.values["namespace"] != "ns" {
+		t.Error("the clear error should be logged:", entry)
+	}
+}
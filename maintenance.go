@@ -0,0 +1,378 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// ErrEventNotFound is when an event to load or replace does not exist.
+var ErrEventNotFound = errors.New("event not found")
+
+// ErrCouldNotRenameEvents is when stored events could not be renamed.
+var ErrCouldNotRenameEvents = errors.New("could not rename events")
+
+var _ = eh.EventStoreMaintenance(&EventStore{})
+
+// Replace implements the Replace method of the eventhorizon.EventStoreMaintenance
+// interface. It overwrites the stored event with the same aggregate and
+// version, keeping the EventID and Timestamp of the stored event.
+func (s *EventStore) Replace(ctx context.Context, event eh.Event) error {
+	_, err := withTimeout(ctx, s, ErrCouldNotSaveAggregate, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.replace(ctx, event)
+	})
+
+	return err
+}
+
+// replace replaces a stored event, see Replace.
+func (s *EventStore) replace(ctx context.Context, event eh.Event) error {
+	ns := namespaceFromContext(ctx)
+	key := s.aggregateKey(ns, event.AggregateID())
+	field := strconv.Itoa(event.Version())
+	version := event.Version()
+
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+
+	e, err := s.newDBEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	err = s.client(ns).Watch(ctx, func(tx commands) error {
+		dbEvents, err := s.loadRange(ctx, tx, key, version, version).events()
+		if err != nil {
+			return err
+		}
+		raw, ok := dbEvents[field]
+		if !ok {
+			return eh.EventStoreError{
+				Err: ErrEventNotFound,
+			}
+		}
+
+		stored := AggregateEvent{}
+		if err := stored.UnmarshalBinary([]byte(raw)); err != nil {
+			return eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalEvent,
+			}
+		}
+		e.EventID = stored.EventID
+		e.Timestamp = stored.Timestamp
+
+		// The replaced event data referenced by later events of
+		// WithPayloadDedup is moved to those events.
+		var refs []AggregateEvent
+		if s.payloadDedup {
+			all, err := s.loadStoredAll(ctx, tx, key).events()
+			if err != nil {
+				return err
+			}
+			if refs, err = rehomePayloads(all, func(v int) bool { return v == version }); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.setEvent(ctx, pipe, key, *e)
+			for _, ref := range refs {
+				s.setEvent(ctx, pipe, key, ref)
+			}
+			if s.eventTypeIndex && stored.EventType != e.EventType {
+				pipe.SRem(ctx, s.eventTypeIndexKey(ns, stored.EventType), eventIndexValue(*e))
+				pipe.SAdd(ctx, s.eventTypeIndexKey(ns, e.EventType), eventIndexValue(*e))
+			}
+			return nil
+		})
+
+		return err
+	}, key)
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return storeErr
+	} else if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotSaveAggregate,
+		}
+	}
+
+	return nil
+}
+
+// RenameEvent implements the RenameEvent method of the
+// eventhorizon.EventStoreMaintenance interface.
+func (s *EventStore) RenameEvent(ctx context.Context, from, to eh.EventType) error {
+	_, err := s.RenameEventCount(ctx, from, to)
+	return err
+}
+
+// RenameEventCount renames the event type of all stored events in the
+// namespace from one type to another, returning the number of renamed
+// events. Renaming is idempotent and can be rerun after a failure.
+func (s *EventStore) RenameEventCount(ctx context.Context, from, to eh.EventType) (int, error) {
+	return s.renameAll(ctx, func(e *AggregateEvent) bool {
+		if e.EventType != from {
+			return false
+		}
+		e.EventType = to
+		return true
+	})
+}
+
+// RenameAggregateType renames the aggregate type of all stored events in the
+// namespace from one type to another, returning the number of renamed events.
+// Renaming is idempotent and can be rerun after a failure. Snapshots keep the
+// old aggregate type, and should be saved again after renaming.
+func (s *EventStore) RenameAggregateType(ctx context.Context, from, to eh.AggregateType) (int, error) {
+	return s.renameAll(ctx, func(e *AggregateEvent) bool {
+		if e.AggregateType != from {
+			return false
+		}
+		e.AggregateType = to
+		return true
+	})
+}
+
+// renameAll renames all stored events in the namespace for which rename
+// returns true, returning the number of renamed events.
+func (s *EventStore) renameAll(ctx context.Context, rename func(e *AggregateEvent) bool) (int, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkWrite(); err != nil {
+		return 0, err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return 0, err
+	}
+
+	renamed := 0
+	err := s.scanKeys(ctx, ns, s.aggregateKey(ns, "*"), renameBatchSize, func(keys []string) error {
+		n, err := s.renameEvents(ctx, ns, keys, rename)
+		renamed += n
+		return err
+	})
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return renamed, storeErr
+	} else if err != nil {
+		return renamed, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotRenameEvents,
+		}
+	}
+
+	return renamed, nil
+}
+
+// renameBatchSize is the number of aggregates renamed per pipeline.
+const renameBatchSize = 500
+
+// renameAttempts is the number of times the events of an aggregate are loaded
+// and renamed while they change concurrently.
+const renameAttempts = 3
+
+// renameEvents renames the stored events of a batch of aggregate keys for
+// which rename returns true, returning the number of renamed events. Events
+// are only replaced while they are still stored as loaded, so events removed
+// or replaced concurrently, like by Compact, DeleteAggregate or Replace, are
+// never written back. The aggregates with such events are loaded and renamed
+// again.
+func (s *EventStore) renameEvents(ctx context.Context, ns string, keys []string, rename func(e *AggregateEvent) bool) (int, error) {
+	renamed := 0
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt == renameAttempts {
+			return renamed, eh.EventStoreError{
+				BaseErr: fmt.Errorf("the events of %d aggregates kept changing while renaming", len(keys)),
+				Err:     ErrCouldNotRenameEvents,
+			}
+		}
+
+		n, changed, err := s.renameBatch(ctx, ns, keys, rename)
+		renamed += n
+		if err != nil {
+			return renamed, err
+		}
+		keys = changed
+	}
+
+	return renamed, nil
+}
+
+// renaming is the renamed events of an aggregate, with the renameEventsScript
+// replacing them.
+type renaming struct {
+	key    string
+	keys   []string
+	args   []interface{}
+	events []AggregateEvent
+	from   []eh.EventType
+	cmd    *redis.Cmd
+}
+
+// renameBatch renames the events of a batch of aggregate keys, see
+// renameEvents. It returns the number of renamed events and the keys of the
+// aggregates with events that changed after loading them.
+func (s *EventStore) renameBatch(ctx context.Context, ns string, keys []string, rename func(e *AggregateEvent) bool) (int, []string, error) {
+	// Fetch all aggregates of the batch in one round trip. The events are
+	// renamed as stored, keeping deduplicated events as references.
+	results := make([]eventsCmd, 0, len(keys))
+	_, err := s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			results = append(results, s.loadStoredAll(ctx, pipe, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotRenameEvents,
+		}
+	}
+
+	mode := "hash"
+	if s.storageMode == SortedSetStorage {
+		mode = "zset"
+	} else if s.storageMode == KeyPerEventStorage {
+		mode = "keys"
+	}
+
+	var renamings []*renaming
+	for i, result := range results {
+		dbEvents, err := result.events()
+		if err != nil {
+			return 0, nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotRenameEvents,
+			}
+		}
+
+		r := &renaming{key: keys[i], keys: []string{keys[i]}, args: []interface{}{mode}}
+		for _, raw := range dbEvents {
+			e := AggregateEvent{}
+			if err := e.UnmarshalBinary([]byte(raw)); err != nil {
+				return 0, nil, eh.EventStoreError{
+					BaseErr: err,
+					Err:     ErrCouldNotUnmarshalEvent,
+				}
+			}
+			from := e.EventType
+			if !rename(&e) {
+				continue
+			}
+
+			e.legacyNames = s.legacyNames
+			b, err := e.MarshalBinary()
+			if err != nil {
+				return 0, nil, eh.EventStoreError{
+					BaseErr: err,
+					Err:     ErrCouldNotMarshalEvent,
+				}
+			}
+			r.args = append(r.args, e.Version, raw, b)
+			if s.storageMode == KeyPerEventStorage {
+				r.keys = append(r.keys, eventKey(keys[i], e.Version))
+			}
+			r.events = append(r.events, e)
+			r.from = append(r.from, from)
+		}
+		if len(r.events) > 0 {
+			renamings = append(renamings, r)
+		}
+	}
+	if len(renamings) == 0 {
+		return 0, nil, nil
+	}
+
+	// Replace the renamed events of all aggregates in one round trip.
+	_, err = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range renamings {
+			r.cmd = renameEventsScript.Eval(ctx, pipe, r.keys, r.args...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotRenameEvents,
+		}
+	}
+
+	renamed := 0
+	var changed []string
+	_, err = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range renamings {
+			versions, err := r.cmd.StringSlice()
+			if err != nil {
+				return err
+			}
+			replaced := make(map[string]bool, len(versions))
+			for _, version := range versions {
+				replaced[version] = true
+			}
+
+			for i, e := range r.events {
+				if !replaced[strconv.Itoa(e.Version)] {
+					continue
+				}
+				if s.eventTypeIndex && e.EventType != r.from[i] {
+					pipe.SRem(ctx, s.eventTypeIndexKey(ns, r.from[i]), eventIndexValue(e))
+					pipe.SAdd(ctx, s.eventTypeIndexKey(ns, e.EventType), eventIndexValue(e))
+				}
+				renamed++
+			}
+			if len(versions) < len(r.events) {
+				changed = append(changed, r.key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return renamed, nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotRenameEvents,
+		}
+	}
+
+	return renamed, changed, nil
+}
+
+// renameEventsScript replaces stored events that are still stored as loaded,
+// returning the replaced versions. ARGV[1] is the storage mode, followed by
+// the version, the loaded event and the renamed event of every event. With a
+// key per event, the event keys follow the aggregate key in KEYS.
+var renameEventsScript = redis.NewScript(`
+local mode = ARGV[1]
+local replaced = {}
+for i = 2, #ARGV, 3 do
+	local version, loaded, event = ARGV[i], ARGV[i + 1], ARGV[i + 2]
+	if mode == "zset" then
+		if redis.call("ZSCORE", KEYS[1], loaded) then
+			redis.call("ZREM", KEYS[1], loaded)
+			redis.call("ZADD", KEYS[1], version, event)
+			replaced[#replaced + 1] = version
+		end
+	elseif mode == "keys" then
+		local key = KEYS[1 + (i + 1) / 3]
+		if redis.call("GET", key) == loaded then
+			redis.call("SET", key, event)
+			replaced[#replaced + 1] = version
+		end
+	elseif redis.call("HGET", KEYS[1], version) == loaded then
+		redis.call("HSET", KEYS[1], version, event)
+		replaced[#replaced + 1] = version
+	end
+end
+return replaced
+`)
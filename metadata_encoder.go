@@ -0,0 +1,93 @@
+package ehpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MetadataEncoder marshals and unmarshals the meta data of events, like
+// Encoder does for event data.
+type MetadataEncoder interface {
+	// Marshal marshals the meta data, which is nil for events without meta
+	// data.
+	Marshal(map[string]interface{}) ([]byte, error)
+	// Unmarshal unmarshals the raw meta data.
+	Unmarshal([]byte) (map[string]interface{}, error)
+	// String returns the name of the encoding. Meta data of the "json"
+	// encoding is embedded as JSON in the stored event, any other encoding is
+	// stored as binary data with the name.
+	String() string
+}
+
+// WithMetadataEncoder uses the encoder to marshal and unmarshal meta data,
+// instead of the default JSON encoder. Meta data stored as JSON, like the
+// meta data saved before changing the encoder, is still unmarshaled as JSON.
+// Binary meta data can only be unmarshaled by an encoder of the same name.
+func WithMetadataEncoder(encoder MetadataEncoder) Option {
+	return func(s *EventStore) error {
+		if encoder == nil {
+			return fmt.Errorf("%w: metadata encoder must not be nil", ErrInvalidOption)
+		}
+
+		s.metadataEncoder = encoder
+
+		return nil
+	}
+}
+
+// NewJSONMetadataEncoder returns the default MetadataEncoder, marshaling meta
+// data as JSON.
+func NewJSONMetadataEncoder() MetadataEncoder {
+	return jsonMetadataEncoder{}
+}
+
+type jsonMetadataEncoder struct{}
+
+func (jsonMetadataEncoder) Marshal(metadata map[string]interface{}) ([]byte, error) {
+	return json.Marshal(metadata)
+}
+
+func (jsonMetadataEncoder) Unmarshal(raw []byte) (map[string]interface{}, error) {
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (jsonMetadataEncoder) String() string {
+	return "json"
+}
+
+// NewMsgpackMetadataEncoder returns a MetadataEncoder marshaling meta data as
+// msgpack, which is more compact than JSON. Numbers are unmarshaled with the
+// smallest integer or float type holding them, instead of float64.
+func NewMsgpackMetadataEncoder() MetadataEncoder {
+	return msgpackMetadataEncoder{}
+}
+
+type msgpackMetadataEncoder struct{}
+
+func (msgpackMetadataEncoder) Marshal(metadata map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(metadata); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackMetadataEncoder) Unmarshal(raw []byte) (map[string]interface{}, error) {
+	var metadata map[string]interface{}
+	if err := msgpack.Unmarshal(raw, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (msgpackMetadataEncoder) String() string {
+	return "msgpack"
+}
@@ -0,0 +1,88 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreMetadataEncoder(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"msgpack": {rediseventstore.WithMetadataEncoder(rediseventstore.NewMsgpackMetadataEncoder())},
+		"msgpack encrypted": {
+			rediseventstore.WithMetadataEncoder(rediseventstore.NewMsgpackMetadataEncoder()),
+			rediseventstore.WithEncryption(xorCipher{id: "key", key: 0x5a}),
+			rediseventstore.WithMetadataEncryption(),
+		},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			jsonStore, db := newEventStore(t)
+			store, _ := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			// Meta data saved as JSON is still loaded after changing the
+			// encoder.
+			id := uuid.New()
+			if err := jsonStore.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1),
+					eh.WithMetadata(map[string]interface{}{"user": "alice"})),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2),
+					eh.WithMetadata(map[string]interface{}{"user": "bob", "internal": true})),
+			}, 1); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			raw, err := db.HGet(ctx, "ns:{"+id.String()+"}", "2").Bytes()
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			stored := rediseventstore.AggregateEvent{}
+			if err := stored.UnmarshalBinary(raw); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if stored.MetaDataEncoding != "msgpack" || (stored.EncodedMetaData == nil && stored.BinaryMetaData == nil) {
+				t.Error("the meta data should be stored as msgpack:", string(raw))
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 2 {
+				t.Fatal("there should be two events:", events)
+			}
+			if events[0].Metadata()["user"] != "alice" {
+				t.Error("the JSON meta data should be loaded:", events[0].Metadata())
+			}
+			if events[1].Metadata()["user"] != "bob" || events[1].Metadata()["internal"] != true {
+				t.Error("the msgpack meta data should be loaded:", events[1].Metadata())
+			}
+
+			// Binary meta data can't be read with another encoder.
+			if _, err := jsonStore.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUnmarshalEvent) {
+				t.Error("there should be an unmarshal error:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package ehpg
+
+import (
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"time"
+)
+
+// Metrics records the metrics of the operations of the store, see
+// WithMetrics. The prometheusmetrics package records them as Prometheus
+// metrics. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveOperation records the duration of an operation in a namespace,
+	// like "save" or "load", and its error, if any.
+	ObserveOperation(operation, namespace string, duration time.Duration, err error)
+	// AddEventsSaved records a number of saved events.
+	AddEventsSaved(namespace string, n int)
+	// AddEventsLoaded records a number of loaded events.
+	AddEventsLoaded(namespace string, n int)
+	// IncVersionConflicts records a save rejected with a version conflict.
+	IncVersionConflicts(namespace string)
+}
+
+// WithMetrics records the metrics of the store operations with m, for example
+// the Prometheus metrics of the prometheusmetrics package. Metrics are not
+// recorded by default.
+func WithMetrics(m Metrics) Option {
+	return func(s *EventStore) error {
+		if m == nil {
+			return fmt.Errorf("%w: metrics must not be nil", ErrInvalidOption)
+		}
+
+		s.metrics = &metrics{m: m}
+
+		return nil
+	}
+}
+
+// metrics records the metrics of a store, which are not recorded when nil.
+type metrics struct {
+	m Metrics
+}
+
+// observeSave records a save of a number of events.
+func (m *metrics) observeSave(ns string, events int, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.observe("save", ns, start, err)
+	if err == nil {
+		m.m.AddEventsSaved(ns, events)
+	} else if isVersionConflict(err) {
+		m.m.IncVersionConflicts(ns)
+	}
+}
+
+// observeLoad records a load operation of a number of events.
+func (m *metrics) observeLoad(operation, ns string, events int, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.observe(operation, ns, start, err)
+	m.m.AddEventsLoaded(ns, events)
+}
+
+// observe records the duration and error of an operation.
+func (m *metrics) observe(operation, ns string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.m.ObserveOperation(operation, ns, time.Since(start), err)
+}
+
+// isVersionConflict returns true for save errors caused by a version conflict,
+// which are wrapped as the base error of ErrCouldNotSaveAggregate.
+func isVersionConflict(err error) bool {
+	if errors.Is(err, ErrVersionConflict) {
+		return true
+	}
+
+	var storeErr eh.EventStoreError
+	return errors.As(err, &storeErr) && errors.Is(storeErr.BaseErr, ErrVersionConflict)
+}
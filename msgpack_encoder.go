@@ -0,0 +1,54 @@
+package ehpg
+
+import (
+	"bytes"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// NewMsgpackEncoder returns an Encoder marshaling event data as msgpack, which
+// is more compact than JSON. The event data is created with the factories
+// registered with eh.RegisterEventData, and struct fields are named by their
+// json tags, so that the same event data types work with both encoders.
+func NewMsgpackEncoder() Encoder {
+	return msgpackEncoder{}
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackEncoder) Unmarshal(eventType eh.EventType, raw []byte) (eh.EventData, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	data, err := eh.CreateEventData(eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(raw))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (msgpackEncoder) String() string {
+	return "msgpack"
+}
@@ -0,0 +1,141 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const orderPlacedEventType eh.EventType = "OrderPlaced"
+
+// orderPlaced is representative event data with a mix of field types.
+type orderPlaced struct {
+	OrderID    uuid.UUID `json:"order_id"`
+	CustomerID uuid.UUID `json:"customer_id"`
+	Items      []string  `json:"items"`
+	Quantity   int       `json:"quantity"`
+	Total      float64   `json:"total"`
+	Currency   string    `json:"currency"`
+	PlacedAt   time.Time `json:"placed_at"`
+	Priority   bool      `json:"priority"`
+}
+
+func init() {
+	eh.RegisterEventData(orderPlacedEventType, func() eh.EventData {
+		return &orderPlaced{}
+	})
+}
+
+func newOrderPlaced() *orderPlaced {
+	return &orderPlaced{
+		OrderID:    uuid.New(),
+		CustomerID: uuid.New(),
+		Items:      []string{"SKU-1001", "SKU-2002", "SKU-3003"},
+		Quantity:   3,
+		Total:      129.95,
+		Currency:   "EUR",
+		PlacedAt:   time.Now().UTC().Truncate(time.Millisecond),
+		Priority:   true,
+	}
+}
+
+// equalOrderPlaced compares order data, ignoring the location of the time,
+// which msgpack decodes as local time.
+func equalOrderPlaced(data eh.EventData, expected *orderPlaced) bool {
+	order, ok := data.(*orderPlaced)
+	if !ok || !order.PlacedAt.Equal(expected.PlacedAt) {
+		return false
+	}
+
+	actual := *order
+	actual.PlacedAt = expected.PlacedAt
+	return reflect.DeepEqual(&actual, expected)
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	encoder := rediseventstore.NewMsgpackEncoder()
+
+	expected := newOrderPlaced()
+	raw, err := encoder.Marshal(expected)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	data, err := encoder.Unmarshal(orderPlacedEventType, raw)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !equalOrderPlaced(data, expected) {
+		t.Error("the data should be unmarshaled:", data)
+	}
+
+	if raw, err := encoder.Marshal(nil); err != nil || raw != nil {
+		t.Error("nil data should be marshaled as nil:", raw, err)
+	}
+	if data, err := encoder.Unmarshal(orderPlacedEventType, nil); err != nil || data != nil {
+		t.Error("empty data should be unmarshaled as nil:", data, err)
+	}
+	if _, err := encoder.Unmarshal("Unregistered", raw); err == nil {
+		t.Error("there should be an error for an unregistered event type")
+	}
+}
+
+func TestEventStoreMsgpackEncoder(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithEncoder(rediseventstore.NewMsgpackEncoder()))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	expected := newOrderPlaced()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(orderPlacedEventType, expected, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	if !equalOrderPlaced(events[0].Data(), expected) {
+		t.Error("the data should be loaded:", events[0].Data())
+	}
+}
+
+// BenchmarkEncoderSize reports the encoded size of representative event data
+// for the JSON and msgpack encoders.
+func BenchmarkEncoderSize(b *testing.B) {
+	data := newOrderPlaced()
+
+	for _, encoder := range []rediseventstore.Encoder{
+		rediseventstore.NewJSONEncoder(),
+		rediseventstore.NewMsgpackEncoder(),
+	} {
+		b.Run(encoder.String(), func(b *testing.B) {
+			var raw []byte
+			for i := 0; i < b.N; i++ {
+				var err error
+				if raw, err = encoder.Marshal(data); err != nil {
+					b.Fatal("there should be no error:", err)
+				}
+			}
+			b.ReportMetric(float64(len(raw)), "bytes")
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package ehpg
+
+import (
+	"fmt"
+	"github.com/redis/go-redis/v9"
+)
+
+// WithNamespaceDB stores the keys of every namespace in the logical Redis
+// database returned by dbFor, to isolate tenants more strongly than by key.
+// The store then uses a separate client per database, created on first use
+// with the options of the client passed to NewEventStore, and closed by Close.
+// Namespaces in the database of that client use it directly.
+//
+// Every client has its own connection pool of up to PoolSize connections, so
+// the store can open that many connections per database in use. Size the
+// pools, and the maxclients of the server, for the number of databases. Hooks
+// added to the client passed to NewEventStore are not added to the clients of
+// other databases.
+//
+// SELECT is not allowed on Redis Cluster, so the option requires a
+// *redis.Client, as returned by redis.NewClient or redis.NewFailoverClient.
+func WithNamespaceDB(dbFor func(ns string) int) Option {
+	return func(s *EventStore) error {
+		if dbFor == nil {
+			return fmt.Errorf("%w: namespace database func must not be nil", ErrInvalidOption)
+		}
+
+		s.namespaceDB = dbFor
+
+		return nil
+	}
+}
+
+// client returns the client sending the commands of the store to the
+// database of the namespace, see storeCommands.
+func (s *EventStore) client(ns string) storeClient {
+	return s.wrapClient(s.dbClient(ns))
+}
+
+// dbClient returns the client of the database of the namespace, which is the
+// client of the store without WithNamespaceDB.
+func (s *EventStore) dbClient(ns string) redis.UniversalClient {
+	if s.namespaceDB == nil {
+		return s.db
+	}
+
+	options := s.db.(*redis.Client).Options()
+	index := s.namespaceDB(ns)
+	if index == options.DB {
+		return s.db
+	}
+
+	s.dbClientsMu.Lock()
+	defer s.dbClientsMu.Unlock()
+
+	if client, ok := s.dbClients[index]; ok {
+		return client
+	}
+
+	clientOptions := *options
+	clientOptions.DB = index
+	client := redis.NewClient(&clientOptions)
+
+	if s.dbClients == nil {
+		s.dbClients = map[int]*redis.Client{}
+	}
+	s.dbClients[index] = client
+
+	return client
+}
+
+// closeDBClients closes the clients of the namespace databases.
+func (s *EventStore) closeDBClients() error {
+	s.dbClientsMu.Lock()
+	defer s.dbClientsMu.Unlock()
+
+	var firstErr error
+	for index, client := range s.dbClients {
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.dbClients, index)
+	}
+
+	return firstErr
+}
@@ -0,0 +1,69 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreNamespaceDB(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithNamespaceDB(func(ns string) int {
+		if ns == "tenant" {
+			return 1
+		}
+		return 0
+	}))
+
+	other := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 1})
+	defer other.Close()
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+	tenantCtx := namespace.NewContext(context.Background(), "tenant")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	for _, ctx := range []context.Context{ctx, tenantCtx} {
+		if err := store.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 1)),
+		}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	if n, _ := db.Exists(ctx, "ns:{"+id.String()+"}").Result(); n != 1 {
+		t.Error("the aggregate of the namespace should be in database 0")
+	}
+	if n, _ := db.Exists(ctx, "tenant:{"+id.String()+"}").Result(); n != 0 {
+		t.Error("the aggregate of the tenant should not be in database 0")
+	}
+	if n, _ := other.Exists(ctx, "tenant:{"+id.String()+"}").Result(); n != 1 {
+		t.Error("the aggregate of the tenant should be in database 1")
+	}
+
+	events, err := store.Load(tenantCtx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the event of the tenant should be loaded:", events)
+	}
+
+	if err := store.Clear(tenantCtx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if keys, _ := other.Keys(ctx, "tenant:*").Result(); len(keys) != 0 {
+		t.Error("the keys of the tenant should be cleared:", keys)
+	}
+}
@@ -0,0 +1,72 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+	"sort"
+	"strings"
+)
+
+// ErrCouldNotListNamespaces is when the namespaces could not be listed.
+var ErrCouldNotListNamespaces = errors.New("could not list namespaces")
+
+// namespacesBatchSize is the number of keys scanned per round trip in Namespaces.
+const namespacesBatchSize = 1000
+
+// Namespaces returns the sorted namespaces with stored events, for example to
+// show the active tenants in an admin tool. The keyspace is scanned with SCAN
+// in batches, and the namespace of every aggregate key is the segment before
+// the first colon, so namespaces containing a colon are not found. Snapshot,
+// record and index keys are skipped. With WithNamespaceDB only the database of
+// the default namespace is scanned.
+func (s *EventStore) Namespaces(ctx context.Context) ([]string, error) {
+	pattern := s.keyPrefix + s.keyBuilder("*", "*")
+
+	seen := map[string]struct{}{}
+	err := s.scanKeys(ctx, namespace.DefaultNamespace, pattern, namespacesBatchSize, func(keys []string) error {
+		for _, key := range keys {
+			ns, _, ok := strings.Cut(strings.TrimPrefix(key, s.keyPrefix), ":")
+			if !ok {
+				continue
+			}
+			// SCAN may return a key more than once, and a namespace has a key
+			// per aggregate.
+			if _, ok := seen[ns]; ok {
+				continue
+			}
+			if s.isAggregateKey(ns, key) {
+				seen[ns] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotListNamespaces,
+		}
+	}
+
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// isAggregateKey returns true when the key is the key of an aggregate of the
+// namespace, which isn't the case for the keys of snapshots, records and
+// indexes matching the same pattern.
+func (s *EventStore) isAggregateKey(ns, key string) bool {
+	prefix, suffix, _ := strings.Cut(s.aggregateKey(ns, "*"), "*")
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) || len(key) < len(prefix)+len(suffix) {
+		return false
+	}
+	_, err := uuid.Parse(key[len(prefix) : len(key)-len(suffix)])
+	return err == nil
+}
@@ -0,0 +1,73 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEventStoreNamespaces(t *testing.T) {
+	store, db := newEventStore(t,
+		rediseventstore.WithKeyPrefix("namespaces"),
+		rediseventstore.WithEventIndex(),
+		rediseventstore.WithOutboxStream("outbox"))
+
+	for _, ns := range []string{"tenant-a", "tenant-b", namespace.DefaultNamespace} {
+		ctx := namespace.NewContext(context.Background(), ns)
+
+		defer func() {
+			if err := store.Clear(ctx); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}()
+
+		for i := 0; i < 3; i++ {
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{Version: 1, State: "state"}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}
+
+	// Namespaces with only snapshots or other keys are not listed.
+	ctx := namespace.NewContext(context.Background(), "snapshots-only")
+	if err := store.SaveSnapshot(ctx, uuid.New(), rediseventstore.Snapshot{Version: 1, State: "state"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+	if err := db.Set(ctx, "namespaces:other:{other}", "value", 0).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer db.Del(ctx, "namespaces:other:{other}")
+
+	namespaces, err := store.Namespaces(context.Background())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	want := []string{namespace.DefaultNamespace, "tenant-a", "tenant-b"}
+	sort.Strings(want)
+	if len(namespaces) != len(want) {
+		t.Fatal("the namespaces with events should be listed:", namespaces)
+	}
+	for i := range want {
+		if namespaces[i] != want[i] {
+			t.Error("the namespaces should be sorted:", namespaces)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ehpg
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// OperationError is the base error of the event store errors returned by
+// Save, Load and Clear, telling the operation, namespace and aggregate that
+// failed, so that logged errors can be traced to an aggregate. The underlying
+// error, if any, is unwrapped by errors.Is and errors.As.
+type OperationError struct {
+	// Op is the name of the operation, like "save".
+	Op string
+	// Namespace is the namespace of the operation.
+	Namespace string
+	// AggregateID is the aggregate of the operation, which is uuid.Nil for
+	// operations on a namespace, like Clear.
+	AggregateID uuid.UUID
+	// Err is the base error of the event store error, which can be nil.
+	Err error
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e *OperationError) Error() string {
+	msg := fmt.Sprintf("%s in namespace %q", e.Op, e.Namespace)
+	if e.AggregateID != uuid.Nil {
+		msg = fmt.Sprintf("%s of aggregate %s in namespace %q", e.Op, e.AggregateID, e.Namespace)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap implements the errors.Unwrap method.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// withOperation returns an event store error with its base error wrapped in
+// an OperationError of the operation. Other errors are returned as is.
+func withOperation(err error, op, ns string, id uuid.UUID) error {
+	storeErr, ok := err.(eh.EventStoreError)
+	if !ok {
+		return err
+	}
+
+	storeErr.BaseErr = &OperationError{
+		Op:          op,
+		Namespace:   ns,
+		AggregateID: id,
+		Err:         storeErr.BaseErr,
+	}
+	return storeErr
+}
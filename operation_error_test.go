@@ -0,0 +1,72 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreOperationError(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A version conflict tells the aggregate and keeps its base error.
+	err := store.Save(ctx, []eh.Event{event}, 0)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Fatal("there should be a version conflict:", err)
+	}
+	var opErr *rediseventstore.OperationError
+	if !errors.As(storeErr.BaseErr, &opErr) {
+		t.Fatal("there should be an operation error:", storeErr.BaseErr)
+	}
+	if opErr.Op != "save" || opErr.Namespace != "ns" || opErr.AggregateID != id {
+		t.Error("the operation error should tell the aggregate:", opErr)
+	}
+	if !strings.Contains(err.Error(), "save of aggregate "+id.String()+` in namespace "ns"`) {
+		t.Error("the error should tell the aggregate:", err)
+	}
+
+	// Load errors tell the aggregate.
+	other := uuid.New()
+	if err := db.HSet(ctx, "ns:{"+other.String()+"}", "1", "not json").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	_, err = store.Load(ctx, other)
+	if !errors.As(err, &storeErr) || !errors.As(storeErr.BaseErr, &opErr) ||
+		opErr.Op != "load" || opErr.AggregateID != other {
+		t.Error("the load error should tell the aggregate:", err)
+	}
+
+	// Clear errors tell the namespace.
+	db.AddHook(newFailingHook("scan", errors.New("scan failed"), 1))
+	err = store.Clear(ctx)
+	if !errors.As(err, &storeErr) || !errors.As(storeErr.BaseErr, &opErr) ||
+		opErr.Op != "clear" || opErr.Namespace != "ns" || opErr.AggregateID != uuid.Nil {
+		t.Error("the clear error should tell the namespace:", err)
+	}
+	if !strings.Contains(err.Error(), `clear in namespace "ns": scan failed`) {
+		t.Error("the error should tell the namespace:", err)
+	}
+}
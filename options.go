@@ -0,0 +1,339 @@
+package ehpg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOption is when an option is given an invalid value.
+var ErrInvalidOption = errors.New("invalid option")
+
+// Option is an option setter used to configure creation.
+type Option func(*EventStore) error
+
+// WithEncoder uses the encoder to marshal and unmarshal event data, instead
+// of the default JSON encoder.
+func WithEncoder(encoder Encoder) Option {
+	return func(s *EventStore) error {
+		if encoder == nil {
+			return fmt.Errorf("%w: encoder must not be nil", ErrInvalidOption)
+		}
+
+		s.encoder = encoder
+
+		return nil
+	}
+}
+
+// WithJSONOptions marshals event data as JSON with a json.Encoder configured
+// by the options, for example to keep URLs readable without HTML escaping:
+//
+//	WithJSONOptions(func(enc *json.Encoder) { enc.SetEscapeHTML(false) })
+//
+// Data stored with and without HTML escaping is unmarshaled alike.
+func WithJSONOptions(options ...func(*json.Encoder)) Option {
+	return func(s *EventStore) error {
+		s.encoder = NewJSONEncoder(options...)
+
+		return nil
+	}
+}
+
+// WithKeyPrefix prefixes all keys written by the store with prefix, which
+// isolates the keyspace from other users of the same Redis database.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *EventStore) error {
+		if prefix == "" {
+			return fmt.Errorf("%w: key prefix must not be empty", ErrInvalidOption)
+		}
+		// The prefix is part of the SCAN patterns used by Clear.
+		if strings.ContainsAny(prefix, "*?[]\\") {
+			return fmt.Errorf("%w: key prefix %q must not contain glob characters", ErrInvalidOption, prefix)
+		}
+
+		s.keyPrefix = prefix + ":"
+
+		return nil
+	}
+}
+
+// WithKeyBuilder composes the keys of aggregates from the namespace and the
+// aggregate ID with build, instead of the default "namespace:{id}", for
+// example to add a tenant segment. The snapshot and aggregate record keys are
+// the built key prefixed with "snapshot:" and "aggregate:", and the prefix of
+// WithKeyPrefix is prepended to all of them.
+//
+// The builder is also called with the id "*" to build the SCAN pattern of
+// Clear and AggregateIDs, so the built key must contain the id exactly once
+// and keys of other namespaces must not match the pattern. On Redis Cluster
+// the id must be a hash tag, like in the default keys, which KeyPerEventStorage
+// requires.
+func WithKeyBuilder(build func(ns, id string) string) Option {
+	return func(s *EventStore) error {
+		if build == nil {
+			return fmt.Errorf("%w: key builder must not be nil", ErrInvalidOption)
+		}
+		if key := build("ns", "*"); strings.Count(key, "*") != 1 {
+			return fmt.Errorf("%w: key builder must include the id once, got %q", ErrInvalidOption, key)
+		}
+
+		s.keyBuilder = build
+
+		return nil
+	}
+}
+
+// WithEventTTL expires the stored events and snapshots of an aggregate when
+// it has not been saved for the duration d, for example for short lived
+// sagas. The expiry slides forward on every save, so active aggregates never
+// expire. Loading an expired aggregate returns no events.
+func WithEventTTL(d time.Duration) Option {
+	return func(s *EventStore) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: event TTL must be positive, got %s", ErrInvalidOption, d)
+		}
+
+		s.eventTTL = d
+
+		return nil
+	}
+}
+
+// WithWatchSave saves events in an optimistic WATCH/MULTI/EXEC transaction
+// instead of the default Lua script, for servers where scripting is disabled.
+func WithWatchSave() Option {
+	return func(s *EventStore) error {
+		s.watchSave = true
+
+		return nil
+	}
+}
+
+// WithCompression compresses the stored event data with the codec. Event data
+// stored with another codec, or without compression, can still be loaded.
+func WithCompression(compression Compression) Option {
+	return func(s *EventStore) error {
+		if compression != NoCompression && compression != Gzip {
+			return fmt.Errorf("%w: unknown compression %s", ErrInvalidOption, compression)
+		}
+
+		s.compression = compression
+
+		return nil
+	}
+}
+
+// WithSharedClient keeps the Redis client open when the store is closed, for
+// clients shared with for example read model repositories or event buses.
+func WithSharedClient() Option {
+	return func(s *EventStore) error {
+		s.sharedClient = true
+
+		return nil
+	}
+}
+
+// WithOutboxStream adds every saved event to the Redis Stream
+// {name}:{namespace} in the same atomic write as the events, so that events
+// are only in the stream when they have been saved. The stream entries have
+// the fields aggregate_id, version, event_type and data, with the data as
+// stored by the event store.
+func WithOutboxStream(name string) Option {
+	return func(s *EventStore) error {
+		if name == "" {
+			return fmt.Errorf("%w: outbox stream name must not be empty", ErrInvalidOption)
+		}
+		// The stream key is part of the SCAN patterns used by Clear.
+		if strings.ContainsAny(name, "*?[]\\") {
+			return fmt.Errorf("%w: outbox stream name %q must not contain glob characters", ErrInvalidOption, name)
+		}
+
+		s.outboxStream = name
+
+		return nil
+	}
+}
+
+// WithOperationTimeout limits the duration of operations on a single
+// aggregate, like Save, Load and LoadSnapshot, so that a hung Redis connection
+// fails fast with an eh.EventStoreError wrapping context.DeadlineExceeded. A
+// timed out Save may still have been written. Operations scanning the
+// namespace, like Clear, are not limited.
+//
+// The client must be created with ContextTimeoutEnabled, which makes it abort
+// the commands of the operation at the deadline, see WithCommandTimeout.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(s *EventStore) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: operation timeout must be positive, got %s", ErrInvalidOption, d)
+		}
+		if !contextTimeoutEnabled(s.db) {
+			return fmt.Errorf("%w: operation timeouts require a client created with ContextTimeoutEnabled", ErrInvalidOption)
+		}
+
+		s.operationTimeout = d
+
+		return nil
+	}
+}
+
+// WithMaxEventSize rejects saving events with marshaled event data larger
+// than the number of bytes with ErrEventTooLarge, protecting Redis from
+// oversized events. The size is checked before compression. Zero means
+// unlimited, which is the default.
+func WithMaxEventSize(bytes int) Option {
+	return func(s *EventStore) error {
+		if bytes < 0 {
+			return fmt.Errorf("%w: max event size must not be negative, got %d", ErrInvalidOption, bytes)
+		}
+
+		s.maxEventSize = bytes
+
+		return nil
+	}
+}
+
+// WithMaxSaveBatch rejects saving more than n events in a single Save with
+// ErrBatchTooLarge, before anything is written, which bounds the size of the
+// atomic write of a save. Larger batches are not split into several writes,
+// as a conflict after the first write would leave the aggregate partially
+// saved; save them with several calls of Save instead. Zero means unlimited,
+// which is the default. Import is limited too.
+func WithMaxSaveBatch(n int) Option {
+	return func(s *EventStore) error {
+		if n < 0 {
+			return fmt.Errorf("%w: max save batch must not be negative, got %d", ErrInvalidOption, n)
+		}
+
+		s.maxSaveBatch = n
+
+		return nil
+	}
+}
+
+// WithSchemaValidator validates the marshaled JSON data of every saved event
+// with the validator, for example against a JSON Schema of the event type.
+// When the validator returns an error, Save returns it wrapped in
+// ErrInvalidEventData and nothing is written. Events without data are not
+// validated. The validator requires the JSON encoder.
+func WithSchemaValidator(validator func(eh.EventType, json.RawMessage) error) Option {
+	return func(s *EventStore) error {
+		if validator == nil {
+			return fmt.Errorf("%w: schema validator must not be nil", ErrInvalidOption)
+		}
+
+		s.schemaValidator = validator
+
+		return nil
+	}
+}
+
+// WithNamespaceAllowlist only allows the namespaces in the context of the
+// operations on a namespace, like Save, Load, Version, LoadAggregateRecord,
+// Clear, Replace and the snapshot methods, which return
+// ErrNamespaceNotAllowed for other namespaces. It guards against writing to
+// the keyspace of another tenant when the namespace is propagated wrongly. An
+// empty allowlist allows all namespaces, which is the default.
+func WithNamespaceAllowlist(namespaces []string) Option {
+	return func(s *EventStore) error {
+		if len(namespaces) == 0 {
+			s.namespaces = nil
+
+			return nil
+		}
+
+		s.namespaces = make(map[string]struct{}, len(namespaces))
+		for _, ns := range namespaces {
+			s.namespaces[ns] = struct{}{}
+		}
+
+		return nil
+	}
+}
+
+// WithClock sets the clock of the timestamps generated by the store, which is
+// time.Now by default, to make tests deterministic like WithUUIDFunc does for
+// event IDs. Snapshots saved without a timestamp are stamped with the clock.
+// Event timestamps are set by the events, and the IDs of outbox and global
+// log entries are generated by Redis.
+func WithClock(clock func() time.Time) Option {
+	return func(s *EventStore) error {
+		if clock == nil {
+			return fmt.Errorf("%w: clock must not be nil", ErrInvalidOption)
+		}
+
+		s.clock = clock
+
+		return nil
+	}
+}
+
+// WithUUIDFunc sets the generator of the event IDs of the store, instead of
+// the package variable NewUUID, so that stores in parallel tests can each
+// generate their own IDs.
+func WithUUIDFunc(newUUID func() uuid.UUID) Option {
+	return func(s *EventStore) error {
+		if newUUID == nil {
+			return fmt.Errorf("%w: UUID func must not be nil", ErrInvalidOption)
+		}
+
+		s.uuidFunc = newUUID
+
+		return nil
+	}
+}
+
+// WithClearBatchSize sets the number of keys scanned and unlinked per pipeline
+// by Clear, which is 500 by default. Larger batches need fewer round trips,
+// smaller batches keep the pipelines short on busy servers.
+func WithClearBatchSize(n int) Option {
+	return func(s *EventStore) error {
+		if n < 1 {
+			return fmt.Errorf("%w: clear batch size must be positive, got %d", ErrInvalidOption, n)
+		}
+
+		s.clearBatchSize = int64(n)
+
+		return nil
+	}
+}
+
+// WithMetadataFromContext adds the meta data returned by f for the context of
+// Save to every saved event, for example to stamp a correlation ID carried in
+// the context on all events. Meta data of the event is kept when both have the
+// same key.
+func WithMetadataFromContext(f func(ctx context.Context) map[string]interface{}) Option {
+	return func(s *EventStore) error {
+		if f == nil {
+			return fmt.Errorf("%w: context meta data function must not be nil", ErrInvalidOption)
+		}
+
+		s.contextMetadata = f
+
+		return nil
+	}
+}
+
+// WithAfterSave calls hook with the events after Save wrote them, for example
+// to update in-process projections without an event bus. The hook is not
+// called when Save fails, including version conflicts, but is called for
+// batches treated as saved by WithIdempotentSave. It is called synchronously
+// before Save returns, so blocking in the hook blocks the caller of Save;
+// start a goroutine for heavy work.
+func WithAfterSave(hook func(ctx context.Context, events []eh.Event)) Option {
+	return func(s *EventStore) error {
+		if hook == nil {
+			return fmt.Errorf("%w: after save hook must not be nil", ErrInvalidOption)
+		}
+
+		s.afterSave = hook
+
+		return nil
+	}
+}
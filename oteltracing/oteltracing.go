@@ -0,0 +1,66 @@
+// Package oteltracing records the spans of the operations of the Redis event
+// store with OpenTelemetry, see ehpg.WithTracer.
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+	ehpg "github.com/terraskye/eh-redis"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is an ehpg.Tracer recording the spans of the store as OpenTelemetry
+// client spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer starting the spans with the tracer, which must
+// not be nil.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements the Start method of the ehpg.Tracer interface.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...ehpg.Attribute) (context.Context, ehpg.Span) {
+	ctx, sp := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(keyValues(attrs)...))
+
+	return ctx, span{span: sp}
+}
+
+// span is a started OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+// End implements the End method of the ehpg.Span interface.
+func (sp span) End(err error, attrs ...ehpg.Attribute) {
+	if err != nil {
+		sp.span.RecordError(err)
+		sp.span.SetStatus(codes.Error, err.Error())
+	}
+	sp.span.SetAttributes(keyValues(attrs)...)
+	sp.span.End()
+}
+
+// keyValues returns the OpenTelemetry attributes of the attributes of the
+// store, formatting values of other types than string and int64.
+func keyValues(attrs []ehpg.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		key := attribute.Key(a.Key)
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, key.String(v))
+		case int64:
+			kvs = append(kvs, key.Int64(v))
+		default:
+			kvs = append(kvs, key.String(fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
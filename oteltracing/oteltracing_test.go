@@ -0,0 +1,99 @@
+package oteltracing_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	ehpg "github.com/terraskye/eh-redis"
+	"github.com/terraskye/eh-redis/oteltracing"
+	"github.com/terraskye/eh-redis/redistest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	store, _ := redistest.NewTestEventStore(t, ehpg.WithTracer(oteltracing.NewTracer(provider.Tracer("test"))))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	parentCtx, parent := provider.Tracer("test").Start(ctx, "parent")
+
+	id := uuid.New()
+	if err := store.Save(parentCtx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(parentCtx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(parentCtx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err == nil {
+		t.Fatal("there should be a version conflict")
+	}
+	if err := store.Clear(parentCtx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatal("there should be five spans:", len(spans))
+	}
+
+	for i, name := range []string{"EventStore.Save", "EventStore.Load", "EventStore.Save", "EventStore.Clear"} {
+		span := spans[i]
+		if span.Name() != name {
+			t.Error("the span name should be correct:", span.Name())
+		}
+		if span.SpanKind() != trace.SpanKindClient {
+			t.Error("the span should be a client span:", span.Name(), span.SpanKind())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Error("the span should be a child of the context span:", span.Name())
+		}
+
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, attr := range span.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		if attrs["eventhorizon.namespace"].AsString() != "ns" {
+			t.Error("the span should have the namespace:", span.Name(), attrs)
+		}
+		if attrs["redis.round_trips"].AsInt64() < 1 {
+			t.Error("the span should count the round trips:", span.Name(), attrs)
+		}
+		if i == 2 {
+			if span.Status().Code != codes.Error || len(span.Events()) == 0 {
+				t.Error("the span should record the error:", span.Status())
+			}
+			continue
+		}
+		if span.Status().Code == codes.Error {
+			t.Error("the span should not have an error:", span.Name(), span.Status())
+		}
+		if name == "EventStore.Clear" {
+			continue
+		}
+		if attrs["eventhorizon.aggregate_id"].AsString() != id.String() {
+			t.Error("the span should have the aggregate ID:", span.Name(), attrs)
+		}
+		if attrs["eventhorizon.event_count"].AsInt64() != 2 {
+			t.Error("the span should have the event count:", span.Name(), attrs)
+		}
+	}
+}
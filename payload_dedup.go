@@ -0,0 +1,320 @@
+package ehpg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// payloadHashSize is the number of bytes of the SHA-256 hash of the event data
+// stored with every event by WithPayloadDedup.
+const payloadHashSize = 16
+
+// WithPayloadDedup stores a hash of the encoded event data with every event,
+// and stores events with the same event data as the previous event of the
+// aggregate as a reference to the event holding the event data, instead of
+// storing the event data again. This reduces the memory of aggregates
+// repeating large payloads, like periodic state reports, and events without
+// event data are never deduplicated.
+//
+// Loading resolves the references transparently, also in stores without the
+// option, so the option can be enabled on running aggregates. It comes at a
+// cost:
+//
+//   - every event stores the hash, about 30 bytes, also when its event data is
+//     never repeated;
+//   - saving reads the latest stored event before writing the events, which
+//     is an extra round trip per save, and the write checks that the event
+//     holding the referenced event data is unchanged, storing the event data
+//     again when it was compacted or replaced in the meantime;
+//   - loading single versions or ranges, like LoadFrom and LoadStream, fetches
+//     the referenced events outside the range in an extra round trip;
+//   - Compact and Replace must run on stores with the option, which move the
+//     event data of the removed or replaced events to the events referencing
+//     them.
+//
+// Deduplication can't be combined with WithEncryption, as equal hashes would
+// reveal equal plaintexts, and the referenced event data could be encrypted
+// with another key than the referencing event.
+func WithPayloadDedup() Option {
+	return func(s *EventStore) error {
+		s.payloadDedup = true
+
+		return nil
+	}
+}
+
+// payloadHash returns the hash of encoded event data.
+func payloadHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.RawStdEncoding.EncodeToString(sum[:payloadHashSize])
+}
+
+// isPayloadRef returns whether a stored event may be a deduplicated event,
+// without unmarshaling the events that are not.
+func isPayloadRef(dbEvent string) bool {
+	return strings.Contains(dbEvent, `"pr":`) || strings.Contains(dbEvent, `"PayloadRef":`)
+}
+
+// dedupPayloads replaces the event data of the events with the same event data
+// as the event before them with a reference to the event holding the event
+// data. The event data of the references is kept for the outbox stream.
+func (s *EventStore) dedupPayloads(ctx context.Context, ns string, originalVersion int, dbEvents []versionedEvent) error {
+	hash, origin := "", 0
+	if originalVersion > 0 {
+		key := s.aggregateKey(ns, dbEvents[0].event.AggregateID)
+		stored, err := s.loadStoredRange(ctx, s.client(ns), key, originalVersion, originalVersion).events()
+		if err != nil {
+			return eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotSaveAggregate,
+			}
+		}
+
+		// The events are only deduplicated against a readable previous event,
+		// the save fails on a missing one.
+		prev := AggregateEvent{}
+		if raw, ok := stored[strconv.Itoa(originalVersion)]; ok && prev.UnmarshalBinary([]byte(raw)) == nil {
+			hash, origin = prev.PayloadHash, prev.Version
+			if prev.PayloadRef != 0 {
+				origin = prev.PayloadRef
+			}
+		}
+	}
+
+	for i := range dbEvents {
+		e := &dbEvents[i].event
+		if e.PayloadHash != "" && e.PayloadHash == hash {
+			e.payload = e.storedEventData()
+			e.RawEventData, e.BinaryEventData = nil, nil
+			e.PayloadRef = origin
+		} else {
+			origin = e.Version
+		}
+		hash = e.PayloadHash
+	}
+
+	return nil
+}
+
+// errPayloadOriginChanged is returned by the writes of a save when the event
+// holding the event data referenced by the saved events was compacted or
+// replaced since dedupPayloads read it.
+var errPayloadOriginChanged = errors.New("referenced event data changed")
+
+// payloadOrigin returns the version and payload hash of the stored event
+// holding the event data referenced by the deduplicated events, or 0 when
+// they only reference events saved with them.
+func payloadOrigin(originalVersion int, dbEvents []versionedEvent) (int, string) {
+	for _, e := range dbEvents {
+		if e.event.payload != nil && e.event.PayloadRef != 0 && e.event.PayloadRef <= originalVersion {
+			return e.event.PayloadRef, e.event.PayloadHash
+		}
+	}
+	return 0, ""
+}
+
+// checkPayloadOrigin returns errPayloadOriginChanged when the stored event
+// referenced by the deduplicated events no longer holds their event data, in
+// the WATCH transaction of a save.
+func (s *EventStore) checkPayloadOrigin(ctx context.Context, c commands, key string, originalVersion int, dbEvents []versionedEvent) error {
+	origin, hash := payloadOrigin(originalVersion, dbEvents)
+	if origin == 0 {
+		return nil
+	}
+
+	stored, err := s.loadStoredRange(ctx, c, key, origin, origin).events()
+	if err != nil {
+		return err
+	}
+	e := AggregateEvent{}
+	if raw, ok := stored[strconv.Itoa(origin)]; !ok || e.UnmarshalBinary([]byte(raw)) != nil ||
+		e.PayloadHash != hash || e.PayloadRef != 0 {
+		return errPayloadOriginChanged
+	}
+
+	return nil
+}
+
+// keepPayloads stores the event data in the saved events referencing a stored
+// event again, with the first of them holding it for the others.
+func (s *EventStore) keepPayloads(originalVersion int, dbEvents []versionedEvent) {
+	newOrigin := 0
+	for i := range dbEvents {
+		e := &dbEvents[i].event
+		if e.payload == nil || e.PayloadRef == 0 || e.PayloadRef > originalVersion {
+			continue
+		}
+		if newOrigin == 0 {
+			s.restorePayload(e)
+			newOrigin = e.Version
+		} else {
+			e.PayloadRef = newOrigin
+		}
+	}
+}
+
+// restorePayload stores the kept event data of a deduplicated event in the
+// event again, like newDBEvent stored it.
+func (s *EventStore) restorePayload(e *AggregateEvent) {
+	if s.encoder.String() == "json" && s.compression == NoCompression {
+		e.RawEventData = e.payload
+	} else {
+		e.BinaryEventData = e.payload
+	}
+	e.PayloadRef = 0
+}
+
+// resolvePayloads wraps a queued command fetching stored events, resolving the
+// event data of the deduplicated events it fetched.
+func (s *EventStore) resolvePayloads(ctx context.Context, key string, cmd eventsCmd) eventsCmd {
+	return payloadsCmd{s: s, ctx: ctx, key: key, cmd: cmd}
+}
+
+// payloadsCmd fetches stored events with the event data of deduplicated events
+// resolved.
+type payloadsCmd struct {
+	s   *EventStore
+	ctx context.Context
+	key string
+	cmd eventsCmd
+}
+
+func (c payloadsCmd) events() (map[string]string, error) {
+	dbEvents, err := c.cmd.events()
+	if err != nil {
+		return dbEvents, err
+	}
+	return dbEvents, c.s.resolveRefs(c.ctx, c.key, dbEvents)
+}
+
+// resolveRefs replaces the deduplicated events of dbEvents with events holding
+// the event data of the event they reference, which is fetched in a single
+// round trip when it was not fetched with the events.
+func (s *EventStore) resolveRefs(ctx context.Context, key string, dbEvents map[string]string) error {
+	refs := map[string]AggregateEvent{}
+	for field, raw := range dbEvents {
+		if !isPayloadRef(raw) {
+			continue
+		}
+		// Events that can't be unmarshaled are left to fail when decoded.
+		e := AggregateEvent{}
+		if err := e.UnmarshalBinary([]byte(raw)); err == nil && e.PayloadRef != 0 {
+			refs[field] = e
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	origins := map[int]string{}
+	var missing []int
+	ns := ""
+	for _, e := range refs {
+		ns = e.Namespace
+		if _, ok := origins[e.PayloadRef]; ok {
+			continue
+		}
+		raw, ok := dbEvents[strconv.Itoa(e.PayloadRef)]
+		if !ok {
+			missing = append(missing, e.PayloadRef)
+		}
+		origins[e.PayloadRef] = raw
+	}
+	if len(missing) > 0 {
+		cmds := make([]eventsCmd, len(missing))
+		if _, err := s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, version := range missing {
+				cmds[i] = s.loadStoredRange(ctx, pipe, key, version, version)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for i, version := range missing {
+			fetched, err := cmds[i].events()
+			if err != nil {
+				return err
+			}
+			origins[version] = fetched[strconv.Itoa(version)]
+		}
+	}
+
+	parsed := map[int]AggregateEvent{}
+	for field, e := range refs {
+		origin, ok := parsed[e.PayloadRef]
+		if !ok {
+			if origins[e.PayloadRef] == "" {
+				return fmt.Errorf("event data of version %d, referenced by version %d, is missing", e.PayloadRef, e.Version)
+			}
+			if err := origin.UnmarshalBinary([]byte(origins[e.PayloadRef])); err != nil {
+				return err
+			}
+			parsed[e.PayloadRef] = origin
+		}
+		if origin.PayloadHash != e.PayloadHash {
+			return fmt.Errorf("event data of version %d, referenced by version %d, has changed", e.PayloadRef, e.Version)
+		}
+
+		e.RawEventData, e.BinaryEventData, e.PayloadRef = origin.RawEventData, origin.BinaryEventData, 0
+		b, err := e.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		dbEvents[field] = string(b)
+	}
+
+	return nil
+}
+
+// rehomePayloads returns the stored events referencing the event data of the
+// removed versions, with the event data moved to the first event referencing
+// it and the others referencing that event instead, to be set with the
+// removal.
+func rehomePayloads(dbEvents map[string]string, removed func(version int) bool) ([]AggregateEvent, error) {
+	var refs []AggregateEvent
+	for _, raw := range dbEvents {
+		if !isPayloadRef(raw) {
+			continue
+		}
+		e := AggregateEvent{}
+		if err := e.UnmarshalBinary([]byte(raw)); err != nil {
+			return nil, err
+		}
+		if e.PayloadRef != 0 && removed(e.PayloadRef) && !removed(e.Version) {
+			refs = append(refs, e)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Version < refs[j].Version
+	})
+
+	origins := map[int]int{}
+	for i := range refs {
+		e := &refs[i]
+		if version, ok := origins[e.PayloadRef]; ok {
+			e.PayloadRef = version
+			continue
+		}
+
+		raw, ok := dbEvents[strconv.Itoa(e.PayloadRef)]
+		if !ok {
+			return nil, fmt.Errorf("event data of version %d, referenced by version %d, is missing", e.PayloadRef, e.Version)
+		}
+		origin := AggregateEvent{}
+		if err := origin.UnmarshalBinary([]byte(raw)); err != nil {
+			return nil, err
+		}
+		origins[e.PayloadRef] = e.Version
+		e.RawEventData, e.BinaryEventData, e.PayloadRef = origin.RawEventData, origin.BinaryEventData, 0
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,210 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStorePayloadDedup(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithPayloadDedup(), rediseventstore.WithOutboxStream("outbox"))
+	otherStore, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "dedup")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+	defer db.Del(ctx, "outbox:dedup")
+
+	id := uuid.New()
+	newEvent := func(content string, version int) eh.Event {
+		return eh.NewEvent(mocks.EventType, &mocks.EventData{Content: content}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, version))
+	}
+	if err := store.Save(ctx, []eh.Event{
+		newEvent("a", 1), newEvent("a", 2), newEvent("b", 3),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		newEvent("b", 4), newEvent("b", 5),
+	}, 3); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Identical payloads are stored once, the repeats reference the first.
+	key := "dedup:{" + id.String() + "}"
+	for version, ref := range map[string]string{"2": `"pr":1`, "4": `"pr":3`, "5": `"pr":3`} {
+		raw, err := db.HGet(ctx, key, version).Result()
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if !strings.Contains(raw, ref) || strings.Contains(raw, `"d":`) {
+			t.Error("the event data should be referenced:", version, raw)
+		}
+	}
+	if raw, _ := db.HGet(ctx, key, "3").Result(); !strings.Contains(raw, `"d":`) {
+		t.Error("the event data should be stored:", raw)
+	}
+
+	// The outbox stream gets the event data of all events.
+	entries, err := db.XRange(ctx, "outbox:dedup", "-", "+").Result()
+	if err != nil || len(entries) != 5 {
+		t.Fatal("there should be five outbox entries:", entries, err)
+	}
+	if entries[4].Values["data"] != `{"Content":"b"}` {
+		t.Error("the data should be correct:", entries[4].Values)
+	}
+
+	checkContents := func(events []eh.Event, contents ...string) {
+		t.Helper()
+		if len(events) != len(contents) {
+			t.Fatal("there should be an event per content:", events, contents)
+		}
+		for i, event := range events {
+			if data, ok := event.Data().(*mocks.EventData); !ok || data.Content != contents[i] {
+				t.Error("the event data should be resolved:", event, contents[i])
+			}
+		}
+	}
+
+	for _, s := range []*rediseventstore.EventStore{store, otherStore} {
+		events, err := s.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		checkContents(events, "a", "a", "b", "b", "b")
+	}
+	events, err := store.LoadFrom(ctx, id, 5)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	checkContents(events, "b")
+
+	// Compacting moves the referenced event data to the kept events.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       4,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Compact(ctx, id, 4); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if events, err = store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	checkContents(events, "b", "b")
+	if raw, _ := db.HGet(ctx, key, "5").Result(); !strings.Contains(raw, `"pr":4`) {
+		t.Error("the event data should be referenced:", raw)
+	}
+
+	// Replacing moves the replaced event data to the referencing events.
+	if err := store.Replace(ctx, newEvent("c", 4)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if events, err = store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	checkContents(events, "c", "b")
+}
+
+func TestEventStorePayloadDedupOriginChanged(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script": nil,
+		"watch":  {rediseventstore.WithWatchSave()},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := redis.NewClient(&redis.Options{
+				Addr: "127.0.0.1:6379",
+			})
+			defer db.Close()
+
+			// The origin is removed after the save read it, like a Compact
+			// between reading and writing would.
+			hook := &afterCommandHook{name: "hmget"}
+			db.AddHook(hook)
+
+			store, err := rediseventstore.NewEventStore(db, append(options, rediseventstore.WithPayloadDedup())...)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			ctx := namespace.NewContext(context.Background(), "dedup")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			newEvent := func(version int) eh.Event {
+				return eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "a"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, version))
+			}
+			if err := store.Save(ctx, []eh.Event{newEvent(1)}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			key := "dedup:{" + id.String() + "}"
+			hook.after = func() {
+				db.HDel(context.Background(), key, "1")
+			}
+			if err := store.Save(ctx, []eh.Event{newEvent(2), newEvent(3)}, 1); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			// The saved events hold the event data themselves instead.
+			if raw, _ := db.HGet(ctx, key, "2").Result(); !strings.Contains(raw, `"d":`) || strings.Contains(raw, `"pr":`) {
+				t.Error("the event data should be stored:", raw)
+			}
+			if raw, _ := db.HGet(ctx, key, "3").Result(); !strings.Contains(raw, `"pr":2`) {
+				t.Error("the event data should be referenced:", raw)
+			}
+			events, err := store.LoadFrom(ctx, id, 2)
+			if err != nil || len(events) != 2 || events[1].Data().(*mocks.EventData).Content != "a" {
+				t.Error("the event data should be resolved:", events, err)
+			}
+		})
+	}
+}
+
+// afterCommandHook calls after once after the first command with the name.
+type afterCommandHook struct {
+	name  string
+	after func()
+}
+
+func (h *afterCommandHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *afterCommandHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if cmd.Name() == h.name && h.after != nil {
+			after := h.after
+			h.after = nil
+			after()
+		}
+		return err
+	}
+}
+
+func (h *afterCommandHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
@@ -0,0 +1,118 @@
+// Package prometheusmetrics records the metrics of the operations of the Redis
+// event store as Prometheus metrics, see ehpg.WithMetrics.
+package prometheusmetrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Metrics is an ehpg.Metrics recording Prometheus metrics. Stores sharing a
+// registerer share the metrics. The metrics are:
+//
+//	eh_redis_operation_duration_seconds{operation, namespace}
+//	eh_redis_operation_errors_total{operation, namespace}
+//	eh_redis_events_saved_total{namespace}
+//	eh_redis_events_loaded_total{namespace}
+//	eh_redis_version_conflicts_total{namespace}
+type Metrics struct {
+	duration     *prometheus.HistogramVec
+	errors       *prometheus.CounterVec
+	eventsSaved  *prometheus.CounterVec
+	eventsLoaded *prometheus.CounterVec
+	conflicts    *prometheus.CounterVec
+}
+
+// New registers the metrics with the registerer, reusing the metrics already
+// registered by another store.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		return nil, errors.New("registerer must not be nil")
+	}
+
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "eh_redis_operation_duration_seconds",
+			Help:    "Duration of event store operations.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation", "namespace"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "eh_redis_operation_errors_total",
+			Help: "Number of failed event store operations.",
+		}, []string{"operation", "namespace"}),
+		eventsSaved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "eh_redis_events_saved_total",
+			Help: "Number of saved events.",
+		}, []string{"namespace"}),
+		eventsLoaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "eh_redis_events_loaded_total",
+			Help: "Number of loaded events.",
+		}, []string{"namespace"}),
+		conflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "eh_redis_version_conflicts_total",
+			Help: "Number of saves rejected with a version conflict.",
+		}, []string{"namespace"}),
+	}
+
+	var err error
+	if m.duration, err = register(reg, m.duration); err != nil {
+		return nil, err
+	}
+	if m.errors, err = register(reg, m.errors); err != nil {
+		return nil, err
+	}
+	if m.eventsSaved, err = register(reg, m.eventsSaved); err != nil {
+		return nil, err
+	}
+	if m.eventsLoaded, err = register(reg, m.eventsLoaded); err != nil {
+		return nil, err
+	}
+	if m.conflicts, err = register(reg, m.conflicts); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// register registers the collector, or returns the already registered
+// collector with the same description.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+
+	return c, err
+}
+
+// ObserveOperation implements the ObserveOperation method of the ehpg.Metrics
+// interface.
+func (m *Metrics) ObserveOperation(operation, namespace string, duration time.Duration, err error) {
+	m.duration.WithLabelValues(operation, namespace).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(operation, namespace).Inc()
+	}
+}
+
+// AddEventsSaved implements the AddEventsSaved method of the ehpg.Metrics
+// interface.
+func (m *Metrics) AddEventsSaved(namespace string, n int) {
+	m.eventsSaved.WithLabelValues(namespace).Add(float64(n))
+}
+
+// AddEventsLoaded implements the AddEventsLoaded method of the ehpg.Metrics
+// interface.
+func (m *Metrics) AddEventsLoaded(namespace string, n int) {
+	m.eventsLoaded.WithLabelValues(namespace).Add(float64(n))
+}
+
+// IncVersionConflicts implements the IncVersionConflicts method of the
+// ehpg.Metrics interface.
+func (m *Metrics) IncVersionConflicts(namespace string) {
+	m.conflicts.WithLabelValues(namespace).Inc()
+}
@@ -0,0 +1,75 @@
+package prometheusmetrics_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	ehpg "github.com/terraskye/eh-redis"
+	"github.com/terraskye/eh-redis/prometheusmetrics"
+	"github.com/terraskye/eh-redis/redistest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := prometheusmetrics.New(reg)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store, _ := redistest.NewTestEventStore(t, ehpg.WithMetrics(m))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, events[:1], 0); err == nil {
+		t.Fatal("there should be a version conflict")
+	}
+	if _, err := store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	expected := `
+# HELP eh_redis_events_loaded_total Number of loaded events.
+# TYPE eh_redis_events_loaded_total counter
+eh_redis_events_loaded_total{namespace="ns"} 2
+# HELP eh_redis_events_saved_total Number of saved events.
+# TYPE eh_redis_events_saved_total counter
+eh_redis_events_saved_total{namespace="ns"} 2
+# HELP eh_redis_version_conflicts_total Number of saves rejected with a version conflict.
+# TYPE eh_redis_version_conflicts_total counter
+eh_redis_version_conflicts_total{namespace="ns"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"eh_redis_events_loaded_total",
+		"eh_redis_events_saved_total",
+		"eh_redis_version_conflicts_total",
+	); err != nil {
+		t.Error("the metrics should be recorded:", err)
+	}
+	if n := testutil.CollectAndCount(reg, "eh_redis_operation_duration_seconds"); n != 2 {
+		t.Error("there should be durations of the save and load operations:", n)
+	}
+
+	// Another store can share the registry.
+	if _, err := prometheusmetrics.New(reg); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := prometheusmetrics.New(nil); err == nil {
+		t.Error("there should be an error")
+	}
+}
@@ -0,0 +1,74 @@
+package ehpg
+
+import (
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+// ErrProtoEventDataNotRegistered is when no proto message is registered for an event type.
+var ErrProtoEventDataNotRegistered = errors.New("proto event data not registered")
+
+var protoEventDataFactories = make(map[eh.EventType]func() proto.Message)
+var protoEventDataFactoriesMu sync.RWMutex
+
+// RegisterProtoEventData registers a factory returning a fresh proto message
+// for the data of an event type, used by the proto encoder to unmarshal it.
+func RegisterProtoEventData(eventType eh.EventType, factory func() proto.Message) {
+	protoEventDataFactoriesMu.Lock()
+	defer protoEventDataFactoriesMu.Unlock()
+
+	protoEventDataFactories[eventType] = factory
+}
+
+// createProtoEventData creates the proto message for the data of an event type.
+func createProtoEventData(eventType eh.EventType) (proto.Message, error) {
+	protoEventDataFactoriesMu.RLock()
+	defer protoEventDataFactoriesMu.RUnlock()
+
+	if factory, ok := protoEventDataFactories[eventType]; ok {
+		return factory(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrProtoEventDataNotRegistered, eventType)
+}
+
+// NewProtoEncoder returns an Encoder marshaling event data as protobuf. The
+// event data must be proto messages registered with RegisterProtoEventData.
+func NewProtoEncoder() Encoder {
+	return protoEncoder{}
+}
+
+type protoEncoder struct{}
+
+func (protoEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	message, ok := data.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("event data of type %T is not a proto message", data)
+	}
+	return proto.Marshal(message)
+}
+
+func (protoEncoder) Unmarshal(eventType eh.EventType, raw []byte) (eh.EventData, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	message, err := createProtoEventData(eventType)
+	if err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(raw, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (protoEncoder) String() string {
+	return "proto"
+}
@@ -0,0 +1,76 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+	"time"
+)
+
+const protoEventType eh.EventType = "ProtoEvent"
+
+func init() {
+	rediseventstore.RegisterProtoEventData(protoEventType, func() proto.Message {
+		return &wrapperspb.StringValue{}
+	})
+}
+
+func TestProtoEncoder(t *testing.T) {
+	encoder := rediseventstore.NewProtoEncoder()
+
+	raw, err := encoder.Marshal(wrapperspb.String("content"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	data, err := encoder.Unmarshal(protoEventType, raw)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if value, ok := data.(*wrapperspb.StringValue); !ok || value.GetValue() != "content" {
+		t.Error("the data should be unmarshaled:", data)
+	}
+
+	if _, err := encoder.Marshal(&mocks.EventData{Content: "json"}); err == nil {
+		t.Error("there should be an error for non proto data")
+	}
+	if _, err := encoder.Unmarshal(mocks.EventType, raw); err == nil {
+		t.Error("there should be an error for an unregistered event type")
+	}
+}
+
+func TestEventStoreProtoEncoder(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithEncoder(rediseventstore.NewProtoEncoder()))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(protoEventType, wrapperspb.String("content"), time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	if value, ok := events[0].Data().(*wrapperspb.StringValue); !ok || value.GetValue() != "content" {
+		t.Error("the data should be loaded:", events[0].Data())
+	}
+}
@@ -0,0 +1,53 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"time"
+)
+
+// ErrNotWritable is when Redis can be reached but not written, for example
+// when a Sentinel configuration only reaches read replicas.
+var ErrNotWritable = errors.New("redis is not writable")
+
+// readinessKeyTTL is the expiry of the scratch key written by CheckWritable.
+const readinessKeyTTL = time.Second
+
+// WithWritableCheck makes NewEventStore check that the client writes to a
+// master with CheckWritable, instead of only pinging Redis, which also
+// succeeds against read replicas. This catches misconfigured Sentinel
+// topologies at startup.
+func WithWritableCheck() Option {
+	return func(s *EventStore) error {
+		s.writableCheck = true
+
+		return nil
+	}
+}
+
+// CheckWritable checks that the store can write to Redis by setting a scratch
+// key, which expires after a second. It returns ErrNotWritable when the client
+// only reaches read replicas, and can be used as a readiness check.
+func (s *EventStore) CheckWritable(ctx context.Context) error {
+	_, err := withTimeout(ctx, s, ErrCouldNotPing, func(ctx context.Context) (string, error) {
+		return s.wrapClient(s.db).Set(ctx, s.keyPrefix+"readiness", s.clock().UnixNano(), readinessKeyTTL).Result()
+	})
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return storeErr
+	} else if isReadOnlyError(err) {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrNotWritable,
+		}
+	} else if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotPing,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+)
+
+func TestEventStoreCheckWritable(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithWritableCheck())
+
+	if err := store.CheckWritable(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// A read replica rejects writes.
+	db.AddHook(newFailingHook("set", errors.New("READONLY You can't write against a read only replica."), 1))
+	if err := store.CheckWritable(context.Background()); !errors.Is(err, rediseventstore.ErrNotWritable) {
+		t.Error("there should be a not writable error:", err)
+	}
+
+	_ = db.Close()
+	if err := store.CheckWritable(context.Background()); !errors.Is(err, rediseventstore.ErrCouldNotPing) {
+		t.Error("there should be a ping error:", err)
+	}
+}
+
+func TestNewEventStoreWritableCheck(t *testing.T) {
+	db := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+
+	defer db.Close()
+
+	db.AddHook(newFailingHook("set", errors.New("READONLY You can't write against a read only replica."), 1))
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithWritableCheck(), rediseventstore.WithSharedClient()); !errors.Is(err, rediseventstore.ErrNotWritable) {
+		t.Error("there should be a not writable error:", err)
+	}
+
+	// Without the check, only reaching a replica is not detected.
+	db.AddHook(newFailingHook("set", errors.New("READONLY You can't write against a read only replica."), 1))
+	if _, err := rediseventstore.NewEventStore(db, rediseventstore.WithSharedClient()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
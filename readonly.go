@@ -0,0 +1,46 @@
+package ehpg
+
+import (
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"sync/atomic"
+)
+
+// ErrReadOnly is when the store is written in read-only mode.
+var ErrReadOnly = errors.New("event store is read-only")
+
+// WithReadOnly starts the store in read-only mode, see SetReadOnly.
+func WithReadOnly() Option {
+	return func(s *EventStore) error {
+		s.SetReadOnly(true)
+
+		return nil
+	}
+}
+
+// SetReadOnly switches the read-only mode of the store, for example during a
+// maintenance window. In read-only mode all writes, like Save, Clear, Replace,
+// SaveSnapshot, Compact, Import and renaming, return ErrReadOnly, while loads
+// keep working.
+func (s *EventStore) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&s.readOnly, v)
+}
+
+// isReadOnly returns true in read-only mode.
+func (s *EventStore) isReadOnly() bool {
+	return atomic.LoadInt32(&s.readOnly) == 1
+}
+
+// checkWrite returns ErrReadOnly in read-only mode.
+func (s *EventStore) checkWrite() error {
+	if s.isReadOnly() {
+		return eh.EventStoreError{
+			Err: ErrReadOnly,
+		}
+	}
+	return nil
+}
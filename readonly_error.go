@@ -0,0 +1,91 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"strings"
+	"time"
+)
+
+// ErrRedisReadOnly is when a write hits a read-only replica, for example
+// during a failover of managed Redis, and still does after the retries of
+// WithReadonlyErrorRetry. It differs from ErrReadOnly, which is the read-only
+// mode of the store.
+var ErrRedisReadOnly = errors.New("redis is read-only")
+
+// readOnlyRetryDelay is the delay before retrying a write failing with a
+// READONLY error, which gives the client time to rediscover the master.
+const readOnlyRetryDelay = 100 * time.Millisecond
+
+// WithReadonlyErrorRetry retries Save and Clear up to n times when they fail
+// with a READONLY error of a replica, waiting a short delay before every
+// retry, or the delays of WithBackoff. A write that still fails returns
+// ErrRedisReadOnly, which it also does without retries.
+func WithReadonlyErrorRetry(n int) Option {
+	return func(s *EventStore) error {
+		if n < 0 {
+			return fmt.Errorf("%w: read-only error retries must not be negative, got %d", ErrInvalidOption, n)
+		}
+
+		s.readOnlyRetries = n
+
+		return nil
+	}
+}
+
+// retryReadOnly calls write until it succeeds, fails with an error that is
+// not a READONLY error, or the retries are used up, in which case
+// ErrRedisReadOnly is returned. A READONLY error is returned before a write is
+// made, so retrying can't save events twice.
+func (s *EventStore) retryReadOnly(ctx context.Context, write func() error) error {
+	backoff := s.backoff
+	if backoff == nil {
+		backoff = NewConstantBackoff(readOnlyRetryDelay)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if !isReadOnlyError(err) {
+			return err
+		}
+
+		delay := backoff.NextDelay(attempt)
+		if attempt <= s.readOnlyRetries && canRetry(ctx, delay) {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+			case <-t.C:
+				continue
+			}
+		}
+
+		if attempt > 1 {
+			err = fmt.Errorf("%w after %d attempts", err, attempt)
+		}
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrRedisReadOnly,
+		}
+	}
+}
+
+// isReadOnlyError returns true for the READONLY error of writes to a replica,
+// including the base errors of event store errors.
+func isReadOnlyError(err error) bool {
+	for err != nil {
+		if strings.HasPrefix(err.Error(), "READONLY ") {
+			return true
+		}
+
+		var storeErr eh.EventStoreError
+		if !errors.As(err, &storeErr) {
+			return false
+		}
+		err = storeErr.BaseErr
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventStoreReadonlyErrorRetry(t *testing.T) {
+	readOnlyErr := errors.New("READONLY You can't write against a read only replica.")
+
+	store, db := newEventStore(t,
+		rediseventstore.WithReadonlyErrorRetry(2),
+		rediseventstore.WithBackoff(rediseventstore.NewConstantBackoff(time.Millisecond)))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// The save succeeds once the client reaches the master again.
+	hook := newFailingHook("evalsha", readOnlyErr, 2)
+	db.AddHook(hook)
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if calls := atomic.LoadInt32(hook.calls); calls != 3 {
+		t.Error("the save should be retried twice:", calls)
+	}
+
+	// A replica that stays read-only fails the save.
+	hook = newFailingHook("evalsha", readOnlyErr, 3)
+	db.AddHook(hook)
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); !errors.Is(err, rediseventstore.ErrRedisReadOnly) {
+		t.Error("there should be a read-only error:", err)
+	}
+	if calls := atomic.LoadInt32(hook.calls); calls != 3 {
+		t.Error("the save should be retried twice:", calls)
+	}
+
+	// Clearing is retried too.
+	hook = newFailingHook("unlink", readOnlyErr, 1)
+	db.AddHook(hook)
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if calls := atomic.LoadInt32(hook.calls); calls < 2 {
+		t.Error("the clear should be retried:", calls)
+	}
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 0 {
+		t.Error("the aggregate should be cleared:", events, err)
+	}
+
+	// Without retries the error is returned right away.
+	store, db = newEventStore(t)
+	db.AddHook(newFailingHook("evalsha", readOnlyErr, 1))
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, uuid.New(), 1)),
+	}, 0); !errors.Is(err, rediseventstore.ErrRedisReadOnly) {
+		t.Error("there should be a read-only error:", err)
+	}
+}
@@ -0,0 +1,98 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreReadOnly(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithReadOnly())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		store.SetReadOnly(false)
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+		eh.ForAggregate(mocks.AggregateType, id, 1))
+	if err := store.Save(ctx, []eh.Event{event}, 0); !errors.Is(err, rediseventstore.ErrReadOnly) {
+		t.Error("there should be a read-only error:", err)
+	}
+
+	store.SetReadOnly(false)
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	snapshot := rediseventstore.Snapshot{
+		Version:       1,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+		State:         map[string]interface{}{"content": "state"},
+	}
+	if err := store.SaveSnapshot(ctx, id, snapshot); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store.SetReadOnly(true)
+
+	writes := map[string]func() error{
+		"Save": func() error {
+			return store.Save(ctx, []eh.Event{eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 2))}, 1)
+		},
+		"Clear": func() error {
+			return store.Clear(ctx)
+		},
+		"Replace": func() error {
+			return store.Replace(ctx, event)
+		},
+		"SaveSnapshot": func() error {
+			return store.SaveSnapshot(ctx, id, snapshot)
+		},
+		"Compact": func() error {
+			_, err := store.Compact(ctx, id, 1)
+			return err
+		},
+		"RenameEvent": func() error {
+			return store.RenameEvent(ctx, mocks.EventType, mocks.EventOtherType)
+		},
+		"RenameAggregateType": func() error {
+			_, err := store.RenameAggregateType(ctx, mocks.AggregateType, "Other")
+			return err
+		},
+		"Import": func() error {
+			return store.Import(ctx, strings.NewReader(`[{"AggregateID":"`+uuid.New().String()+`","Version":1}]`))
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, rediseventstore.ErrReadOnly) {
+			t.Error(name, "should return a read-only error:", err)
+		}
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the events should be loaded:", events)
+	}
+	if _, err := store.LoadFrom(ctx, id, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if loaded, err := store.LoadSnapshot(ctx, id); err != nil || loaded == nil {
+		t.Error("the snapshot should be loaded:", loaded, err)
+	}
+}
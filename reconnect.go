@@ -0,0 +1,80 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"io"
+	"syscall"
+	"time"
+)
+
+// WithReconnectRetry retries an operation once when it fails with a
+// connection error, like a refused connection or an EOF after Redis
+// restarted, if Redis can be pinged again. This smooths over the first
+// failing operation after a brief outage, as the client only reconnects when
+// the next command is sent. Like WithSaveRetries, a retried save can find the
+// events of the first attempt already saved, which is then returned as a
+// version conflict. It is disabled by default.
+func WithReconnectRetry(enabled bool) Option {
+	return func(s *EventStore) error {
+		s.reconnectRetry = enabled
+
+		return nil
+	}
+}
+
+// withReconnect returns f retrying once after a connection error when
+// WithReconnectRetry is enabled and Redis can be pinged, after the first delay
+// of WithBackoff.
+func withReconnect[T any](s *EventStore, f func(context.Context) (T, error)) func(context.Context) (T, error) {
+	if !s.reconnectRetry {
+		return f
+	}
+
+	return func(ctx context.Context) (T, error) {
+		value, err := f(ctx)
+		if err == nil || !isConnectionError(err) {
+			return value, err
+		}
+
+		if s.backoff != nil {
+			t := time.NewTimer(s.backoff.NextDelay(1))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return value, err
+			case <-t.C:
+			}
+		}
+
+		// The ping reconnects, and fails when Redis is still down.
+		if pingErr := s.wrapClient(s.db).Ping(ctx).Err(); pingErr != nil {
+			return value, err
+		}
+
+		return f(ctx)
+	}
+}
+
+// isConnectionError returns true for errors of a lost or refused connection,
+// including the base errors of event store errors.
+func isConnectionError(err error) bool {
+	for err != nil {
+		if errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.EPIPE) {
+			return true
+		}
+
+		var storeErr eh.EventStoreError
+		if !errors.As(err, &storeErr) {
+			return false
+		}
+		err = storeErr.BaseErr
+	}
+
+	return false
+}
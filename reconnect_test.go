@@ -0,0 +1,79 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestEventStoreReconnectRetry(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithReconnectRetry(true))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	saveHook := newFailingHook("evalsha", syscall.ECONNREFUSED, 1)
+	db.AddHook(saveHook)
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if calls := atomic.LoadInt32(saveHook.calls); calls != 2 {
+		t.Error("the save should be retried once:", calls)
+	}
+
+	loadHook := newFailingHook("hgetall", io.EOF, 1)
+	db.AddHook(loadHook)
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the event should be loaded:", events)
+	}
+
+	// The error is returned when the retry fails too.
+	atomic.StoreInt32(loadHook.failures, 2)
+	atomic.StoreInt32(loadHook.calls, 0)
+	if _, err := store.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotLoadAggregate) {
+		t.Error("there should be a could not load error:", err)
+	}
+	if calls := atomic.LoadInt32(loadHook.calls); calls != 2 {
+		t.Error("the load should be retried once:", calls)
+	}
+}
+
+func TestEventStoreReconnectRetryDisabled(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	hook := newFailingHook("hgetall", io.EOF, 1)
+	db.AddHook(hook)
+
+	if _, err := store.Load(ctx, uuid.New()); !errors.Is(err, rediseventstore.ErrCouldNotLoadAggregate) {
+		t.Error("there should be a could not load error:", err)
+	}
+	if calls := atomic.LoadInt32(hook.calls); calls != 1 {
+		t.Error("the load should not be retried:", calls)
+	}
+}
@@ -0,0 +1,67 @@
+package redistest
+
+import (
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	ehpg "github.com/terraskye/eh-redis"
+	"sync/atomic"
+)
+
+// ErrEncoderFailure is the error of a FailingEncoder failing on demand.
+var ErrEncoderFailure = errors.New("encoder failure")
+
+// FailingEncoder is an ehpg.Encoder failing to marshal or unmarshal event data
+// on demand, to test the error paths of code saving and loading events, like
+// the ehpg.ErrCouldNotMarshalEvent and ehpg.ErrCouldNotUnmarshalEvent errors
+// of Save and Load. Otherwise it uses the wrapped encoder, whose name it keeps,
+// so that its events can be loaded by stores with the wrapped encoder.
+type FailingEncoder struct {
+	ehpg.Encoder
+	failMarshal   int32
+	failUnmarshal int32
+}
+
+// NewFailingEncoder returns a FailingEncoder wrapping the encoder, or the
+// default JSON encoder when the encoder is nil. It doesn't fail until told to.
+func NewFailingEncoder(encoder ehpg.Encoder) *FailingEncoder {
+	if encoder == nil {
+		encoder = ehpg.NewJSONEncoder()
+	}
+
+	return &FailingEncoder{Encoder: encoder}
+}
+
+// FailMarshal makes Marshal fail with ErrEncoderFailure, or succeed again.
+func (e *FailingEncoder) FailMarshal(fail bool) {
+	atomic.StoreInt32(&e.failMarshal, boolInt32(fail))
+}
+
+// FailUnmarshal makes Unmarshal fail with ErrEncoderFailure, or succeed again.
+func (e *FailingEncoder) FailUnmarshal(fail bool) {
+	atomic.StoreInt32(&e.failUnmarshal, boolInt32(fail))
+}
+
+// Marshal implements the Marshal method of the ehpg.Encoder interface.
+func (e *FailingEncoder) Marshal(data eh.EventData) ([]byte, error) {
+	if atomic.LoadInt32(&e.failMarshal) == 1 {
+		return nil, ErrEncoderFailure
+	}
+
+	return e.Encoder.Marshal(data)
+}
+
+// Unmarshal implements the Unmarshal method of the ehpg.Encoder interface.
+func (e *FailingEncoder) Unmarshal(eventType eh.EventType, raw []byte) (eh.EventData, error) {
+	if atomic.LoadInt32(&e.failUnmarshal) == 1 {
+		return nil, ErrEncoderFailure
+	}
+
+	return e.Encoder.Unmarshal(eventType, raw)
+}
+
+func boolInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package redistest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	ehpg "github.com/terraskye/eh-redis"
+	"github.com/terraskye/eh-redis/redistest"
+	"testing"
+	"time"
+)
+
+func TestFailingEncoder(t *testing.T) {
+	encoder := redistest.NewFailingEncoder(nil)
+	store, cleanup := redistest.NewTestEventStore(t, ehpg.WithEncoder(encoder))
+	defer cleanup()
+
+	ctx := context.Background()
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}
+
+	encoder.FailMarshal(true)
+	err := store.Save(ctx, events, 0)
+	if !errors.Is(err, ehpg.ErrCouldNotMarshalEvent) {
+		t.Error("there should be a marshal error:", err)
+	}
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, redistest.ErrEncoderFailure) {
+		t.Error("the encoder failure should be the cause:", err)
+	}
+
+	encoder.FailMarshal(false)
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	encoder.FailUnmarshal(true)
+	if _, err := store.Load(ctx, id); !errors.Is(err, ehpg.ErrCouldNotUnmarshalEvent) {
+		t.Error("there should be an unmarshal error:", err)
+	}
+
+	encoder.FailUnmarshal(false)
+	if loaded, err := store.Load(ctx, id); err != nil || len(loaded) != 1 {
+		t.Error("the event should be loaded:", loaded, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package redistest provides helpers to test code using the Redis event store
+// without an external Redis server.
+package redistest
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	ehpg "github.com/terraskye/eh-redis"
+	"testing"
+)
+
+// NewTestEventStore creates an event store with the options against an
+// in-memory miniredis server, so that tests need no external Redis. The
+// returned cleanup func closes the store and the server, and is also
+// registered with t.Cleanup. Every store has its own server, so tests don't
+// see each other's events.
+func NewTestEventStore(t testing.TB, options ...ehpg.Option) (*ehpg.EventStore, func()) {
+	t.Helper()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("could not start miniredis:", err)
+	}
+
+	db := redis.NewClient(&redis.Options{
+		Addr: server.Addr(),
+	})
+
+	store, err := ehpg.NewEventStore(db, options...)
+	if err != nil {
+		_ = db.Close()
+		server.Close()
+		t.Fatal("could not create event store:", err)
+	}
+
+	var closed bool
+	cleanup := func() {
+		if closed {
+			return
+		}
+		closed = true
+
+		_ = store.Close()
+		server.Close()
+	}
+	t.Cleanup(cleanup)
+
+	return store, cleanup
+}
@@ -0,0 +1,20 @@
+package redistest_test
+
+import (
+	"context"
+	testsuite "github.com/looplab/eventhorizon/eventstore"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/terraskye/eh-redis/redistest"
+	"testing"
+)
+
+func TestNewTestEventStore(t *testing.T) {
+	store, cleanup := redistest.NewTestEventStore(t)
+	defer cleanup()
+
+	t.Log("event store with default namespace")
+	testsuite.AcceptanceTest(t, store, context.Background())
+
+	t.Log("event store with other namespace")
+	testsuite.AcceptanceTest(t, store, namespace.NewContext(context.Background(), "other"))
+}
@@ -0,0 +1,170 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// ErrNoIndexes is when the indexes are rebuilt without WithEventIndex or
+// WithEventTypeIndex.
+var ErrNoIndexes = errors.New("no indexes configured")
+
+// ErrCouldNotReindex is when the indexes could not be rebuilt.
+var ErrCouldNotReindex = errors.New("could not reindex events")
+
+// reindexBatchSize is the number of keys scanned per batch in Reindex.
+const reindexBatchSize = 500
+
+// ReindexProgress is the progress of ReindexFrom after a batch of aggregates.
+type ReindexProgress struct {
+	// Cursor is the scan cursor after the batch, which resumes reindexing
+	// with ReindexFrom. It is 0 after the last batch.
+	Cursor uint64
+	// Aggregates is the number of aggregates reindexed so far.
+	Aggregates int
+	// Events is the number of events reindexed so far.
+	Events int
+}
+
+// Reindex rebuilds the configured indexes of WithEventIndex and
+// WithEventTypeIndex from all stored events of the namespace, for example
+// after enabling an index on existing data. See ReindexFrom.
+func (s *EventStore) Reindex(ctx context.Context) error {
+	return s.ReindexFrom(ctx, 0, nil)
+}
+
+// ReindexFrom rebuilds the configured indexes like Reindex, scanning the
+// aggregates in batches from the scan cursor, which is 0 to start from the
+// beginning. After every batch the progress is passed to the progress func,
+// if any, and the cursor of the progress resumes an interrupted reindex.
+// Index entries are only added, entries of removed events are skipped by the
+// index loaders. It returns ErrNoIndexes without any index configured.
+func (s *EventStore) ReindexFrom(ctx context.Context, cursor uint64, progress func(ReindexProgress)) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "Reindex", namespaceAttribute.String(ns))
+	start := time.Now()
+	p, err := s.reindex(ctx, ns, cursor, progress)
+	span.end(err, eventCountAttribute.Int(p.Events))
+	s.metrics.observe("reindex", ns, start, err)
+
+	return err
+}
+
+// reindex rebuilds the indexes, see ReindexFrom.
+func (s *EventStore) reindex(ctx context.Context, ns string, cursor uint64, progress func(ReindexProgress)) (ReindexProgress, error) {
+	p := ReindexProgress{Cursor: cursor}
+
+	if !s.eventIndex && !s.eventTypeIndex {
+		return p, eh.EventStoreError{
+			Err: ErrNoIndexes,
+		}
+	}
+	if err := s.checkWrite(); err != nil {
+		return p, err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return p, err
+	}
+
+	pattern := s.aggregateKey(ns, "*")
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	for {
+		keys, next, err := s.client(ns).Scan(ctx, p.Cursor, pattern, reindexBatchSize).Result()
+		if err != nil {
+			return p, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotReindex,
+			}
+		}
+
+		aggregates := keys[:0]
+		for _, key := range keys {
+			// Skip keys in the pattern that are not aggregates, like streams.
+			if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, suffix) {
+				aggregates = append(aggregates, key)
+			}
+		}
+
+		events, err := s.reindexAggregates(ctx, ns, aggregates)
+		if err != nil {
+			return p, err
+		}
+
+		p.Cursor = next
+		p.Aggregates += len(aggregates)
+		p.Events += events
+		if progress != nil {
+			progress(p)
+		}
+
+		if p.Cursor == 0 {
+			return p, nil
+		}
+	}
+}
+
+// reindexAggregates adds the events of a batch of aggregate keys to the
+// indexes, returning the number of indexed events.
+func (s *EventStore) reindexAggregates(ctx context.Context, ns string, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// Fetch all aggregates of the batch in one round trip.
+	results := make([]eventsCmd, 0, len(keys))
+	_, err := s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			results = append(results, s.loadAll(ctx, pipe, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotReindex,
+		}
+	}
+
+	// Write the index entries of the batch in one round trip, only the
+	// headers of the events are needed.
+	indexed := 0
+	_, err = s.client(ns).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, result := range results {
+			dbEvents, _ := result.events()
+			for _, raw := range dbEvents {
+				e := AggregateEvent{}
+				if err := e.UnmarshalBinary([]byte(raw)); err != nil {
+					return eh.EventStoreError{
+						BaseErr: err,
+						Err:     ErrCouldNotUnmarshalEvent,
+					}
+				}
+
+				if s.eventIndex {
+					pipe.HSet(ctx, s.eventIndexKey(ns), e.EventID.String(), eventIndexValue(e))
+				}
+				if s.eventTypeIndex {
+					pipe.SAdd(ctx, s.eventTypeIndexKey(ns, e.EventType), eventIndexValue(e))
+				}
+				indexed++
+			}
+		}
+		return nil
+	})
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		return 0, storeErr
+	} else if err != nil {
+		return 0, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotReindex,
+		}
+	}
+
+	return indexed, nil
+}
@@ -0,0 +1,94 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreReindex(t *testing.T) {
+	// Events saved before the indexes were enabled.
+	plain, _ := newEventStore(t)
+	store, _ := newEventStore(t, rediseventstore.WithEventIndex(), rediseventstore.WithEventTypeIndex())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	if err := plain.Reindex(ctx); !errors.Is(err, rediseventstore.ErrNoIndexes) {
+		t.Error("there should be a no indexes error:", err)
+	}
+
+	var eventIDs []uuid.UUID
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		if err := plain.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 1)),
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 2)),
+		}, 0); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+
+		events, err := plain.Load(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		eventIDs = append(eventIDs, events[1].(interface{ EventID() uuid.UUID }).EventID())
+	}
+
+	if _, err := store.LoadByEventID(ctx, eventIDs[0]); !errors.Is(err, rediseventstore.ErrEventNotFound) {
+		t.Fatal("the event should not be indexed yet:", err)
+	}
+
+	var progress []rediseventstore.ReindexProgress
+	if err := store.ReindexFrom(ctx, 0, func(p rediseventstore.ReindexProgress) {
+		progress = append(progress, p)
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(progress) == 0 {
+		t.Fatal("the progress should be reported")
+	}
+	last := progress[len(progress)-1]
+	if last.Cursor != 0 || last.Aggregates != 3 || last.Events != 6 {
+		t.Error("all aggregates should be reindexed:", last)
+	}
+
+	for _, id := range eventIDs {
+		event, err := store.LoadByEventID(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if event.Version() != 2 {
+			t.Error("the indexed event should be loaded:", event)
+		}
+	}
+
+	events, err := store.LoadByEventType(ctx, mocks.EventType, 10)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 6 {
+		t.Error("the events should be indexed by type:", len(events))
+	}
+
+	// Reindexing again adds no duplicates.
+	if err := store.Reindex(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if events, _ := store.LoadByEventType(ctx, mocks.EventType, 10); len(events) != 6 {
+		t.Error("the events should be indexed once:", len(events))
+	}
+}
@@ -0,0 +1,123 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// WithSaveRetries retries a save failing with a transient error up to n times,
+// waiting baseDelay before the first retry and doubling the delay for every
+// following retry, or waiting the delays of WithBackoff. Transient errors are
+// aborted WATCH transactions, MOVED and ASK redirects of Redis Cluster, and
+// connection errors like resets and timeouts. Version conflicts are never
+// retried, and no retry is started after the deadline of the context. A retry
+// after a lost connection can find the events of the first attempt already
+// saved, which is then returned as a version conflict.
+func WithSaveRetries(n int, baseDelay time.Duration) Option {
+	return func(s *EventStore) error {
+		if n < 0 {
+			return fmt.Errorf("%w: save retries must not be negative, got %d", ErrInvalidOption, n)
+		}
+		if baseDelay < 0 {
+			return fmt.Errorf("%w: save retry delay must not be negative, got %s", ErrInvalidOption, baseDelay)
+		}
+
+		s.saveRetries = n
+		s.saveRetryDelay = baseDelay
+
+		return nil
+	}
+}
+
+// retrySave calls save until it succeeds, fails with an error that is not
+// transient, or the retries are used up. It also stops retrying when the
+// context is done or its deadline would pass before the next retry, so that a
+// hot aggregate can't keep a save spinning. A WATCH transaction that is still
+// aborted after the last attempt is returned as a version conflict, as the
+// aggregate was changed concurrently. The returned error tells how many
+// attempts were made.
+func (s *EventStore) retrySave(ctx context.Context, save func() error) error {
+	backoff := s.backoff
+	if backoff == nil {
+		backoff = NewExponentialBackoff(s.saveRetryDelay, 0)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if err == nil {
+			return nil
+		}
+
+		delay := backoff.NextDelay(attempt)
+		if attempt > s.saveRetries || !isTransient(err) || !canRetry(ctx, delay) {
+			return retriesExhausted(err, attempt)
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return retriesExhausted(err, attempt)
+		case <-t.C:
+		}
+	}
+}
+
+// canRetry returns true when the context is not done and its deadline, if
+// any, is after the delay before the next retry.
+func canRetry(ctx context.Context, delay time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	return true
+}
+
+// retriesExhausted returns the error of the last save attempt, adding the
+// number of attempts when the save was retried. An aborted transaction is
+// returned as a version conflict.
+func retriesExhausted(err error, attempts int) error {
+	if errors.Is(err, redis.TxFailedErr) {
+		return eh.EventStoreError{
+			BaseErr: fmt.Errorf("%w after %d attempts", err, attempts),
+			Err:     ErrVersionConflict,
+		}
+	}
+	if isRedirect(err) {
+		return fmt.Errorf("%w after %d attempts: %v", ErrSlotMoved, attempts, err)
+	}
+	if attempts > 1 && isTransient(err) {
+		return fmt.Errorf("%w after %d attempts", err, attempts)
+	}
+	return err
+}
+
+// isTransient returns true for errors of a save that may succeed when retried.
+func isTransient(err error) bool {
+	// Context errors implement net.Error, but are final.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, redis.TxFailedErr) ||
+		isRedirect(err) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
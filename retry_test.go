@@ -0,0 +1,259 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingHook is a redis hook failing the first commands or pipelines
+// containing the command name with err, counting all of them.
+type failingHook struct {
+	name     string
+	err      error
+	failures *int32
+	calls    *int32
+}
+
+func newFailingHook(name string, err error, failures int32) failingHook {
+	return failingHook{name: name, err: err, failures: &failures, calls: new(int32)}
+}
+
+func (h failingHook) fail(cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if cmd.Name() != h.name {
+			continue
+		}
+		atomic.AddInt32(h.calls, 1)
+		if atomic.AddInt32(h.failures, -1) >= 0 {
+			return h.err
+		}
+	}
+	return nil
+}
+
+func (h failingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h failingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.fail([]redis.Cmder{cmd}); err != nil {
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h failingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.fail(cmds); err != nil {
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestEventStoreSaveRetries(t *testing.T) {
+	testCases := map[string]struct {
+		options []rediseventstore.Option
+		command string
+		err     error
+	}{
+		"script": {
+			command: "evalsha",
+			err:     io.EOF,
+		},
+		"watch": {
+			options: []rediseventstore.Option{rediseventstore.WithWatchSave()},
+			command: "exec",
+			err:     redis.TxFailedErr,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			options := append(tc.options, rediseventstore.WithSaveRetries(2, time.Millisecond))
+			store, db := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			hook := newFailingHook(tc.command, tc.err, 2)
+			db.AddHook(hook)
+
+			id := uuid.New()
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if calls := atomic.LoadInt32(hook.calls); calls != 3 {
+				t.Error("the save should be retried twice:", calls)
+			}
+
+			// A version conflict is not retried.
+			atomic.StoreInt32(hook.calls, 0)
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+			}, 0); !errors.Is(err, rediseventstore.ErrCouldNotSaveAggregate) {
+				t.Error("there should be a version conflict:", err)
+			}
+			if calls := atomic.LoadInt32(hook.calls); calls > 1 {
+				t.Error("the version conflict should not be retried:", calls)
+			}
+
+			// The error is returned when the retries are used up.
+			atomic.StoreInt32(hook.failures, 3)
+			err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2)),
+			}, 1)
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) {
+				t.Fatal("there should be an event store error:", err)
+			}
+			if tc.err == redis.TxFailedErr {
+				if !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+					t.Error("an aborted transaction should be a version conflict:", err)
+				}
+			} else if !errors.Is(storeErr.BaseErr, tc.err) {
+				t.Error("the transient error should be returned:", err)
+			}
+		})
+	}
+}
+
+func TestEventStoreSaveRetriesContention(t *testing.T) {
+	store, db := newEventStore(t,
+		rediseventstore.WithWatchSave(),
+		rediseventstore.WithSaveRetries(1000, time.Millisecond))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Another writer touches the watched compacted count of the aggregate
+	// before every transaction, without changing its version.
+	id := uuid.New()
+	hook := contentionHook{db: db, key: "compacted:ns:{" + id.String() + "}", calls: new(int32)}
+	db.AddHook(hook)
+
+	saveCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := store.Save(saveCtx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0)
+	if time.Since(start) > time.Second {
+		t.Error("the retries should stop at the deadline:", time.Since(start))
+	}
+
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Fatal("there should be a version conflict:", err)
+	}
+	calls := atomic.LoadInt32(hook.calls)
+	if calls < 2 || calls > 1000 {
+		t.Error("the save should be retried until the deadline:", calls)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("after %d attempts", calls)) {
+		t.Error("the error should tell the number of attempts:", err)
+	}
+}
+
+// contentionHook is a redis hook writing to a key before every transaction,
+// which aborts transactions watching the key, counting the transactions.
+type contentionHook struct {
+	db    redis.UniversalClient
+	key   string
+	calls *int32
+}
+
+func (h contentionHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h contentionHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h contentionHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() == "exec" {
+				atomic.AddInt32(h.calls, 1)
+				if err := h.db.Set(context.Background(), h.key, "0", 0).Err(); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestEventStoreSaveRedirect(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithSaveRetries(1, time.Millisecond))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// A slot of the aggregate is migrated while saving.
+	hook := newFailingHook("evalsha", errors.New("MOVED 1234 127.0.0.1:7001"), 1)
+	db.AddHook(hook)
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if calls := atomic.LoadInt32(hook.calls); calls != 2 {
+		t.Error("the save should be retried once:", calls)
+	}
+
+	// A redirect after the last retry is returned as a moved slot.
+	atomic.StoreInt32(hook.failures, 2)
+	err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrSlotMoved) {
+		t.Fatal("there should be a moved slot error:", err)
+	}
+	if !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Error("the error should tell the number of attempts:", err)
+	}
+}
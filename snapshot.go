@@ -0,0 +1,242 @@
+package ehpg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// ErrCouldNotMarshalSnapshot is when a snapshot could not be marshaled.
+var ErrCouldNotMarshalSnapshot = errors.New("could not marshal snapshot")
+
+// ErrCouldNotUnmarshalSnapshot is when a snapshot could not be unmarshalled into a concrete type.
+var ErrCouldNotUnmarshalSnapshot = errors.New("could not unmarshal snapshot")
+
+// ErrCouldNotSaveSnapshot is when a snapshot could not be saved.
+var ErrCouldNotSaveSnapshot = errors.New("could not save snapshot")
+
+// ErrCouldNotLoadSnapshot is when a snapshot could not be loaded.
+var ErrCouldNotLoadSnapshot = errors.New("could not load snapshot")
+
+// Snapshot is the state of an aggregate at a specific version. It mirrors the
+// snapshot type of newer eventhorizon releases.
+type Snapshot struct {
+	Version       int
+	AggregateType eh.AggregateType
+	Timestamp     time.Time
+	State         interface{}
+}
+
+// SnapshotRecord is the stored representation of a Snapshot.
+type SnapshotRecord struct {
+	Version       int
+	AggregateType eh.AggregateType
+	Timestamp     time.Time
+	RawState      json.RawMessage
+	// BinaryState holds compressed or encrypted state and state of snapshot
+	// encoders not producing JSON, prefixed with the Compression codec byte.
+	BinaryState []byte `json:",omitempty"`
+	// StateEncoding is the name of the SnapshotEncoder of the binary state,
+	// empty for JSON.
+	StateEncoding string `json:",omitempty"`
+	// EncryptionKeyID is the key the binary state is encrypted with.
+	EncryptionKeyID string `json:",omitempty"`
+}
+
+var snapshotDataFactories = make(map[eh.AggregateType]func() interface{})
+var snapshotDataFactoriesMu sync.RWMutex
+
+// RegisterSnapshotData registers a factory for the snapshot state of an
+// aggregate type. Without a factory the state is loaded as a generic value,
+// like maps for JSON objects.
+func RegisterSnapshotData(aggregateType eh.AggregateType, factory func() interface{}) {
+	snapshotDataFactoriesMu.Lock()
+	defer snapshotDataFactoriesMu.Unlock()
+
+	snapshotDataFactories[aggregateType] = factory
+}
+
+// createSnapshotData creates the snapshot state of an aggregate type, or nil
+// when no factory has been registered.
+func createSnapshotData(aggregateType eh.AggregateType) interface{} {
+	snapshotDataFactoriesMu.RLock()
+	defer snapshotDataFactoriesMu.RUnlock()
+
+	if factory, ok := snapshotDataFactories[aggregateType]; ok {
+		return factory()
+	}
+	return nil
+}
+
+// LoadSnapshot loads the latest snapshot for an aggregate. It returns nil
+// without an error when no snapshot exists.
+func (s *EventStore) LoadSnapshot(ctx context.Context, id uuid.UUID) (*Snapshot, error) {
+	ctx, span := s.startSpan(ctx, "LoadSnapshot",
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+	snapshot, err := withTimeout(ctx, s, ErrCouldNotLoadSnapshot, func(ctx context.Context) (*Snapshot, error) {
+		return s.loadSnapshot(ctx, id)
+	})
+	span.end(err)
+	s.metrics.observe("load_snapshot", namespaceFromContext(ctx), start, err)
+
+	return snapshot, err
+}
+
+// loadSnapshot loads the latest snapshot, see LoadSnapshot.
+func (s *EventStore) loadSnapshot(ctx context.Context, id uuid.UUID) (*Snapshot, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	raw, err := s.client(ns).Get(ctx, s.snapshotKey(ns, id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadSnapshot,
+		}
+	}
+
+	return s.decodeSnapshot(raw)
+}
+
+// decodeSnapshot decodes a stored snapshot record.
+func (s *EventStore) decodeSnapshot(raw []byte) (*Snapshot, error) {
+	record := SnapshotRecord{}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalSnapshot,
+		}
+	}
+
+	snapshot := &Snapshot{
+		Version:       record.Version,
+		AggregateType: record.AggregateType,
+		Timestamp:     record.Timestamp,
+	}
+
+	if state := createSnapshotData(record.AggregateType); state != nil {
+		if err := s.decodeSnapshotState(record, state); err != nil {
+			return nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalSnapshot,
+			}
+		}
+		snapshot.State = state
+	} else if err := s.decodeSnapshotState(record, &snapshot.State); err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotUnmarshalSnapshot,
+		}
+	}
+
+	return snapshot, nil
+}
+
+// SaveSnapshot saves a snapshot for an aggregate, replacing any previous one
+// of the same or an earlier version. A late snapshot of an earlier version
+// doesn't replace the latest snapshot, but is retained with
+// WithSnapshotRetention. A snapshot without a timestamp is stamped with the clock of the store, see
+// WithClock.
+func (s *EventStore) SaveSnapshot(ctx context.Context, id uuid.UUID, snapshot Snapshot) error {
+	ctx, span := s.startSpan(ctx, "SaveSnapshot",
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+	_, err := withTimeout(ctx, s, ErrCouldNotSaveSnapshot, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.saveSnapshot(ctx, id, snapshot)
+	})
+	span.end(err)
+	s.metrics.observe("save_snapshot", namespaceFromContext(ctx), start, err)
+
+	return err
+}
+
+// saveSnapshot saves a snapshot, see SaveSnapshot.
+func (s *EventStore) saveSnapshot(ctx context.Context, id uuid.UUID, snapshot Snapshot) error {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+
+	if snapshot.Timestamp.IsZero() {
+		snapshot.Timestamp = s.clock()
+	}
+
+	record := SnapshotRecord{
+		Version:       snapshot.Version,
+		AggregateType: snapshot.AggregateType,
+		Timestamp:     snapshot.Timestamp,
+	}
+	if err := s.encodeSnapshotState(&record, snapshot.State); err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotMarshalSnapshot,
+		}
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotMarshalSnapshot,
+		}
+	}
+
+	// The latest snapshot and the retained snapshots are written in one
+	// transaction.
+	_, err = s.client(ns).TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setLatestSnapshotScript.Eval(ctx, pipe, []string{s.snapshotKey(ns, id)},
+			raw, snapshot.Version, s.eventTTL.Milliseconds())
+		if s.retainSnapshots > 1 {
+			s.retainSnapshot(ctx, pipe, s.snapshotsKey(ns, id), snapshot.Version, raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotSaveSnapshot,
+		}
+	}
+
+	return nil
+}
+
+// setLatestSnapshotScript sets the latest snapshot KEYS[1] to ARGV[1] unless
+// the stored snapshot has a version above ARGV[2], so that a late snapshot of
+// an earlier version is only retained. The expiry slides forward when ARGV[3]
+// is a positive number of milliseconds.
+var setLatestSnapshotScript = redis.NewScript(`
+local stored = redis.call("GET", KEYS[1])
+if stored then
+	local ok, snapshot = pcall(cjson.decode, stored)
+	if ok and type(snapshot) == "table" and tonumber(snapshot.Version) and tonumber(snapshot.Version) > tonumber(ARGV[2]) then
+		if tonumber(ARGV[3]) > 0 then
+			redis.call("PEXPIRE", KEYS[1], ARGV[3])
+		end
+		return 0
+	end
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`)
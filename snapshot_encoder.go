@@ -0,0 +1,154 @@
+package ehpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// SnapshotEncoder marshals and unmarshals the state of snapshots, like
+// Encoder does for event data.
+type SnapshotEncoder interface {
+	// Marshal marshals the snapshot state.
+	Marshal(state interface{}) ([]byte, error)
+	// Unmarshal unmarshals the raw state into state, which is a pointer to
+	// the value of the factory registered with RegisterSnapshotData, or to an
+	// empty interface for aggregate types without a factory.
+	Unmarshal(raw []byte, state interface{}) error
+	// String returns the name of the encoding. Uncompressed and unencrypted
+	// state of the "json" encoding is embedded as JSON in the stored
+	// snapshot, any other state is stored as binary data with the name.
+	String() string
+}
+
+// WithSnapshotEncoder uses the encoder to marshal and unmarshal snapshot
+// state, instead of the default JSON encoder. Like event data, the state is
+// compressed with WithCompression and encrypted with WithEncryption. State
+// stored as JSON, like the snapshots saved before changing the encoder, is
+// still unmarshaled as JSON. Binary state can only be unmarshaled by an
+// encoder of the same name.
+func WithSnapshotEncoder(encoder SnapshotEncoder) Option {
+	return func(s *EventStore) error {
+		if encoder == nil {
+			return fmt.Errorf("%w: snapshot encoder must not be nil", ErrInvalidOption)
+		}
+
+		s.snapshotEncoder = encoder
+
+		return nil
+	}
+}
+
+// NewJSONSnapshotEncoder returns the default SnapshotEncoder, marshaling
+// snapshot state as JSON.
+func NewJSONSnapshotEncoder() SnapshotEncoder {
+	return jsonSnapshotEncoder{}
+}
+
+type jsonSnapshotEncoder struct{}
+
+func (jsonSnapshotEncoder) Marshal(state interface{}) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+func (jsonSnapshotEncoder) Unmarshal(raw []byte, state interface{}) error {
+	return json.Unmarshal(raw, state)
+}
+
+func (jsonSnapshotEncoder) String() string {
+	return "json"
+}
+
+// NewMsgpackSnapshotEncoder returns a SnapshotEncoder marshaling snapshot
+// state as msgpack, which is more compact than JSON. Struct fields are named
+// by their json tags, like NewMsgpackEncoder does.
+func NewMsgpackSnapshotEncoder() SnapshotEncoder {
+	return msgpackSnapshotEncoder{}
+}
+
+type msgpackSnapshotEncoder struct{}
+
+func (msgpackSnapshotEncoder) Marshal(state interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSnapshotEncoder) Unmarshal(raw []byte, state interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(raw))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(state)
+}
+
+func (msgpackSnapshotEncoder) String() string {
+	return "msgpack"
+}
+
+// encodeSnapshotState sets the state of a stored snapshot. Uncompressed JSON
+// state is embedded as is, compressed or encrypted state and other encodings
+// are stored as binary.
+func (s *EventStore) encodeSnapshotState(record *SnapshotRecord, state interface{}) error {
+	raw, err := s.snapshotEncoder.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if s.snapshotEncoder.String() == "json" && s.compression == NoCompression && s.cipher == nil {
+		record.RawState = raw
+		return nil
+	}
+
+	if raw, err = s.compression.compress(raw); err != nil {
+		return err
+	}
+	// Encrypt the compressed state, including the codec byte.
+	if s.cipher != nil {
+		if raw, err = s.cipher.Encrypt(raw); err != nil {
+			return err
+		}
+		record.EncryptionKeyID = s.cipher.KeyID()
+	}
+	if s.snapshotEncoder.String() != "json" {
+		record.StateEncoding = s.snapshotEncoder.String()
+	}
+	record.BinaryState = raw
+
+	return nil
+}
+
+// decodeSnapshotState unmarshals the state of a stored snapshot into state.
+func (s *EventStore) decodeSnapshotState(record SnapshotRecord, state interface{}) error {
+	if record.BinaryState == nil {
+		return json.Unmarshal(record.RawState, state)
+	}
+
+	raw := record.BinaryState
+	if record.EncryptionKeyID != "" {
+		cipher, ok := s.ciphers[record.EncryptionKeyID]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownEncryptionKey, record.EncryptionKeyID)
+		}
+		var err error
+		if raw, err = cipher.Decrypt(raw); err != nil {
+			return err
+		}
+	}
+	raw, err := decompress(raw)
+	if err != nil {
+		return err
+	}
+
+	if record.StateEncoding == "" {
+		return json.Unmarshal(raw, state)
+	} else if record.StateEncoding != s.snapshotEncoder.String() {
+		return fmt.Errorf("snapshot state is encoded as %s, the snapshot encoder is %s",
+			record.StateEncoding, s.snapshotEncoder)
+	}
+	return s.snapshotEncoder.Unmarshal(raw, state)
+}
@@ -0,0 +1,104 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+const snapshotEncoderAggregateType = eh.AggregateType("SnapshotEncoderAggregate")
+
+type snapshotEncoderState struct {
+	Content string   `json:"content"`
+	Count   int      `json:"count"`
+	Tags    []string `json:"tags"`
+}
+
+func TestEventStoreSnapshotEncoder(t *testing.T) {
+	rediseventstore.RegisterSnapshotData(snapshotEncoderAggregateType, func() interface{} {
+		return &snapshotEncoderState{}
+	})
+
+	testCases := map[string][]rediseventstore.Option{
+		"json": nil,
+		"json compressed": {
+			rediseventstore.WithCompression(rediseventstore.Gzip),
+		},
+		"msgpack": {
+			rediseventstore.WithEncoder(rediseventstore.NewMsgpackEncoder()),
+			rediseventstore.WithSnapshotEncoder(rediseventstore.NewMsgpackSnapshotEncoder()),
+		},
+		"msgpack compressed encrypted": {
+			rediseventstore.WithSnapshotEncoder(rediseventstore.NewMsgpackSnapshotEncoder()),
+			rediseventstore.WithCompression(rediseventstore.Gzip),
+			rediseventstore.WithEncryption(xorCipher{id: "key", key: 0x5a}),
+		},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			state := &snapshotEncoderState{Content: "state", Count: 3, Tags: []string{"a", "b"}}
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version:       3,
+				AggregateType: snapshotEncoderAggregateType,
+				Timestamp:     time.Now(),
+				State:         state,
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			snapshot, err := store.LoadSnapshot(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			loaded, ok := snapshot.State.(*snapshotEncoderState)
+			if !ok || loaded.Content != "state" || loaded.Count != 3 || len(loaded.Tags) != 2 {
+				t.Error("the state should be loaded:", snapshot.State)
+			}
+
+			// Generic state is loaded without a factory.
+			if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+				Version: 4,
+				State:   map[string]interface{}{"content": "generic"},
+			}); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			snapshot, err = store.LoadSnapshot(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if generic, ok := snapshot.State.(map[string]interface{}); !ok || generic["content"] != "generic" {
+				t.Error("the generic state should be loaded:", snapshot.State)
+			}
+
+			// Binary state can't be read with another encoder.
+			if !strings.HasPrefix(name, "msgpack") {
+				return
+			}
+			other, err := rediseventstore.NewEventStore(db)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if _, err := other.LoadSnapshot(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUnmarshalSnapshot) {
+				t.Error("there should be an unmarshal error:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// WithSnapshotRetention keeps the n snapshots with the highest versions of
+// every aggregate, instead of only the latest one, which is the default of 1.
+// SaveSnapshot deletes the older snapshots in the same transaction, and
+// LoadSnapshots loads the retained snapshots. The retained snapshots are
+// stored in a sorted set by version, next to the latest snapshot.
+func WithSnapshotRetention(n int) Option {
+	return func(s *EventStore) error {
+		if n < 1 {
+			return fmt.Errorf("%w: snapshot retention must be at least 1, got %d", ErrInvalidOption, n)
+		}
+
+		s.retainSnapshots = n
+
+		return nil
+	}
+}
+
+// LoadSnapshots loads the retained snapshots of an aggregate, see
+// WithSnapshotRetention, ordered by version. Without retention it returns the
+// latest snapshot, and no snapshots when none exist.
+func (s *EventStore) LoadSnapshots(ctx context.Context, id uuid.UUID) ([]*Snapshot, error) {
+	ctx, span := s.startSpan(ctx, "LoadSnapshots",
+		namespaceAttribute.String(namespaceFromContext(ctx)),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+	snapshots, err := withTimeout(ctx, s, ErrCouldNotLoadSnapshot, func(ctx context.Context) ([]*Snapshot, error) {
+		return s.loadSnapshots(ctx, id)
+	})
+	span.end(err)
+	s.metrics.observe("load_snapshots", namespaceFromContext(ctx), start, err)
+
+	return snapshots, err
+}
+
+// loadSnapshots loads the retained snapshots, see LoadSnapshots.
+func (s *EventStore) loadSnapshots(ctx context.Context, id uuid.UUID) ([]*Snapshot, error) {
+	ns := namespaceFromContext(ctx)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	raws, err := s.client(ns).ZRange(ctx, s.snapshotsKey(ns, id), 0, -1).Result()
+	if err != nil {
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadSnapshot,
+		}
+	}
+
+	// Snapshots saved without retention are only stored as the latest.
+	if len(raws) == 0 {
+		snapshot, err := s.loadSnapshot(ctx, id)
+		if err != nil || snapshot == nil {
+			return nil, err
+		}
+		return []*Snapshot{snapshot}, nil
+	}
+
+	snapshots := make([]*Snapshot, 0, len(raws))
+	for _, raw := range raws {
+		snapshot, err := s.decodeSnapshot([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// retainSnapshot queues adding a snapshot to the retained snapshots,
+// replacing a snapshot of the same version, and removing the snapshots
+// exceeding the retention.
+func (s *EventStore) retainSnapshot(ctx context.Context, pipe redis.Pipeliner, key string, version int, raw []byte) {
+	score := strconv.Itoa(version)
+	pipe.ZRemRangeByScore(ctx, key, score, score)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(version), Member: raw})
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-s.retainSnapshots-1))
+	if s.eventTTL > 0 {
+		pipe.PExpire(ctx, key, s.eventTTL)
+	}
+}
+
+// snapshotsKey returns the key of the sorted set holding the retained
+// snapshots of an aggregate.
+func (s *EventStore) snapshotsKey(ns string, id interface{}) string {
+	return s.keyPrefix + "snapshots:" + s.keyBuilder(ns, fmt.Sprint(id))
+}
@@ -0,0 +1,108 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreSnapshotRetention(t *testing.T) {
+	store, _ := newEventStore(t, rediseventstore.WithSnapshotRetention(2))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	for version := 1; version <= 3; version++ {
+		if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+			Version:       version,
+			AggregateType: mocks.AggregateType,
+			Timestamp:     time.Now(),
+			State:         map[string]interface{}{"version": float64(version)},
+		}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	snapshots, err := store.LoadSnapshots(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Version != 2 || snapshots[1].Version != 3 {
+		t.Error("the two latest snapshots should be retained:", snapshots)
+	}
+
+	latest, err := store.LoadSnapshot(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if latest == nil || latest.Version != 3 {
+		t.Error("the latest snapshot should be loaded:", latest)
+	}
+
+	// Saving a version again replaces the retained snapshot.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       3,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+		State:         map[string]interface{}{"version": "replaced"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	snapshots, err = store.LoadSnapshots(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(snapshots) != 2 || snapshots[1].State.(map[string]interface{})["version"] != "replaced" {
+		t.Error("the snapshot should be replaced:", snapshots)
+	}
+}
+
+func TestEventStoreLoadSnapshotsWithoutRetention(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	snapshots, err := store.LoadSnapshots(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(snapshots) != 0 {
+		t.Error("there should be no snapshots:", snapshots)
+	}
+
+	for version := 1; version <= 2; version++ {
+		if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+			Version:       version,
+			AggregateType: mocks.AggregateType,
+			Timestamp:     time.Now(),
+			State:         map[string]interface{}{"version": float64(version)},
+		}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	snapshots, err = store.LoadSnapshots(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Version != 2 {
+		t.Error("only the latest snapshot should be kept:", snapshots)
+	}
+}
@@ -0,0 +1,396 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+)
+
+// StorageMode is the Redis data type the events of an aggregate are stored in.
+type StorageMode byte
+
+const (
+	// HashStorage stores the events of an aggregate in a hash, with the
+	// version as field. Loading fetches the whole hash and sorts the events.
+	HashStorage StorageMode = iota
+	// SortedSetStorage stores the events of an aggregate in a sorted set,
+	// with the version as score. Events are loaded in version order, and
+	// LoadFrom only fetches the requested versions. Replacing or renaming an
+	// event removes and adds the member, as members can't be updated in
+	// place.
+	SortedSetStorage
+	// KeyPerEventStorage stores every event of an aggregate in its own key,
+	// the aggregate key with the version appended, next to a counter of the
+	// stored events under the aggregate key. Loading fetches the event keys
+	// in a Lua script, which avoids large values for aggregates with long
+	// histories at the cost of a key per event. The scripts build the event
+	// keys from the aggregate key, so on Redis Cluster the keys must have the
+	// id as hash tag, see WithKeyBuilder.
+	KeyPerEventStorage
+)
+
+// String returns the name of the storage mode.
+func (m StorageMode) String() string {
+	switch m {
+	case HashStorage:
+		return "hash"
+	case SortedSetStorage:
+		return "sorted set"
+	case KeyPerEventStorage:
+		return "key per event"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(m))
+}
+
+// WithStorageMode stores the events of aggregates in the Redis data type of
+// the storage mode, instead of the default HashStorage. The storage modes
+// can't read each other's aggregates, so all stores of a keyspace must use the
+// same mode.
+//
+// Sorted sets load ranges of versions, like LoadFrom and LoadStream, without
+// fetching the whole aggregate, and avoid sorting on load. Hashes fetch a
+// single version in constant time and use less memory, as a sorted set also
+// keeps a skip list of its members. A key per event keeps every value small,
+// but can't be combined with WithEventTTL, as sliding the expiry of all event
+// keys on every save would not scale with the number of events.
+func WithStorageMode(mode StorageMode) Option {
+	return func(s *EventStore) error {
+		if mode != HashStorage && mode != SortedSetStorage && mode != KeyPerEventStorage {
+			return fmt.Errorf("%w: unknown storage mode %s", ErrInvalidOption, mode)
+		}
+
+		s.storageMode = mode
+
+		return nil
+	}
+}
+
+// eventsCmd is a queued command fetching stored events.
+type eventsCmd interface {
+	// events returns the fetched events by version field.
+	events() (map[string]string, error)
+}
+
+// hashAllCmd fetches all events of a hash.
+type hashAllCmd struct {
+	cmd *redis.MapStringStringCmd
+}
+
+func (c hashAllCmd) events() (map[string]string, error) {
+	events, err := c.cmd.Result()
+	delete(events, versionField)
+	return events, err
+}
+
+// hashFieldsCmd fetches the events of fields of a hash.
+type hashFieldsCmd struct {
+	fields []string
+	cmd    *redis.SliceCmd
+}
+
+func (c hashFieldsCmd) events() (map[string]string, error) {
+	values, err := c.cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[string]string, len(values))
+	for i, value := range values {
+		if dbEvent, ok := value.(string); ok {
+			events[c.fields[i]] = dbEvent
+		}
+	}
+	return events, nil
+}
+
+// sortedSetCmd fetches events of a sorted set with their scores.
+type sortedSetCmd struct {
+	cmd *redis.ZSliceCmd
+}
+
+func (c sortedSetCmd) events() (map[string]string, error) {
+	members, err := c.cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[string]string, len(members))
+	for _, member := range members {
+		if dbEvent, ok := member.Member.(string); ok {
+			events[strconv.FormatInt(int64(member.Score), 10)] = dbEvent
+		}
+	}
+	return events, nil
+}
+
+// keyEventsCmd fetches the events of event keys as version/event pairs.
+type keyEventsCmd struct {
+	cmd *redis.Cmd
+}
+
+func (c keyEventsCmd) events() (map[string]string, error) {
+	values, err := c.cmd.StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		events[values[i]] = values[i+1]
+	}
+	return events, nil
+}
+
+// loadAll queues fetching all events of the aggregate key, with the event data
+// of deduplicated events resolved.
+func (s *EventStore) loadAll(ctx context.Context, c commands, key string) eventsCmd {
+	return s.resolvePayloads(ctx, key, s.loadStoredAll(ctx, c, key))
+}
+
+// loadFrom queues fetching the events with a version of at least version,
+// with the event data of deduplicated events resolved.
+func (s *EventStore) loadFrom(ctx context.Context, c commands, key string, version int) eventsCmd {
+	return s.resolvePayloads(ctx, key, s.loadStoredFrom(ctx, c, key, version))
+}
+
+// loadRange queues fetching the events with versions from from to to, with the
+// event data of deduplicated events resolved.
+func (s *EventStore) loadRange(ctx context.Context, c commands, key string, from, to int) eventsCmd {
+	return s.resolvePayloads(ctx, key, s.loadStoredRange(ctx, c, key, from, to))
+}
+
+// loadStoredAll queues fetching all events of the aggregate key as stored.
+func (s *EventStore) loadStoredAll(ctx context.Context, c commands, key string) eventsCmd {
+	if s.storageMode == SortedSetStorage {
+		return sortedSetCmd{c.ZRangeWithScores(ctx, key, 0, -1)}
+	}
+	if s.storageMode == KeyPerEventStorage {
+		return s.loadEventKeys(ctx, c, key, 1, 0)
+	}
+	return hashAllCmd{c.HGetAll(ctx, key)}
+}
+
+// loadStoredFrom queues fetching the events with a version of at least
+// version as stored. Hashes are fetched whole, the events before the version
+// are skipped by loadEvents.
+func (s *EventStore) loadStoredFrom(ctx context.Context, c commands, key string, version int) eventsCmd {
+	if s.storageMode == SortedSetStorage {
+		return sortedSetCmd{c.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min: strconv.Itoa(version),
+			Max: "+inf",
+		})}
+	}
+	if s.storageMode == KeyPerEventStorage {
+		return s.loadEventKeys(ctx, c, key, version, 0)
+	}
+	return hashAllCmd{c.HGetAll(ctx, key)}
+}
+
+// loadStoredRange queues fetching the events with versions from from to to as
+// stored.
+func (s *EventStore) loadStoredRange(ctx context.Context, c commands, key string, from, to int) eventsCmd {
+	if s.storageMode == SortedSetStorage {
+		return sortedSetCmd{c.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min: strconv.Itoa(from),
+			Max: strconv.Itoa(to),
+		})}
+	}
+
+	fields := make([]string, 0, to-from+1)
+	for v := from; v <= to; v++ {
+		fields = append(fields, strconv.Itoa(v))
+	}
+	if s.storageMode == KeyPerEventStorage {
+		keys := make([]string, 0, len(fields))
+		for v := from; v <= to; v++ {
+			keys = append(keys, eventKey(key, v))
+		}
+		return hashFieldsCmd{fields: fields, cmd: c.MGet(ctx, keys...)}
+	}
+	return hashFieldsCmd{fields: fields, cmd: c.HMGet(ctx, key, fields...)}
+}
+
+// loadEventKeys queues fetching the event keys of KeyPerEventStorage with
+// versions from from to to, or to the latest version when to is 0.
+func (s *EventStore) loadEventKeys(ctx context.Context, c commands, key string, from, to int) eventsCmd {
+	// The compacted key is the aggregate key after the compacted prefix, see
+	// compactedKey.
+	keys := []string{key, s.keyPrefix + "compacted:" + strings.TrimPrefix(key, s.keyPrefix)}
+	return keyEventsCmd{loadEventKeysScript.Eval(ctx, c, keys, from, to)}
+}
+
+// loadEventKeysScript returns the versions and events of the event keys of the
+// aggregate KEYS[1] with versions from ARGV[1] to ARGV[2], or to the latest
+// version when ARGV[2] is 0. The stored events follow the compacted events
+// counted in KEYS[2], and KEYS[1] counts the stored events. The event keys
+// have the hash tag of KEYS[1], so they are in its slot on Redis Cluster.
+var loadEventKeysScript = redis.NewScript(`
+local first = (tonumber(redis.call("GET", KEYS[2])) or 0) + 1
+local last = first - 1 + (tonumber(redis.call("GET", KEYS[1])) or 0)
+local from = math.max(tonumber(ARGV[1]), first)
+local to = tonumber(ARGV[2])
+if to == 0 or to > last then
+	to = last
+end
+local events = {}
+for v = from, to do
+	local event = redis.call("GET", KEYS[1] .. ":" .. v)
+	if event then
+		events[#events + 1] = tostring(v)
+		events[#events + 1] = event
+	end
+end
+return events
+`)
+
+// eventKey returns the key of an event of KeyPerEventStorage.
+func eventKey(key string, version int) string {
+	return key + ":" + strconv.Itoa(version)
+}
+
+// eventCountCmd reads the counter of the stored events of KeyPerEventStorage.
+type eventCountCmd struct {
+	cmd *redis.StringCmd
+}
+
+func (c eventCountCmd) Result() (int64, error) {
+	n, err := c.cmd.Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (c eventCountCmd) Val() int64 {
+	n, _ := c.Result()
+	return n
+}
+
+// countCmd is a queued command counting stored events.
+type countCmd interface {
+	Result() (int64, error)
+	Val() int64
+}
+
+// versionFieldCountCmd counts the fields of a hash without its version field.
+type versionFieldCountCmd struct {
+	len     *redis.IntCmd
+	version *redis.BoolCmd
+}
+
+func (c versionFieldCountCmd) Result() (int64, error) {
+	n, err := c.len.Result()
+	if err != nil {
+		return 0, err
+	}
+	if c.version.Val() {
+		n--
+	}
+	return n, c.version.Err()
+}
+
+func (c versionFieldCountCmd) Val() int64 {
+	n, _ := c.Result()
+	return n
+}
+
+// countEvents queues counting the events of the aggregate key.
+func (s *EventStore) countEvents(ctx context.Context, c commands, key string) countCmd {
+	if s.storageMode == SortedSetStorage {
+		return c.ZCard(ctx, key)
+	}
+	if s.storageMode == KeyPerEventStorage {
+		return eventCountCmd{c.Get(ctx, key)}
+	}
+	if s.versionField {
+		return versionFieldCountCmd{
+			len:     c.HLen(ctx, key),
+			version: c.HExists(ctx, key, versionField),
+		}
+	}
+	return c.HLen(ctx, key)
+}
+
+// addEvent queues adding an event, returning a function reporting whether it
+// was added once the command is executed. Hash fields are only added when the
+// version doesn't exist, sorted sets rely on the version check of the save.
+// Event keys are only set when they don't exist, counting the added events.
+func (s *EventStore) addEvent(ctx context.Context, c commands, key string, e versionedEvent) func() bool {
+	if s.storageMode == SortedSetStorage {
+		cmd := c.ZAddNX(ctx, key, redis.Z{Score: float64(e.event.Version), Member: e.event})
+		return func() bool { return cmd.Val() == 1 }
+	}
+	if s.storageMode == KeyPerEventStorage {
+		cmd := addEventKeyScript.Eval(ctx, c, []string{eventKey(key, e.event.Version), key}, e.event)
+		return func() bool {
+			n, _ := cmd.Int()
+			return n > 0
+		}
+	}
+	return c.HSetNX(ctx, key, e.field, e.event).Val
+}
+
+// addEventKeyScript sets the event key KEYS[1] to ARGV[1] unless it exists,
+// and only then increments the counter of the stored events in KEYS[2]. It
+// returns the incremented counter, or 0 when the event key exists.
+var addEventKeyScript = redis.NewScript(`
+if not redis.call("SET", KEYS[1], ARGV[1], "NX") then
+	return 0
+end
+return redis.call("INCR", KEYS[2])
+`)
+
+// setEvent queues replacing the stored event with the same version.
+func (s *EventStore) setEvent(ctx context.Context, c commands, key string, e AggregateEvent) {
+	e.legacyNames = s.legacyNames
+	version := strconv.Itoa(e.Version)
+	if s.storageMode == SortedSetStorage {
+		c.ZRemRangeByScore(ctx, key, version, version)
+		c.ZAdd(ctx, key, redis.Z{Score: float64(e.Version), Member: e})
+		return
+	}
+	if s.storageMode == KeyPerEventStorage {
+		c.Set(ctx, eventKey(key, e.Version), e, 0)
+		return
+	}
+	c.HSet(ctx, key, version, e)
+}
+
+// eventsScript returns the save script of the storage mode.
+func (s *EventStore) eventsScript() *redis.Script {
+	if s.storageMode == SortedSetStorage {
+		return saveSortedSetEventsScript
+	}
+	if s.storageMode == KeyPerEventStorage {
+		return saveKeyPerEventScript
+	}
+	if s.versionField {
+		return saveVersionFieldEventsScript
+	}
+	return saveEventsScript
+}
+
+// removeEvents queues removing the events with versions from from to to.
+func (s *EventStore) removeEvents(ctx context.Context, c commands, key string, from, to int) *redis.IntCmd {
+	if s.storageMode == SortedSetStorage {
+		return c.ZRemRangeByScore(ctx, key, strconv.Itoa(from), strconv.Itoa(to))
+	}
+	if s.storageMode == KeyPerEventStorage {
+		keys := make([]string, 0, to-from+1)
+		for v := from; v <= to; v++ {
+			keys = append(keys, eventKey(key, v))
+		}
+		// The removed versions are stored, as the versions are contiguous.
+		cmd := c.Del(ctx, keys...)
+		c.DecrBy(ctx, key, int64(len(keys)))
+		return cmd
+	}
+
+	fields := make([]string, 0, to-from+1)
+	for v := from; v <= to; v++ {
+		fields = append(fields, strconv.Itoa(v))
+	}
+	return c.HDel(ctx, key, fields...)
+}
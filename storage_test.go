@@ -0,0 +1,290 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	testsuite "github.com/looplab/eventhorizon/eventstore"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreSortedSetStorage(t *testing.T) {
+	testStorageMode(t, rediseventstore.SortedSetStorage, "zset")
+}
+
+func TestEventStoreKeyPerEventStorage(t *testing.T) {
+	testStorageMode(t, rediseventstore.KeyPerEventStorage, "string")
+
+	store, db := newEventStore(t, rediseventstore.WithStorageMode(rediseventstore.KeyPerEventStorage))
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	for version := 1; version <= 5; version++ {
+		event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, version))
+		if err := store.Save(ctx, []eh.Event{event}, version-1); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	key := "ns:{" + id.String() + "}"
+	if n, err := db.Get(ctx, key).Int(); err != nil || n != 5 {
+		t.Error("the aggregate key should count the events:", n, err)
+	}
+	if n, err := db.Exists(ctx, key+":1", key+":5").Result(); err != nil || n != 2 {
+		t.Error("every event should be stored in its own key:", n, err)
+	}
+
+	// Compacting removes the event keys.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       5,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := store.Compact(ctx, id, 4); err != nil || n != 3 {
+		t.Fatal("3 events should be compacted:", n, err)
+	}
+	if n, err := db.Exists(ctx, key+":1", key+":3").Result(); err != nil || n != 0 {
+		t.Error("the compacted event keys should be removed:", n, err)
+	}
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 || events[0].Version() != 4 {
+		t.Error("the events after the compacted events should be loaded:", events)
+	}
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 6)),
+	}, 5); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Deleting the aggregate and clearing remove the event keys.
+	if err := store.DeleteAggregate(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := db.Exists(ctx, key, key+":4", key+":6").Result(); err != nil || n != 0 {
+		t.Error("the event keys should be deleted:", n, err)
+	}
+	other := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, other, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := db.Exists(ctx, "ns:{"+other.String()+"}:1").Result(); err != nil || n != 0 {
+		t.Error("the event keys should be cleared:", n, err)
+	}
+
+	if _, err := rediseventstore.NewEventStore(db,
+		rediseventstore.WithStorageMode(rediseventstore.KeyPerEventStorage),
+		rediseventstore.WithEventTTL(time.Hour)); !errors.Is(err, rediseventstore.ErrInvalidOption) {
+		t.Error("there should be an invalid option error:", err)
+	}
+}
+
+func testStorageMode(t *testing.T, mode rediseventstore.StorageMode, keyType string) {
+	testCases := map[string][]rediseventstore.Option{
+		"script": nil,
+		"watch":  {rediseventstore.WithWatchSave()},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, append(options,
+				rediseventstore.WithStorageMode(mode),
+				rediseventstore.WithEventIndex(),
+			)...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			testsuite.AcceptanceTest(t, store, ctx)
+
+			id := uuid.New()
+			for version := 1; version <= 12; version++ {
+				event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, version))
+				if err := store.Save(ctx, []eh.Event{event}, version-1); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}
+
+			if typ := db.Type(context.Background(), "ns:{"+id.String()+"}").Val(); typ != keyType {
+				t.Error("the aggregate key should have the type of the storage mode:", typ)
+			}
+
+			event := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "conflict"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 12))
+			err := store.Save(ctx, []eh.Event{event}, 11)
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 12 {
+				t.Fatal("there should be 12 events:", len(events))
+			}
+			for i, e := range events {
+				if e.Version() != i+1 {
+					t.Error("the events should be in version order:", e.Version())
+				}
+			}
+
+			e, err := store.LoadByEventID(ctx, events[4].(interface{ EventID() uuid.UUID }).EventID())
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if e.Version() != 5 {
+				t.Error("the event should be loaded by ID:", e.Version())
+			}
+
+			events, err = store.LoadFrom(ctx, id, 10)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 3 || events[0].Version() != 10 {
+				t.Error("the events from version 10 should be loaded:", events)
+			}
+
+			events, err = store.LoadFrom(ctx, id, 13)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 0 {
+				t.Error("there should be no events after the last version:", events)
+			}
+
+			if _, err := store.LoadFrom(ctx, uuid.New(), 1); !errors.Is(err, eh.ErrAggregateNotFound) {
+				t.Error("there should be an aggregate not found error:", err)
+			}
+
+			if n, err := store.Count(ctx, id); err != nil {
+				t.Fatal("there should be no error:", err)
+			} else if n != 12 {
+				t.Error("there should be 12 events:", n)
+			}
+
+			stream, errs := store.LoadStream(ctx, id)
+			version := 0
+			for e := range stream {
+				version++
+				if e.Version() != version {
+					t.Error("the streamed events should be in version order:", e.Version())
+				}
+			}
+			if err := <-errs; err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if version != 12 {
+				t.Error("all events should be streamed:", version)
+			}
+
+			replaced := eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "replaced"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, 5))
+			if err := store.Replace(ctx, replaced); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.RenameEvent(ctx, mocks.EventType, renamedEventType); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			events, err = store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 12 {
+				t.Fatal("there should be 12 events:", len(events))
+			}
+			if data, ok := events[4].Data().(*mocks.EventData); !ok || data.Content != "replaced" {
+				t.Error("the event should be replaced:", events[4].Data())
+			}
+			for _, e := range events {
+				if e.EventType() != renamedEventType {
+					t.Error("the event should be renamed:", e.EventType())
+				}
+			}
+		})
+	}
+}
+
+func TestEventStoreKeyPerEventWatchConflict(t *testing.T) {
+	db := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	defer db.Close()
+
+	// The event key of version 2 is set after the save checked the versions,
+	// by a writer not changing the watched keys.
+	hook := &afterCommandHook{name: "mget"}
+	db.AddHook(hook)
+
+	store, err := rediseventstore.NewEventStore(db,
+		rediseventstore.WithStorageMode(rediseventstore.KeyPerEventStorage),
+		rediseventstore.WithWatchSave(),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	key := "ns:{" + id.String() + "}"
+	hook.after = func() {
+		db.Set(context.Background(), key+":2", "stray", 0)
+	}
+	err = store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	// Only the event key that was set is counted.
+	if n, err := db.Get(ctx, key).Int(); err != nil || n != 1 {
+		t.Error("the aggregate key should count the set event keys:", n, err)
+	}
+	if raw, _ := db.Get(ctx, key+":2").Result(); raw != "stray" {
+		t.Error("the existing event key should be kept:", raw)
+	}
+}
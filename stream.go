@@ -0,0 +1,103 @@
+package ehpg
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"strconv"
+)
+
+// streamPageSize is the number of versions fetched per page by LoadStream.
+const streamPageSize = 500
+
+// LoadStream loads the events of an aggregate page by page, emitting them in
+// version order without holding the whole aggregate in memory. Both channels
+// are closed when the stream ends. The stream stops early when ctx is
+// cancelled, in which case ctx.Err() is sent on the error channel.
+func (s *EventStore) LoadStream(ctx context.Context, id uuid.UUID) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		if err := s.streamEvents(ctx, id, events); err != nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+// streamEvents sends the events of an aggregate on events in version order.
+// As versions are contiguous the events are paged by ranges of versions, which
+// unlike HSCAN keeps the events in order.
+func (s *EventStore) streamEvents(ctx context.Context, id uuid.UUID, events chan<- eh.Event) error {
+	ns := namespaceFromContext(ctx)
+	key := s.aggregateKey(ns, id)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return err
+	}
+
+	total, err := s.countEvents(ctx, s.client(ns), key).Result()
+	if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	// Start after the compacted events, see Compact.
+	compacted, err := s.compactedEvents(ctx, s.client(ns), s.compactedKey(ns, id))
+	if err != nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+
+	var sent int64
+	for version := compacted + 1; sent < total; version += streamPageSize {
+		values, err := s.loadRange(ctx, s.client(ns), key, version, version+streamPageSize-1).events()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotLoadAggregate,
+			}
+		}
+
+		found := false
+		for v := version; v < version+streamPageSize; v++ {
+			dbEvent, ok := values[strconv.Itoa(v)]
+			if !ok {
+				continue
+			}
+			found = true
+
+			e, err := s.decodeEvent(dbEvent)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case events <- e:
+				sent++
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// Stop at the end of the stored versions, also if the aggregate
+		// shrank while streaming.
+		if !found {
+			return nil
+		}
+	}
+
+	return nil
+}
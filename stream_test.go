@@ -0,0 +1,68 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadStream(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	var events []eh.Event
+	for i := 1; i <= 10; i++ {
+		events = append(events, eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, i)))
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	stream, errs := store.LoadStream(ctx, id)
+	version := 0
+	for event := range stream {
+		version++
+		if event.Version() != version {
+			t.Error("the events should be in version order:", event.Version())
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 10 {
+		t.Error("there should be ten events:", version)
+	}
+
+	// Cancel after reading two events.
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, errs = store.LoadStream(streamCtx, id)
+	<-stream
+	<-stream
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Error("there should be a cancellation error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the stream should stop when cancelled")
+	}
+	if _, ok := <-stream; ok {
+		t.Error("the event channel should be closed")
+	}
+}
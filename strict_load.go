@@ -0,0 +1,65 @@
+package ehpg
+
+import (
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+)
+
+// WithStrictLoad makes Load and LoadFrom check that the loaded versions are
+// contiguous, from the first version after the compacted events or the
+// version of LoadFrom, and fail with ErrVersionGap with the first missing
+// version, instead of handing an incomplete event stream to the aggregate. The
+// number of compacted events is fetched in the same round trip as the events.
+// Events skipped by WithLenientLoad are stored, and are not a gap.
+func WithStrictLoad() Option {
+	return func(s *EventStore) error {
+		s.strictLoad = true
+
+		return nil
+	}
+}
+
+// checkStrictLoad returns ErrVersionGap with the first missing version when
+// the stored events from the version, or from the first version after the
+// compacted events read by compacted, are not contiguous.
+func checkStrictLoad(compacted *redis.StringCmd, dbEvents map[string]string, version int) error {
+	n, err := compacted.Int()
+	if err != nil && err != redis.Nil {
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	}
+	if version <= n {
+		version = n + 1
+	}
+
+	versions := make([]int, 0, len(dbEvents))
+	for field := range dbEvents {
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("invalid version %q", field),
+				Err:     ErrVersionGap,
+			}
+		}
+		if v >= version {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+
+	for i, v := range versions {
+		if expected := version + i; v != expected {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("version %d is missing", expected),
+				Err:     ErrVersionGap,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreStrictLoad(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithStrictLoad())
+	lenientStore, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	for version := 1; version <= 6; version++ {
+		if err := store.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, version)),
+		}, version-1); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 6 {
+		t.Fatal("the contiguous events should be loaded:", events, err)
+	}
+
+	// Compacted events are not a gap.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       6,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Compact(ctx, id, 2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 5 {
+		t.Fatal("the events after the compacted events should be loaded:", events, err)
+	}
+	if events, err := store.LoadFrom(ctx, id, 1); err != nil || len(events) != 5 {
+		t.Fatal("the events after the compacted events should be loaded:", events, err)
+	}
+
+	// A partial write left a gap.
+	if err := db.HDel(ctx, "ns:{"+id.String()+"}", "4").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	_, err := store.Load(ctx, id)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(err, rediseventstore.ErrVersionGap) {
+		t.Fatal("there should be a version gap error:", err)
+	}
+	if !strings.Contains(storeErr.BaseErr.Error(), "version 4 is missing") {
+		t.Error("the first missing version should be reported:", err)
+	}
+	if _, err := store.LoadFrom(ctx, id, 3); !errors.Is(err, rediseventstore.ErrVersionGap) {
+		t.Error("there should be a version gap error:", err)
+	}
+	if events, err := store.LoadFrom(ctx, id, 5); err != nil || len(events) != 2 {
+		t.Error("the events after the gap should be loaded:", events, err)
+	}
+
+	// Without strict loads the gap is not detected.
+	if events, err := lenientStore.Load(ctx, id); err != nil || len(events) != 4 {
+		t.Error("the events around the gap should be loaded:", events, err)
+	}
+}
@@ -0,0 +1,118 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/redis/go-redis/v9"
+	"strings"
+)
+
+// ErrNotificationsDisabled is when keyspace notifications for the events of
+// aggregates are not enabled with notify-keyspace-events on the server.
+var ErrNotificationsDisabled = errors.New("keyspace notifications are disabled")
+
+// ErrCouldNotSubscribe is when a subscription to an aggregate could not be
+// made.
+var ErrCouldNotSubscribe = errors.New("could not subscribe")
+
+// Subscribe signals on the returned channel when the stored events of an
+// aggregate change, using Redis keyspace notifications. Signals are coalesced,
+// a change while a signal is pending is not signalled again, so the receiver
+// should load the aggregate after every signal. The subscription ends and the
+// channel is closed when ctx is done.
+//
+// The server must send keyspace notifications for the key type of the storage
+// mode, for example with "notify-keyspace-events Kh" for hashes, "Kz" for
+// sorted sets or "K$" for a key per event, otherwise ErrNotificationsDisabled
+// is returned. The check is skipped on servers where CONFIG is not available.
+func (s *EventStore) Subscribe(ctx context.Context, id uuid.UUID) (<-chan struct{}, error) {
+	ns := namespaceFromContext(ctx)
+	client := s.dbClient(ns)
+
+	if err := s.checkNamespace(ns); err != nil {
+		return nil, err
+	}
+	if err := s.checkNotifications(ctx, client); err != nil {
+		return nil, err
+	}
+
+	// The channel has the hash tag of the key, which makes the cluster client
+	// subscribe on the node of the aggregate.
+	channel := fmt.Sprintf("__keyspace@%d__:%s", clientDB(client), s.aggregateKey(ns, id))
+	pubsub := client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotSubscribe,
+		}
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer pubsub.Close()
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// checkNotifications returns ErrNotificationsDisabled when the server does not
+// send keyspace notifications for the events of aggregates.
+func (s *EventStore) checkNotifications(ctx context.Context, client redis.UniversalClient) error {
+	config, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		if isUnknownCommand(err) {
+			return nil
+		}
+		return eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotSubscribe,
+		}
+	}
+
+	class := "h"
+	if s.storageMode == SortedSetStorage {
+		class = "z"
+	} else if s.storageMode == KeyPerEventStorage {
+		// The counter of the stored events is a string.
+		class = "$"
+	}
+	flags := config["notify-keyspace-events"]
+	if !strings.Contains(flags, "K") || !strings.ContainsAny(flags, "A"+class) {
+		return eh.EventStoreError{
+			BaseErr: fmt.Errorf("notify-keyspace-events is %q, it must contain K and %s or A", flags, class),
+			Err:     ErrNotificationsDisabled,
+		}
+	}
+
+	return nil
+}
+
+// clientDB returns the logical database of a client, which is always 0 on
+// Redis Cluster.
+func clientDB(client redis.UniversalClient) int {
+	if c, ok := client.(*redis.Client); ok {
+		return c.Options().DB
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreSubscribe(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	config, err := db.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		t.Skip("the server does not support CONFIG:", err)
+	}
+	defer db.ConfigSet(ctx, "notify-keyspace-events", config["notify-keyspace-events"])
+
+	id := uuid.New()
+
+	// Notifications must be enabled.
+	if err := db.ConfigSet(ctx, "notify-keyspace-events", "").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Subscribe(ctx, id); !errors.Is(err, rediseventstore.ErrNotificationsDisabled) {
+		t.Fatal("there should be a notifications disabled error:", err)
+	}
+
+	if err := db.ConfigSet(ctx, "notify-keyspace-events", "Kh").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes, err := store.Subscribe(subCtx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("there should be a change")
+	}
+
+	// The channel is closed when the context is cancelled.
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			// Drain a signal sent before the cancel.
+			if _, ok := <-changes; ok {
+				t.Error("the channel should be closed")
+			}
+		}
+	case <-time.After(time.Second):
+		t.Error("the channel should be closed")
+	}
+}
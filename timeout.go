@@ -0,0 +1,35 @@
+package ehpg
+
+import (
+	"context"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// withTimeout calls f with a context limited by the operation timeout of the
+// store, and waits for it. The client aborts the commands of f at the
+// deadline, as WithOperationTimeout requires ContextTimeoutEnabled, so when
+// the deadline is exceeded, and not a deadline of the caller, the error of f
+// is replaced with the context error wrapped in err. With WithReconnectRetry
+// f is retried once after a connection error, and with WithCommandTimeout
+// every command of f is limited.
+func withTimeout[T any](ctx context.Context, s *EventStore, err error, f func(context.Context) (T, error)) (T, error) {
+	ctx = s.withCommandTimeout(ctx)
+	f = withReconnect(s, f)
+	if s.operationTimeout <= 0 {
+		return f(ctx)
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+
+	value, fErr := f(opCtx)
+	if fErr == nil || opCtx.Err() != context.DeadlineExceeded || ctx.Err() != nil {
+		return value, fErr
+	}
+
+	var zero T
+	return zero, eh.EventStoreError{
+		BaseErr: opCtx.Err(),
+		Err:     err,
+	}
+}
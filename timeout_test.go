@@ -0,0 +1,71 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventStoreOperationTimeout(t *testing.T) {
+	db := redis.NewClient(&redis.Options{
+		Addr:                  "127.0.0.1:6379",
+		ContextTimeoutEnabled: true,
+	})
+	defer db.Close()
+
+	store, err := rediseventstore.NewEventStore(db, rediseventstore.WithOperationTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The client aborts the slow commands at the deadline.
+	slow := int32(1)
+	db.AddHook(slowHook{delay: time.Second, slow: &slow})
+
+	start := time.Now()
+	_, err = store.Load(ctx, id)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("the load should fail fast:", time.Since(start))
+	}
+
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, context.DeadlineExceeded) {
+		t.Fatal("there should be a deadline exceeded error:", err)
+	}
+	if !errors.Is(err, rediseventstore.ErrCouldNotLoadAggregate) {
+		t.Error("the error should be a load error:", err)
+	}
+
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1); !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, context.DeadlineExceeded) {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+
+	atomic.StoreInt32(&slow, 0)
+	if events, err := store.Load(ctx, id); err != nil || len(events) != 1 {
+		t.Error("the events should be loaded:", events, err)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
@@ -0,0 +1,116 @@
+package ehpg
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Span attribute keys recorded by the store.
+const (
+	namespaceAttribute   = attributeKey("eventhorizon.namespace")
+	aggregateIDAttribute = attributeKey("eventhorizon.aggregate_id")
+	eventCountAttribute  = attributeKey("eventhorizon.event_count")
+	roundTripsAttribute  = attributeKey("redis.round_trips")
+)
+
+// Tracer starts the spans of the operations of the store, see WithTracer. The
+// oteltracing package records them as OpenTelemetry spans.
+type Tracer interface {
+	// Start starts a span of the operation as a child of the span in the
+	// context, with the attributes known at the start, and returns the
+	// context of the span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a started span of an operation, see Tracer.
+type Span interface {
+	// End records the error of the operation, if any, and the attributes
+	// known at the end, and ends the span.
+	End(err error, attrs ...Attribute)
+}
+
+// Attribute is an attribute of a span. The Value is a string or an int64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// attributeKey is the key of an attribute recorded by the store.
+type attributeKey string
+
+// String returns the attribute with a string value.
+func (k attributeKey) String(v string) Attribute {
+	return Attribute{Key: string(k), Value: v}
+}
+
+// Int returns the attribute with an int64 value.
+func (k attributeKey) Int(v int) Attribute {
+	return Attribute{Key: string(k), Value: int64(v)}
+}
+
+// Int64 returns the attribute with an int64 value.
+func (k attributeKey) Int64(v int64) Attribute {
+	return Attribute{Key: string(k), Value: v}
+}
+
+// WithTracer records a span for Save, Load, LoadFrom, Clear, LoadSnapshot and
+// SaveSnapshot, as a child of the span in the context, for example with the
+// OpenTelemetry tracer of the oteltracing package. The spans have the
+// namespace, aggregate ID, event count and number of Redis round trips as
+// attributes. Tracing is disabled by default.
+func WithTracer(tracer Tracer) Option {
+	return func(s *EventStore) error {
+		if tracer == nil {
+			return fmt.Errorf("%w: tracer must not be nil", ErrInvalidOption)
+		}
+
+		s.tracer = tracer
+
+		return nil
+	}
+}
+
+// span is a started span of an operation, which is a no-op without a tracer.
+type span struct {
+	span       Span
+	roundTrips *int64
+}
+
+// startSpan starts a span of the operation when tracing is enabled. The
+// returned context counts the Redis round trips of the operation.
+func (s *EventStore) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, span) {
+	if s.tracer == nil {
+		return ctx, span{}
+	}
+
+	ctx, sp := s.tracer.Start(ctx, "EventStore."+name, attrs...)
+	roundTrips := new(int64)
+
+	return context.WithValue(ctx, roundTripsKey{store: s}, roundTrips), span{span: sp, roundTrips: roundTrips}
+}
+
+// end records the error, the number of round trips and the attributes, and
+// ends the span.
+func (sp span) end(err error, attrs ...Attribute) {
+	if sp.span == nil {
+		return
+	}
+
+	sp.span.End(err, append(attrs, roundTripsAttribute.Int64(atomic.LoadInt64(sp.roundTrips)))...)
+}
+
+// roundTripsKey is the context key of the round trip counter of a span. It
+// includes the store, so that the operations of other stores called with the
+// context, like those of an AfterSave projection, are not counted.
+type roundTripsKey struct {
+	store *EventStore
+}
+
+// countRoundTrips counts n round trips sent with a context of a span of the
+// store, see storeCommands.
+func (s *EventStore) countRoundTrips(ctx context.Context, n int64) {
+	if roundTrips, ok := ctx.Value(roundTripsKey{store: s}).(*int64); ok {
+		atomic.AddInt64(roundTrips, n)
+	}
+}
@@ -0,0 +1,95 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer is a tracer recording the attributes of the ended spans.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+// recordedSpan is a span recorded by a recordingTracer.
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	err    error
+	attrs  map[string]interface{}
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...rediseventstore.Attribute) (context.Context, rediseventstore.Span) {
+	span := &recordedSpan{tracer: t, name: name, attrs: map[string]interface{}{}}
+	for _, attr := range attrs {
+		span.attrs[attr.Key] = attr.Value
+	}
+	return ctx, span
+}
+
+func (t *recordingTracer) ended() []recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]recordedSpan(nil), t.spans...)
+}
+
+func (s *recordedSpan) End(err error, attrs ...rediseventstore.Attribute) {
+	s.err = err
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, *s)
+}
+
+func TestEventStoreTracingRoundTrips(t *testing.T) {
+	tracer := &recordingTracer{}
+	store, _ := newEventStore(t, rediseventstore.WithTracer(tracer), rediseventstore.WithWatchSave())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The WATCH, the record, compacted count and event count reads of the
+	// version check of a new aggregate, the range check, the MULTI/EXEC and
+	// the UNWATCH of the save, and the HGETALL of the load.
+	spans := tracer.ended()
+	if len(spans) != 2 {
+		t.Fatal("there should be two spans:", spans)
+	}
+	if n := spans[0].attrs["redis.round_trips"]; n != int64(7) {
+		t.Error("the save should count its round trips:", n)
+	}
+	if n := spans[1].attrs["redis.round_trips"]; n != int64(1) {
+		t.Error("the load should count its round trips:", n)
+	}
+	if spans[1].name != "EventStore.Load" || spans[1].attrs["eventhorizon.event_count"] != int64(1) {
+		t.Error("the span should have the event count:", spans[1])
+	}
+
+}
@@ -0,0 +1,32 @@
+package ehpg
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// TypedEvent is a loaded event with its data asserted to the data type T.
+type TypedEvent[T eh.EventData] struct {
+	Event eh.Event
+	Data  T
+}
+
+// LoadTyped loads the events of an aggregate from the store and returns the
+// events with data of type T, with the data already asserted, skipping events
+// with other data or no data. The events keep their version order.
+func LoadTyped[T eh.EventData](ctx context.Context, store eh.EventStore, id uuid.UUID) ([]TypedEvent[T], error) {
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]TypedEvent[T], 0, len(events))
+	for _, event := range events {
+		if data, ok := event.Data().(T); ok {
+			typed = append(typed, TypedEvent[T]{Event: event, Data: data})
+		}
+	}
+
+	return typed, nil
+}
@@ -0,0 +1,58 @@
+package ehpg_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestLoadTyped(t *testing.T) {
+	store, _ := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(orderPlacedEventType, newOrderPlaced(), time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 3)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := rediseventstore.LoadTyped[*mocks.EventData](ctx, store, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("only the events with the data type should be returned:", events)
+	}
+	if events[0].Data.Content != "event1" || events[1].Data.Content != "event3" {
+		t.Error("the data should be asserted in version order:", events[0].Data, events[1].Data)
+	}
+	if events[1].Event.Version() != 3 {
+		t.Error("the event should be kept:", events[1].Event)
+	}
+
+	orders, err := rediseventstore.LoadTyped[*orderPlaced](ctx, store, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(orders) != 1 || orders[0].Data.Quantity != 3 {
+		t.Error("the order should be returned:", orders)
+	}
+}
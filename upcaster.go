@@ -0,0 +1,48 @@
+package ehpg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotUpcastEvent is when an upcaster failed to transform a stored event.
+var ErrCouldNotUpcastEvent = errors.New("could not upcast event")
+
+// Upcaster transforms the event type and raw data of a stored event at a
+// version of its aggregate, before the data is decoded. It returns the event
+// type and data unchanged for events it does not handle. The raw data is nil
+// for events without data.
+type Upcaster func(eventType eh.EventType, version int, raw json.RawMessage) (eh.EventType, json.RawMessage, error)
+
+// WithUpcaster transforms stored events with the upcaster when they are
+// loaded, for example to add a default value of a new field. Upcasters of
+// multiple options are chained in the order of the options, each receiving
+// the output of the previous one.
+func WithUpcaster(upcaster Upcaster) Option {
+	return func(s *EventStore) error {
+		if upcaster == nil {
+			return fmt.Errorf("%w: upcaster must not be nil", ErrInvalidOption)
+		}
+
+		s.upcasters = append(s.upcasters, upcaster)
+
+		return nil
+	}
+}
+
+// upcast runs the chain of upcasters on the event type and raw data of an event.
+func (s *EventStore) upcast(eventType eh.EventType, version int, raw []byte) (eh.EventType, []byte, error) {
+	for _, upcaster := range s.upcasters {
+		var err error
+		if eventType, raw, err = upcaster(eventType, version, raw); err != nil {
+			return "", nil, eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUpcastEvent,
+			}
+		}
+	}
+
+	return eventType, raw, nil
+}
@@ -0,0 +1,88 @@
+package ehpg_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreUpcaster(t *testing.T) {
+	const legacyEventType = eh.EventType("LegacyEvent")
+
+	rename := func(eventType eh.EventType, version int, raw json.RawMessage) (eh.EventType, json.RawMessage, error) {
+		if eventType == legacyEventType {
+			return mocks.EventType, raw, nil
+		}
+		return eventType, raw, nil
+	}
+	// Runs after rename, so it sees the renamed event type.
+	addDefault := func(eventType eh.EventType, version int, raw json.RawMessage) (eh.EventType, json.RawMessage, error) {
+		if eventType != mocks.EventType {
+			return eventType, raw, nil
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", nil, err
+		}
+		if data["Content"] == "" {
+			data["Content"] = "default"
+		}
+		raw, err := json.Marshal(data)
+		return eventType, raw, err
+	}
+
+	store, _ := newEventStore(t,
+		rediseventstore.WithUpcaster(rename),
+		rediseventstore.WithUpcaster(addDefault),
+	)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(legacyEventType, &mocks.EventData{}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	if events[0].EventType() != mocks.EventType {
+		t.Error("the event type should be upcasted:", events[0].EventType())
+	}
+	if data, ok := events[0].Data().(*mocks.EventData); !ok || data.Content != "default" {
+		t.Error("the event data should be upcasted:", events[0].Data())
+	}
+	if data, ok := events[1].Data().(*mocks.EventData); !ok || data.Content != "event" {
+		t.Error("the event data should be unchanged:", events[1].Data())
+	}
+
+	failing, _ := newEventStore(t, rediseventstore.WithUpcaster(
+		func(eventType eh.EventType, version int, raw json.RawMessage) (eh.EventType, json.RawMessage, error) {
+			return "", nil, errors.New("upcaster error")
+		}))
+	if _, err := failing.Load(ctx, id); !errors.Is(err, rediseventstore.ErrCouldNotUpcastEvent) {
+		t.Error("there should be an upcast error:", err)
+	}
+}
@@ -0,0 +1,105 @@
+package ehpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrVersionGap is when the stored versions of an aggregate are not
+// contiguous.
+var ErrVersionGap = errors.New("versions are not contiguous")
+
+// Verify checks that the stored versions of an aggregate are contiguous, from
+// the first version after the compacted events to the latest version, and
+// that every event is stored under its own version, for example to find
+// aggregates damaged by partial writes. It returns ErrVersionGap with the
+// first missing version, and nil for an aggregate without events.
+func (s *EventStore) Verify(ctx context.Context, id uuid.UUID) error {
+	ns := namespaceFromContext(ctx)
+	ctx, span := s.startSpan(ctx, "Verify",
+		namespaceAttribute.String(ns),
+		aggregateIDAttribute.String(id.String()))
+	start := time.Now()
+
+	type result struct {
+		dbEvents  map[string]string
+		compacted int
+	}
+	var r result
+	err := s.checkNamespace(ns)
+	if err == nil {
+		r, err = withTimeout(ctx, s, ErrCouldNotLoadAggregate, func(ctx context.Context) (result, error) {
+			compacted, err := s.compactedEvents(ctx, s.client(ns), s.compactedKey(ns, id))
+			if err != nil {
+				return result{}, err
+			}
+			dbEvents, err := s.loadAll(ctx, s.client(ns), s.aggregateKey(ns, id)).events()
+			return result{dbEvents, compacted}, err
+		})
+	}
+
+	var storeErr eh.EventStoreError
+	if errors.As(err, &storeErr) {
+		err = storeErr
+	} else if err != nil {
+		err = eh.EventStoreError{
+			BaseErr: err,
+			Err:     ErrCouldNotLoadAggregate,
+		}
+	} else {
+		err = verifyVersions(r.dbEvents, r.compacted)
+	}
+	span.end(err, eventCountAttribute.Int(len(r.dbEvents)))
+	s.metrics.observe("verify", ns, start, err)
+
+	return err
+}
+
+// verifyVersions checks that the stored events follow the compacted events
+// without gaps, and that every event has the version it is stored under.
+func verifyVersions(dbEvents map[string]string, compacted int) error {
+	versions := make([]int, 0, len(dbEvents))
+	for field, dbEvent := range dbEvents {
+		version, err := strconv.Atoi(field)
+		if err != nil {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("invalid version %q", field),
+				Err:     ErrVersionGap,
+			}
+		}
+
+		e := AggregateEvent{}
+		if err := e.UnmarshalBinary([]byte(dbEvent)); err != nil {
+			return eh.EventStoreError{
+				BaseErr: err,
+				Err:     ErrCouldNotUnmarshalEvent,
+			}
+		}
+		if e.Version != version {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("version %d holds the event of version %d", version, e.Version),
+				Err:     ErrVersionGap,
+			}
+		}
+
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	for i, version := range versions {
+		if expected := compacted + i + 1; version != expected {
+			return eh.EventStoreError{
+				BaseErr: fmt.Errorf("version %d is missing", expected),
+				Err:     ErrVersionGap,
+			}
+		}
+	}
+
+	return nil
+}
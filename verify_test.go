@@ -0,0 +1,84 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStoreVerify(t *testing.T) {
+	store, db := newEventStore(t)
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Verify(ctx, id); err != nil {
+		t.Error("an aggregate without events should be verified:", err)
+	}
+
+	for version := 1; version <= 5; version++ {
+		if err := store.Save(ctx, []eh.Event{
+			eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"}, time.Now(),
+				eh.ForAggregate(mocks.AggregateType, id, version)),
+		}, version-1); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if err := store.Verify(ctx, id); err != nil {
+		t.Error("the aggregate should be verified:", err)
+	}
+
+	// Compacted events are not a gap.
+	if err := store.SaveSnapshot(ctx, id, rediseventstore.Snapshot{
+		Version:       5,
+		AggregateType: mocks.AggregateType,
+		Timestamp:     time.Now(),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Compact(ctx, id, 2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Verify(ctx, id); err != nil {
+		t.Error("the compacted aggregate should be verified:", err)
+	}
+
+	// A partial write left a gap.
+	key := "ns:{" + id.String() + "}"
+	if err := db.HDel(ctx, key, "3").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	err := store.Verify(ctx, id)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(err, rediseventstore.ErrVersionGap) {
+		t.Fatal("there should be a version gap error:", err)
+	}
+	if !strings.Contains(storeErr.BaseErr.Error(), "version 3 is missing") {
+		t.Error("the first missing version should be reported:", err)
+	}
+
+	// An event stored under another version.
+	raw, err := db.HGet(ctx, key, "4").Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := db.HSet(ctx, key, "3", raw).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Verify(ctx, id); !errors.Is(err, rediseventstore.ErrVersionGap) {
+		t.Error("there should be a version gap error:", err)
+	}
+}
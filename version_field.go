@@ -0,0 +1,24 @@
+package ehpg
+
+// versionField is the field of the aggregate hash holding the version with
+// WithVersionField.
+const versionField = "__version"
+
+// WithVersionField keeps the version of every aggregate in a __version field
+// of its hash, which saves check against the original version and update in
+// the same atomic write as the events. With WithWatchSave the field is read
+// after watching the aggregate, so a concurrent save aborts the transaction.
+// The field is checked instead of the AggregateRecord, which is still written.
+// Without the field the version is the version of the record, which is still
+// used for aggregates saved before the option was enabled.
+//
+// The field is skipped when loading and counting events. It requires
+// HashStorage, and all stores of a keyspace should use the option, as stores
+// without it count the field as an event.
+func WithVersionField() Option {
+	return func(s *EventStore) error {
+		s.versionField = true
+
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package ehpg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/redis/go-redis/v9"
+	rediseventstore "github.com/terraskye/eh-redis"
+	"testing"
+	"time"
+)
+
+func TestEventStoreVersionField(t *testing.T) {
+	testCases := map[string][]rediseventstore.Option{
+		"script": {rediseventstore.WithVersionField()},
+		"watch":  {rediseventstore.WithVersionField(), rediseventstore.WithWatchSave()},
+	}
+
+	for name, options := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, db := newEventStore(t, options...)
+
+			ctx := namespace.NewContext(context.Background(), "ns")
+
+			defer func() {
+				if err := store.Clear(ctx); err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+			}()
+
+			id := uuid.New()
+			key := "ns:{" + id.String() + "}"
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 1)),
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 2)),
+			}, 0); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 3)),
+			}, 2); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+
+			if version, err := db.HGet(ctx, key, "__version").Int(); err != nil || version != 3 {
+				t.Error("the version field should be the version:", version, err)
+			}
+
+			events, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if len(events) != 3 {
+				t.Error("the version field should not be loaded as event:", events)
+			}
+			if n, err := store.Count(ctx, id); err != nil || n != 3 {
+				t.Error("the version field should not be counted:", n, err)
+			}
+
+			// The version field is checked, even if the event versions are
+			// free.
+			if err := db.HSet(ctx, key, "__version", 4).Err(); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			err = store.Save(ctx, []eh.Event{
+				eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event4"}, time.Now(),
+					eh.ForAggregate(mocks.AggregateType, id, 4)),
+			}, 3)
+			var storeErr eh.EventStoreError
+			if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+				t.Error("there should be a version conflict:", err)
+			}
+		})
+	}
+}
+
+func TestEventStoreVersionFieldConcurrentWriter(t *testing.T) {
+	store, db := newEventStore(t, rediseventstore.WithVersionField(), rediseventstore.WithWatchSave())
+
+	ctx := namespace.NewContext(context.Background(), "ns")
+
+	defer func() {
+		if err := store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	if err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 1)),
+	}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Another writer bumps the version between the check and the write of
+	// the transaction.
+	db.AddHook(versionWriterHook{db: db, key: "ns:{" + id.String() + "}"})
+
+	err := store.Save(ctx, []eh.Event{
+		eh.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"}, time.Now(),
+			eh.ForAggregate(mocks.AggregateType, id, 2)),
+	}, 1)
+	var storeErr eh.EventStoreError
+	if !errors.As(err, &storeErr) || !errors.Is(storeErr.BaseErr, rediseventstore.ErrVersionConflict) {
+		t.Fatal("there should be a version conflict:", err)
+	}
+
+	if n, err := db.HLen(ctx, "ns:{"+id.String()+"}").Result(); err != nil || n != 2 {
+		t.Error("the event should not be written:", n, err)
+	}
+}
+
+// versionWriterHook is a redis hook setting the version field of an aggregate
+// before every transaction.
+type versionWriterHook struct {
+	db  redis.UniversalClient
+	key string
+}
+
+func (h versionWriterHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h versionWriterHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h versionWriterHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() == "exec" {
+				if err := h.db.HSet(context.Background(), h.key, "__version", 2).Err(); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		return next(ctx, cmds)
+	}
+}